@@ -39,15 +39,32 @@ var addCmd = &cobra.Command{
 		}
 		host, _ := promptHost.Run()
 
+		promptGroup := promptui.Prompt{
+			Label: "📁 Group/Folder (optional)",
+		}
+		group, _ := promptGroup.Run()
+
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n", err)
+			return
+		}
+
+		// Offer the group's defaults; accepting them keeps the value inherited
+		defaults := cfg.Defaults(group)
+		if defaults.User == "" {
+			defaults.User = "root"
+		}
+
 		promptUser := promptui.Prompt{
 			Label:   "👤 User",
-			Default: "root",
+			Default: defaults.User,
 		}
 		user, _ := promptUser.Run()
 
 		promptPort := promptui.Prompt{
 			Label:   "🔌 Port",
-			Default: "22",
+			Default: strconv.Itoa(defaults.Port),
 			Validate: func(input string) error {
 				_, err := strconv.Atoi(input)
 				return err
@@ -64,8 +81,17 @@ var addCmd = &cobra.Command{
 
 		password, _ := promptPass.Run()
 
+		var passwordCommand string
+		if password == "" {
+			promptPassCmd := promptui.Prompt{
+				Label: "🗝️  Password Command (optional, e.g. pass show prod/db)",
+			}
+			passwordCommand, _ = promptPassCmd.Run()
+		}
+
 		promptKey := promptui.Prompt{
-			Label: "🔑 SSH Key Path (optional)",
+			Label:   "🔑 SSH Key Path (optional)",
+			Default: defaults.IdentityFile,
 		}
 
 		key, _ := promptKey.Run()
@@ -85,37 +111,28 @@ var addCmd = &cobra.Command{
 		}
 
 		promptJump := promptui.Prompt{
-			Label: "🔀 Jump Host (optional)",
+			Label:   "🔀 Jump Host (optional)",
+			Default: defaults.JumpHost,
 		}
 
 		jump, _ := promptJump.Run()
 
-		promptGroup := promptui.Prompt{
-			Label: "📁 Group/Folder (optional)",
-		}
-		group, _ := promptGroup.Run()
-
-		cfg, err := config.LoadConfig(GetPassphrase())
-
-		if err != nil {
-			fmt.Printf("\n❌ Error loading config: %v\n", err)
-			return
-		}
-
-		cfg.Connections[name] = config.Connection{
-			Name:         name,
-			Host:         host,
-			User:         user,
-			Port:         port,
-			Password:     password,
-			IdentityFile: key,
-			Tags:         tags,
-			JumpHost:     jump,
-			Group:        group,
-			CreatedAt:    time.Now(),
-		}
-
-		err = config.SaveConfig(cfg, GetPassphrase())
+		err = config.Update(GetPassphrase(), func(cfg *config.Config) error {
+			cfg.Connections[name] = config.Connection{
+				Name:            name,
+				Host:            host,
+				User:            user,
+				Port:            port,
+				Password:        password,
+				PasswordCommand: passwordCommand,
+				IdentityFile:    key,
+				Tags:            tags,
+				JumpHost:        jump,
+				Group:           group,
+				CreatedAt:       time.Now(),
+			}
+			return nil
+		})
 		if err != nil {
 			fmt.Printf("\n❌ Error saving config: %v\n", err)
 			return
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/paramientos/leap/internal/agent"
+	"github.com/paramientos/leap/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Start the background agent that caches your master password",
+	Long: `Start the LEAP agent, which keeps the master password in memory behind a
+user-only Unix socket so you are not prompted on every command.
+
+The agent forgets everything and exits after the idle timeout (0 disables it).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		foreground, _ := cmd.Flags().GetBool("foreground")
+
+		if foreground {
+			if err := agent.Serve(timeout); err != nil {
+				fmt.Printf("\n❌ Agent failed: %v\n\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		if agent.Running() {
+			fmt.Printf("\n\033[90m⊘ Agent already running on %s\033[0m\n\n", agent.SocketPath())
+			return
+		}
+
+		if err := startAgent(timeout); err != nil {
+			fmt.Printf("\n❌ Failed to start agent: %v\n\n", err)
+			return
+		}
+
+		fmt.Printf("\n\033[32m✓\033[0m Agent started on \033[1;36m%s\033[0m\n", agent.SocketPath())
+		fmt.Print("\033[90mTip: Run 'leap unlock' to cache your master password\033[0m\n\n")
+	},
+}
+
+var agentStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the agent is running and what it holds",
+	Run: func(cmd *cobra.Command, args []string) {
+		status, err := agent.GetStatus()
+		if err != nil {
+			fmt.Print("\n\033[90mAgent is not running\033[0m\n\n")
+			return
+		}
+
+		fmt.Println("\n⚡ \033[1;32mLEAP Agent\033[0m")
+		fmt.Print("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n\n")
+		fmt.Printf("  \033[1m%-15s\033[0m %d\n", "PID:", status.PID)
+		fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Socket:", agent.SocketPath())
+
+		if status.IdleTimeout != "" {
+			fmt.Printf("  \033[1m%-15s\033[0m %s (expires in %s)\n", "Idle Timeout:", status.IdleTimeout, status.ExpiresIn)
+		} else {
+			fmt.Printf("  \033[1m%-15s\033[0m never\n", "Idle Timeout:")
+		}
+
+		if len(status.Unlocked) == 0 {
+			fmt.Printf("  \033[1m%-15s\033[0m \033[33mlocked\033[0m\n", "Vaults:")
+		}
+		for _, vault := range status.Unlocked {
+			fmt.Printf("  \033[1m%-15s\033[0m \033[32munlocked\033[0m %s\n", "Vault:", vault)
+		}
+
+		fmt.Println()
+	},
+}
+
+var agentStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the agent and wipe cached passwords",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := agent.Stop(); err != nil {
+			fmt.Print("\n\033[90mAgent is not running\033[0m\n\n")
+			return
+		}
+
+		fmt.Print("\n\033[32m✓\033[0m Agent stopped\n\n")
+	},
+}
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Make the agent forget your master password",
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+
+		vault := config.GetConfigPath()
+		if all {
+			vault = ""
+		}
+
+		if err := agent.Lock(vault); err != nil {
+			fmt.Print("\n\033[90mAgent is not running, nothing to lock\033[0m\n\n")
+			return
+		}
+
+		fmt.Print("\n🔒 Vault locked\n\n")
+	},
+}
+
+var unlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Cache your master password in the agent",
+	Run: func(cmd *cobra.Command, args []string) {
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+
+		if config.UsesRecipients() {
+			fmt.Print("\n\033[90mThe vault is opened with your identity file; nothing to unlock\033[0m\n\n")
+			return
+		}
+
+		prompt := promptui.Prompt{
+			Label: "🔓 Enter Master Password",
+			Mask:  '*',
+		}
+
+		password, err := prompt.Run()
+		if err != nil {
+			return
+		}
+
+		if _, err := config.LoadConfig(password); err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		if err := cacheInAgent(password, timeout); err != nil {
+			fmt.Printf("\n❌ Failed to reach agent: %v\n\n", err)
+			return
+		}
+
+		fmt.Print("\n🔓 Vault unlocked\n\n")
+	},
+}
+
+// cacheInAgent hands the verified master password to the agent, starting
+// one if needed.
+func cacheInAgent(password string, timeout time.Duration) error {
+	if !agent.Running() {
+		if err := startAgent(timeout); err != nil {
+			return err
+		}
+	}
+
+	return agent.Set(config.GetConfigPath(), password)
+}
+
+// startAgent launches `leap agent --foreground` detached from the terminal
+// and waits for its socket to answer.
+func startAgent(timeout time.Duration) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	c := exec.Command(exe, "agent", "--foreground", "--timeout", timeout.String())
+	detach(c)
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+	go c.Wait()
+
+	for i := 0; i < 40; i++ {
+		if agent.Running() {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return fmt.Errorf("agent did not come up on %s", agent.SocketPath())
+}
+
+func init() {
+	agentCmd.Flags().Duration("timeout", agent.DefaultIdleTimeout, "Forget passwords and exit after this much inactivity (0 = never)")
+	agentCmd.Flags().Bool("foreground", false, "Run in the foreground instead of detaching")
+	unlockCmd.Flags().Duration("timeout", agent.DefaultIdleTimeout, "Idle timeout if a new agent has to be started")
+	lockCmd.Flags().BoolP("all", "a", false, "Forget the passwords of every vault")
+
+	agentCmd.AddCommand(agentStatusCmd)
+	agentCmd.AddCommand(agentStopCmd)
+
+	rootCmd.AddCommand(agentCmd)
+	rootCmd.AddCommand(lockCmd)
+	rootCmd.AddCommand(unlockCmd)
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/paramientos/leap/internal/config"
+	leapssh "github.com/paramientos/leap/internal/ssh"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+var caCmd = &cobra.Command{
+	Use:   "ca",
+	Short: "Sign short-lived SSH user certificates with a local CA",
+	Long: `Keep an SSH user CA in ~/.leap and sign short-lived certificates
+instead of copying public keys to every server.
+
+  leap ca init                          create the CA key, encrypted with a passphrase
+  leap ca trust --tag prod              make servers trust it (TrustedUserCAKeys)
+  leap ca sign db --principals deploy   issue a certificate for a connection
+
+Only 'leap ca sign' decrypts the CA key. Set LEAP_CA_PASSPHRASE to sign
+without a prompt.`,
+}
+
+var caInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the CA key",
+	Run: func(cmd *cobra.Command, args []string) {
+		force, _ := cmd.Flags().GetBool("force")
+
+		if leapssh.CAExists() && !force {
+			fmt.Printf("\n❌ A CA key already exists at %s\n", leapssh.CAKeyPath())
+			fmt.Print("\033[90mTip: Use --force to replace it; certificates it signed stop working\033[0m\n\n")
+			return
+		}
+
+		passphrase, err := caPassphrase(true)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		pub, err := leapssh.InitCA(force, passphrase)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		fmt.Printf("\n\033[32m✓\033[0m CA key created at \033[1;36m%s\033[0m\n", leapssh.CAKeyPath())
+		fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Fingerprint:", ssh.FingerprintSHA256(pub))
+		fmt.Print("\033[90mNext: run 'leap ca trust <name>' to install it on your servers\033[0m\n\n")
+	},
+}
+
+var caShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the CA public key",
+	Run: func(cmd *cobra.Command, args []string) {
+		pub, err := leapssh.LoadCAPublicKey()
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		fmt.Printf("%s leap-user-ca\n", strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))))
+	},
+}
+
+var caSignCmd = &cobra.Command{
+	Use:   "sign [name]",
+	Short: "Sign a user certificate for a connection or a public key file",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		principals, _ := cmd.Flags().GetStringSlice("principals")
+		validity, _ := cmd.Flags().GetDuration("validity")
+		keyID, _ := cmd.Flags().GetString("key-id")
+		pubkeyFile, _ := cmd.Flags().GetString("pubkey")
+
+		if (len(args) == 0) == (pubkeyFile == "") {
+			fmt.Print("\n❌ Give either a connection name or --pubkey\n\n")
+			return
+		}
+
+		ca, err := loadCASigner()
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		if pubkeyFile != "" {
+			data, err := os.ReadFile(pubkeyFile)
+			if err != nil {
+				fmt.Printf("\n❌ %v\n\n", err)
+				return
+			}
+
+			pub, comment, _, _, err := ssh.ParseAuthorizedKey(data)
+			if err != nil {
+				fmt.Printf("\n❌ %s: %v\n\n", pubkeyFile, err)
+				return
+			}
+
+			if keyID == "" {
+				keyID = comment
+			}
+
+			certFile := strings.TrimSuffix(pubkeyFile, ".pub") + "-cert.pub"
+			cert, err := signCertificate(ca, pub, certFile, keyID, principals, validity)
+			if err != nil {
+				fmt.Printf("\n❌ %v\n\n", err)
+				return
+			}
+
+			printCertificate(certFile, cert)
+			return
+		}
+
+		name := args[0]
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		conn, ok := cfg.Connections[name]
+		if !ok {
+			fmt.Printf("\n❌ Connection '\033[1;36m%s\033[0m' not found.\n\n", name)
+			return
+		}
+
+		identity := conn.IdentityFile
+		if identity == "" {
+			identity, err = ensureLeapKey()
+			if err != nil {
+				fmt.Printf("\n❌ Failed to create key: %v\n\n", err)
+				return
+			}
+		}
+
+		pub, err := leapssh.ReadPublicKey(identity)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		if len(principals) == 0 {
+			principals = []string{conn.User}
+		}
+		if keyID == "" {
+			keyID = fmt.Sprintf("leap:%s", name)
+		}
+
+		certFile := identity + "-cert.pub"
+		cert, err := signCertificate(ca, pub, certFile, keyID, principals, validity)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		err = config.Update(GetPassphrase(), func(cfg *config.Config) error {
+			conn, ok := cfg.Connections[name]
+			if !ok {
+				return fmt.Errorf("connection '%s' no longer exists", name)
+			}
+			if conn.IdentityFile == "" {
+				conn.IdentityFile = identity
+			}
+			conn.CertificateFile = certFile
+			cfg.Connections[name] = conn
+			return nil
+		})
+
+		if err != nil {
+			fmt.Printf("\n⚠️  Certificate written but failed to update config: %v\n\n", err)
+			return
+		}
+
+		printCertificate(certFile, cert)
+	},
+}
+
+var caTrustCmd = &cobra.Command{
+	Use:   "trust [name...]",
+	Short: "Install the CA as TrustedUserCAKeys on servers",
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+		tag, _ := cmd.Flags().GetString("tag")
+
+		caKey, err := leapssh.LoadCAPublicKey()
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		targets, err := selectConnections(cfg, args, tag, all)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(caKey))) + " leap-user-ca"
+		script := leapssh.ShellQuote(trustCAScript)
+		command := fmt.Sprintf(`if [ "$(id -u)" = 0 ]; then sh -c %s leap-ca %s; else sudo -n sh -c %s leap-ca %s; fi`,
+			script, leapssh.ShellQuote(key), script, leapssh.ShellQuote(key))
+
+		fmt.Println("\n⚡ \033[1;32mTrust User CA\033[0m")
+		fmt.Print("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n\n")
+
+		needsRoot := false
+		for _, conn := range targets {
+			output, err := leapssh.RunCommand(conn, command, leapssh.DialOptions{
+				Config:      cfg,
+				Timeout:     30 * time.Second,
+				Interactive: true,
+			})
+
+			lines := strings.Split(strings.TrimSpace(output), "\n")
+			status := lines[len(lines)-1]
+
+			switch {
+			case err != nil:
+				if strings.Contains(output, "sudo") || strings.Contains(output, "Permission denied") {
+					needsRoot = true
+				}
+				fmt.Printf("\033[31m✗\033[0m \033[1;36m%s\033[0m: %v\n", conn.Name, err)
+				if out := strings.TrimSpace(output); out != "" {
+					fmt.Printf("  \033[90m%s\033[0m\n", strings.ReplaceAll(out, "\n", "\n  "))
+				}
+			case status == "present":
+				fmt.Printf("\033[32m✓\033[0m \033[1;36m%s\033[0m already trusts the CA\n", conn.Name)
+			default:
+				fmt.Printf("\033[32m✓\033[0m \033[1;36m%s\033[0m now trusts the CA\n", conn.Name)
+			}
+		}
+
+		if needsRoot {
+			fmt.Print("\n\033[90mTip: The login user needs root or passwordless sudo to change sshd_config\033[0m\n")
+		}
+		fmt.Println()
+	},
+}
+
+// trustCAScript adds the CA key ($1) to the file sshd reads TrustedUserCAKeys
+// from. Without such a file it configures /etc/ssh/leap_user_ca.pub, through
+// a drop-in when sshd_config includes sshd_config.d and otherwise at the top
+// of sshd_config, so the directive never lands inside a Match block. If sshd
+// rejects the result, the file it changed is restored before exiting, so a
+// later restart cannot fail on it.
+const trustCAScript = `set -e
+key="$1"
+conf=/etc/ssh/sshd_config
+PATH="$PATH:/usr/sbin:/sbin"
+changed=
+target=
+backup=
+ok=
+restore() {
+	if [ -n "$backup" ]; then
+		mv -f "$backup" "$target"
+	elif [ -n "$target" ]; then
+		rm -f "$target"
+	fi
+}
+trap '[ -n "$ok" ] || restore' EXIT
+file=$(sshd -T 2>/dev/null | awk '$1 == "trustedusercakeys" { print $2 }')
+if [ -z "$file" ]; then
+	file=$(cat "$conf" /etc/ssh/sshd_config.d/*.conf 2>/dev/null | awk 'tolower($1) == "trustedusercakeys" { print $2; exit }')
+fi
+if [ -z "$file" ] || [ "$file" = none ]; then
+	file=/etc/ssh/leap_user_ca.pub
+	if grep -Eq '^[[:space:]]*Include[[:space:]]+/etc/ssh/sshd_config\.d/\*\.conf' "$conf"; then
+		target=/etc/ssh/sshd_config.d/50-leap-ca.conf
+	else
+		target="$conf"
+	fi
+	if [ -e "$target" ]; then
+		backup=$(mktemp "$target.XXXXXX")
+		cp -p "$target" "$backup"
+	fi
+	if [ "$target" = "$conf" ]; then
+		tmp=$(mktemp "$conf.XXXXXX")
+		{ echo "TrustedUserCAKeys $file"; cat "$conf"; } > "$tmp"
+		chmod 644 "$tmp"
+		mv "$tmp" "$conf"
+	else
+		echo "TrustedUserCAKeys $file" > "$target"
+	fi
+	changed=1
+fi
+touch "$file"
+chmod 644 "$file"
+if ! grep -qxF "$key" "$file"; then
+	echo "$key" >> "$file"
+	changed=1
+fi
+if [ -z "$changed" ]; then
+	ok=1
+	echo present
+	exit 0
+fi
+if ! sshd -t; then
+	echo "sshd rejected the new configuration; restored the previous one" >&2
+	exit 1
+fi
+ok=1
+[ -z "$backup" ] || rm -f "$backup"
+systemctl reload sshd 2>/dev/null || systemctl reload ssh 2>/dev/null || service ssh reload 2>/dev/null || service sshd reload 2>/dev/null || pkill -HUP -x sshd
+echo added
+`
+
+// caPassphrase returns the CA key passphrase from LEAP_CA_PASSPHRASE or
+// asks for it, twice when choosing a new one.
+func caPassphrase(confirm bool) (string, error) {
+	if env := os.Getenv("LEAP_CA_PASSPHRASE"); env != "" {
+		return env, nil
+	}
+
+	label := "🔒 CA Passphrase"
+	if confirm {
+		label = "🔒 New CA Passphrase"
+	}
+
+	passphrase, err := (&promptui.Prompt{
+		Label: label,
+		Mask:  '*',
+		Validate: func(input string) error {
+			if confirm && len(input) < 8 {
+				return fmt.Errorf("passphrase must be at least 8 characters")
+			}
+			return nil
+		},
+	}).Run()
+	if err != nil {
+		return "", err
+	}
+
+	if confirm {
+		again, err := (&promptui.Prompt{Label: "🔒 Repeat CA Passphrase", Mask: '*'}).Run()
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+
+	return passphrase, nil
+}
+
+// loadCASigner decrypts the CA key, first encrypting one saved before CA
+// keys had a passphrase.
+func loadCASigner() (ssh.Signer, error) {
+	encrypted, err := leapssh.CAEncrypted()
+	if err != nil {
+		return nil, err
+	}
+
+	if !encrypted {
+		fmt.Printf("\n\033[33m⚠\033[0m  The CA key at %s is not encrypted; choose a passphrase to protect it\n", leapssh.CAKeyPath())
+
+		passphrase, err := caPassphrase(true)
+		if err != nil {
+			return nil, err
+		}
+		if err := leapssh.ProtectCA(passphrase); err != nil {
+			return nil, fmt.Errorf("failed to encrypt the CA key: %v", err)
+		}
+		return leapssh.LoadCA(passphrase)
+	}
+
+	passphrase, err := caPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	return leapssh.LoadCA(passphrase)
+}
+
+func signCertificate(ca ssh.Signer, pub ssh.PublicKey, certFile, keyID string, principals []string, validity time.Duration) (*ssh.Certificate, error) {
+	cert, err := leapssh.SignUserCert(ca, pub, leapssh.CertOptions{
+		KeyID:      keyID,
+		Principals: principals,
+		Validity:   validity,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := leapssh.WriteCertificate(certFile, cert); err != nil {
+		return nil, fmt.Errorf("failed to write certificate: %v", err)
+	}
+
+	return cert, nil
+}
+
+func printCertificate(certFile string, cert *ssh.Certificate) {
+	fmt.Printf("\n\033[32m✓\033[0m Certificate written to \033[1;36m%s\033[0m\n", certFile)
+	fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Key ID:", cert.KeyId)
+	fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Principals:", strings.Join(cert.ValidPrincipals, ", "))
+	fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Valid Until:", time.Unix(int64(cert.ValidBefore), 0).Format("2006-01-02 15:04:05"))
+	fmt.Println()
+}
+
+// ensureLeapKey returns LEAP's own key pair in ~/.leap, creating it on first use.
+func ensureLeapKey() (string, error) {
+	path := filepath.Join(config.GetBaseDir(), "id_ed25519")
+
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	fmt.Printf("\n🔑 No Leap SSH key found. Generating a new one at \033[1;36m%s\033[0m...\n", path)
+	if _, err := leapssh.GenerateKey(path, "leap-ssh-manager"); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+func init() {
+	caInitCmd.Flags().Bool("force", false, "Replace an existing CA key")
+
+	caSignCmd.Flags().StringSlice("principals", nil, "Users the certificate is valid for (default: the connection's user)")
+	caSignCmd.Flags().Duration("validity", 8*time.Hour, "How long the certificate stays valid")
+	caSignCmd.Flags().String("key-id", "", "Key ID recorded in server logs (default: leap:<name>)")
+	caSignCmd.Flags().String("pubkey", "", "Sign this public key file instead of a connection's key")
+
+	caTrustCmd.Flags().BoolP("all", "a", false, "Install on all connections")
+	caTrustCmd.Flags().StringP("tag", "t", "", "Install on connections with specific tag")
+
+	caCmd.AddCommand(caInitCmd)
+	caCmd.AddCommand(caShowCmd)
+	caCmd.AddCommand(caSignCmd)
+	caCmd.AddCommand(caTrustCmd)
+	rootCmd.AddCommand(caCmd)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/paramientos/leap/internal/config"
+	"github.com/paramientos/leap/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Maintain the encrypted configuration file",
+}
+
+var configBackupsCmd = &cobra.Command{
+	Use:   "backups",
+	Short: "List automatic backups of the configuration",
+	Run: func(cmd *cobra.Command, args []string) {
+		backups, err := config.ListBackups()
+		if err != nil {
+			fmt.Printf("\n❌ Error reading backups: %v\n\n", err)
+			return
+		}
+
+		fmt.Println("\n⚡ \033[1;32mConfiguration Backups\033[0m")
+		fmt.Print("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n\n")
+
+		if len(backups) == 0 {
+			fmt.Print("  No backups yet. One is taken every time the configuration is saved.\n\n")
+			return
+		}
+
+		for i, backup := range backups {
+			fmt.Printf("  \033[1m%2d\033[0m  %s  \033[90m%s\033[0m\n", i+1, backup.Time.Format("2006-01-02 15:04:05"), backupSize(backup))
+		}
+
+		fmt.Printf("\n\033[90mKeeping the last %d versions in %s\033[0m\n\n", config.MaxBackups, config.GetBackupDir())
+	},
+}
+
+var configRestoreCmd = &cobra.Command{
+	Use:   "restore [number]",
+	Short: "Roll the configuration back to an automatic backup",
+	Long: `Roll the configuration back to an automatic backup.
+
+Backups are numbered from newest (1) to oldest, as shown by 'leap config backups'.
+Without a number you can pick one interactively. The current configuration is
+itself backed up first, so a restore can be undone.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		backups, err := config.ListBackups()
+		if err != nil {
+			fmt.Printf("\n❌ Error reading backups: %v\n\n", err)
+			return
+		}
+
+		if len(backups) == 0 {
+			fmt.Print("\n\033[90mNo backups to restore\033[0m\n\n")
+			return
+		}
+
+		var index int
+		if len(args) == 1 {
+			index, err = strconv.Atoi(args[0])
+			if err != nil || index < 1 || index > len(backups) {
+				fmt.Printf("\n❌ Invalid backup number '%s' (1-%d)\n\n", args[0], len(backups))
+				return
+			}
+			index--
+		} else {
+			var items []string
+			for _, backup := range backups {
+				items = append(items, fmt.Sprintf("%s  (%s)", backup.Time.Format("2006-01-02 15:04:05"), backupSize(backup)))
+			}
+
+			prompt := promptui.Select{
+				Label: "Select backup to restore",
+				Items: items,
+			}
+
+			index, _, err = prompt.Run()
+			if err != nil {
+				return
+			}
+		}
+
+		backup := backups[index]
+		passphrase := GetPassphrase()
+
+		restored, err := config.LoadBackup(backup.Path, passphrase)
+		if err != nil {
+			fmt.Printf("\n❌ Cannot open backup: %v\n\n", err)
+			return
+		}
+
+		current, err := config.LoadConfig(passphrase)
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		fmt.Printf("\nBackup from \033[1m%s\033[0m has \033[1m%d\033[0m connection(s); current config has \033[1m%d\033[0m.\n",
+			backup.Time.Format("2006-01-02 15:04:05"), len(restored.Connections), len(current.Connections))
+
+		prompt := promptui.Prompt{
+			Label:     "Restore this backup",
+			IsConfirm: true,
+		}
+
+		result, err := prompt.Run()
+		if err != nil || strings.ToLower(result) != "y" {
+			fmt.Print("\n\033[90m⊘ Restore cancelled\033[0m\n\n")
+			return
+		}
+
+		if err := config.RestoreBackup(backup.Path, passphrase); err != nil {
+			fmt.Printf("\n❌ Failed to restore backup: %v\n\n", err)
+			return
+		}
+
+		fmt.Print("\n\033[32m✓\033[0m Configuration restored. The previous version was saved as backup 1.\n\n")
+	},
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the configuration to the current schema version",
+	Long: `Upgrade the configuration to the current schema version.
+
+Older configurations are upgraded in memory every time they are loaded and
+written back on the next save. This command writes the upgrade immediately;
+with --dry-run it only shows the steps and the resulting changes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		var plan *config.MigrationPlan
+		var err error
+
+		if dryRun {
+			plan, err = config.PlanMigration(GetPassphrase())
+		} else {
+			plan, err = config.MigrateVault(GetPassphrase())
+		}
+		if err != nil {
+			fmt.Printf("\n❌ Migration failed: %v\n\n", err)
+			return
+		}
+
+		fmt.Println("\n⚡ \033[1;32mConfiguration Migration\033[0m")
+		fmt.Print("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n\n")
+		fmt.Printf("  \033[1m%-17s\033[0m %d\n", "Stored version:", plan.From)
+		fmt.Printf("  \033[1m%-17s\033[0m %d\n", "Current version:", plan.To)
+
+		if plan.Before == plan.After {
+			fmt.Print("\n\033[32m✓\033[0m Configuration is up to date\n\n")
+			return
+		}
+
+		if len(plan.Steps) > 0 {
+			fmt.Println("\n  \033[1mSteps:\033[0m")
+			for _, step := range plan.Steps {
+				fmt.Printf("    • %s\n", step)
+			}
+		}
+
+		fmt.Println("\n  \033[1mChanges:\033[0m")
+		printConfigDiff(plan.Before, plan.After)
+
+		if dryRun {
+			fmt.Print("\n\033[90m⊘ Dry run, nothing was written. Run without --dry-run to apply.\033[0m\n\n")
+			return
+		}
+
+		fmt.Printf("\n\033[32m✓\033[0m Configuration migrated to version %d (previous version backed up)\n\n", plan.To)
+	},
+}
+
+// printConfigDiff prints the changed lines of two config documents with a
+// little context, masking secrets.
+func printConfigDiff(before, after string) {
+	printLineDiff(before, after, maskSecret)
+}
+
+// printLineDiff prints the changed lines of two texts with a little context,
+// passing every line through render first.
+func printLineDiff(before, after string, render func(string) string) {
+	const context = 2
+
+	diff := utils.DiffLines(strings.Split(strings.TrimRight(before, "\n"), "\n"), strings.Split(strings.TrimRight(after, "\n"), "\n"))
+
+	show := make([]bool, len(diff))
+	for i, line := range diff {
+		if line.Op == utils.DiffEqual {
+			continue
+		}
+		for j := i - context; j <= i+context; j++ {
+			if j >= 0 && j < len(diff) {
+				show[j] = true
+			}
+		}
+	}
+
+	gap := false
+	for i, line := range diff {
+		if !show[i] {
+			gap = true
+			continue
+		}
+		if gap {
+			fmt.Println("    \033[90m...\033[0m")
+			gap = false
+		}
+
+		text := render(line.Text)
+		switch line.Op {
+		case utils.DiffDelete:
+			fmt.Printf("    \033[31m- %s\033[0m\n", text)
+		case utils.DiffInsert:
+			fmt.Printf("    \033[32m+ %s\033[0m\n", text)
+		default:
+			fmt.Printf("    \033[90m  %s\033[0m\n", text)
+		}
+	}
+}
+
+func maskSecret(line string) string {
+	trimmed := strings.TrimSpace(line)
+	for _, key := range []string{"password:", "key_passphrase:", "sudo_password:", "totp_secret:"} {
+		if strings.HasPrefix(trimmed, key) {
+			return line[:strings.Index(line, key)+len(key)] + " ********"
+		}
+	}
+
+	return line
+}
+
+func backupSize(backup config.Backup) string {
+	return fmt.Sprintf("%.1f KB", float64(backup.Size)/1024)
+}
+
+func init() {
+	configCmd.AddCommand(configBackupsCmd)
+	configCmd.AddCommand(configRestoreCmd)
+	configCmd.AddCommand(configMigrateCmd)
+
+	configMigrateCmd.Flags().Bool("dry-run", false, "Show what would change without writing")
+
+	rootCmd.AddCommand(configCmd)
+}
@@ -50,12 +50,14 @@ var connectCmd = &cobra.Command{
 			fmt.Printf("\n🚀 Connecting to \033[1;36m%s\033[0m (\033[33m%s\033[0m@\033[32m%s\033[0m)...\n\n", name, conn.User, conn.Host)
 		}
 
-		cfg.UpdateLastUsed(name)
-		config.SaveConfig(cfg, GetPassphrase())
+		config.Update(GetPassphrase(), func(cfg *config.Config) error {
+			cfg.UpdateLastUsed(name)
+			return nil
+		})
 
 		record, _ := cmd.Flags().GetBool("record")
 
-		err = ssh.Connect(conn, record)
+		err = ssh.Connect(conn, record, cfg)
 
 		if err != nil {
 			fmt.Printf("\n❌ SSH Connection closed with error: %v\n\n", err)
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/paramientos/leap/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var copyCmd = &cobra.Command{
+	Use:     "copy [name...] --to-profile [profile]",
+	Aliases: []string{"cp"},
+	Short:   "Copy connections into another profile",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		target, _ := cmd.Flags().GetString("to-profile")
+		move, _ := cmd.Flags().GetBool("move")
+		force, _ := cmd.Flags().GetBool("force")
+
+		source := config.ActiveProfile()
+
+		if target == "" {
+			fmt.Print("\n❌ Please specify the destination with --to-profile\n\n")
+			return
+		}
+		if target == source {
+			fmt.Print("\n❌ Source and destination profile are the same\n\n")
+			return
+		}
+		if err := config.ValidateProfileName(target); err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+		if !config.ProfileExists(target) {
+			fmt.Printf("\n❌ Profile '%s' does not exist\n\n", target)
+			return
+		}
+
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		var conns []config.Connection
+		for _, name := range args {
+			conn, ok := cfg.Connections[name]
+			if !ok {
+				fmt.Printf("\n❌ Connection '\033[1;36m%s\033[0m' not found in profile '%s'\n\n", name, source)
+				return
+			}
+			conns = append(conns, conn)
+		}
+
+		fmt.Printf("\n📋 Copying to profile \033[1;36m%s\033[0m\n", target)
+
+		config.SetProfile(target)
+
+		var copied []string
+		err = config.Update(GetPassphrase(), func(dst *config.Config) error {
+			for _, conn := range conns {
+				if _, exists := dst.Connections[conn.Name]; exists && !force {
+					fmt.Printf("\033[90m⊘ Skipped \033[1;36m%s\033[0m\033[90m (already exists, use --force to overwrite)\033[0m\n", conn.Name)
+					continue
+				}
+
+				dst.Connections[conn.Name] = conn
+				copied = append(copied, conn.Name)
+			}
+			return nil
+		})
+
+		config.SetProfile(source)
+
+		if err != nil {
+			fmt.Printf("\n❌ Error saving profile '%s': %v\n\n", target, err)
+			return
+		}
+
+		for _, name := range copied {
+			fmt.Printf("\033[32m✓\033[0m Copied \033[1;36m%s\033[0m\n", name)
+		}
+
+		if move && len(copied) > 0 {
+			err = config.Update(GetPassphrase(), func(src *config.Config) error {
+				for _, name := range copied {
+					src.DeleteConnection(name)
+				}
+				return nil
+			})
+			if err != nil {
+				fmt.Printf("\n❌ Copied, but failed to remove from '%s': %v\n\n", source, err)
+				return
+			}
+
+			fmt.Printf("\033[32m✓\033[0m Removed %d connection(s) from \033[1;36m%s\033[0m\n", len(copied), source)
+		}
+
+		fmt.Println()
+	},
+}
+
+func init() {
+	copyCmd.Flags().StringP("to-profile", "t", "", "Destination profile")
+	copyCmd.Flags().BoolP("move", "m", false, "Remove the connections from the current profile afterwards")
+	copyCmd.Flags().BoolP("force", "f", false, "Overwrite connections that already exist in the destination")
+
+	rootCmd.AddCommand(copyCmd)
+}
@@ -53,10 +53,7 @@ var deleteCmd = &cobra.Command{
 				}
 			}
 
-			if cfg.DeleteConnection(name) {
-				deleted = append(deleted, name)
-				fmt.Printf("\033[32m✓\033[0m Deleted \033[1;36m%s\033[0m\n", name)
-			}
+			deleted = append(deleted, name)
 		}
 
 		if len(notFound) > 0 {
@@ -64,12 +61,21 @@ var deleteCmd = &cobra.Command{
 		}
 
 		if len(deleted) > 0 {
-			err = config.SaveConfig(cfg, GetPassphrase())
+			err = config.Update(GetPassphrase(), func(cfg *config.Config) error {
+				for _, name := range deleted {
+					cfg.DeleteConnection(name)
+				}
+				return nil
+			})
 			if err != nil {
 				fmt.Printf("\n❌ Error saving config: %v\n\n", err)
 				return
 			}
 
+			for _, name := range deleted {
+				fmt.Printf("\033[32m✓\033[0m Deleted \033[1;36m%s\033[0m\n", name)
+			}
+
 			fmt.Println("\n\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
 			fmt.Printf("\n\033[32m✓\033[0m Successfully deleted \033[1m%d\033[0m connection(s)\n\n", len(deleted))
 		} else {
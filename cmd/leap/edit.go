@@ -73,6 +73,28 @@ var editCmd = &cobra.Command{
 			password = conn.Password
 		}
 
+		promptPassCmd := promptui.Prompt{
+			Label:   "🗝️  Password Command",
+			Default: conn.PasswordCommand,
+		}
+
+		passwordCommand, _ := promptPassCmd.Run()
+
+		promptSudoPass := promptui.Prompt{
+			Label:   "🛡️  Sudo Password (leave empty to keep current, '-' to clear)",
+			Mask:    '*',
+			Default: "",
+		}
+
+		sudoPassword, _ := promptSudoPass.Run()
+
+		promptSudoPassCmd := promptui.Prompt{
+			Label:   "🛡️  Sudo Password Command",
+			Default: conn.SudoPasswordCommand,
+		}
+
+		sudoPasswordCommand, _ := promptSudoPassCmd.Run()
+
 		promptKey := promptui.Prompt{
 			Label:   "🔑 SSH Key Path",
 			Default: conn.IdentityFile,
@@ -118,14 +140,30 @@ var editCmd = &cobra.Command{
 			conn.Password = password
 		}
 
+		conn.PasswordCommand = passwordCommand
+
+		switch sudoPassword {
+		case "":
+		case "-":
+			conn.SudoPassword = ""
+		default:
+			conn.SudoPassword = sudoPassword
+		}
+
+		conn.SudoPasswordCommand = sudoPasswordCommand
+
 		conn.IdentityFile = key
 		conn.Tags = tags
 		conn.JumpHost = jump
 		conn.Notes = notes
 
-		cfg.Connections[name] = conn
-
-		err = config.SaveConfig(cfg, GetPassphrase())
+		err = config.Update(GetPassphrase(), func(cfg *config.Config) error {
+			if _, ok := cfg.Connections[name]; !ok {
+				return fmt.Errorf("connection '%s' no longer exists", name)
+			}
+			cfg.Connections[name] = conn
+			return nil
+		})
 
 		if err != nil {
 			fmt.Printf("\n❌ Error saving config: %v\n\n", err)
@@ -1,19 +1,60 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"sort"
 	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/paramientos/leap/internal/config"
+	"github.com/paramientos/leap/internal/fleet"
+	"github.com/paramientos/leap/internal/ssh"
 	"github.com/spf13/cobra"
 )
 
 var execCmd = &cobra.Command{
 	Use:   "exec [name] [command]",
 	Short: "Execute a command on remote server(s)",
-	Args:  cobra.MinimumNArgs(2),
+	Long: `Execute a command on one server, or on many in parallel with --tag or --all.
+
+With several servers, output lines are prefixed with the server name as they
+arrive (or printed per server with --by-host), followed by a summary table.
+The exit status is non-zero if any server failed.
+
+--group-output prints each distinct output once with the servers that
+produced it, largest group first; add --diff to compare the other groups
+against the largest one.
+
+--output json prints one array of results when all servers are done, and
+--output ndjson prints one result per line as each server finishes. Each
+result carries stdout, stderr, exit_code, start/end and an error_class of
+dial, auth, timeout, nonzero-exit or session. These modes never prompt.
+
+--sudo runs the command through "sudo -S" and answers its password prompt
+with the connection's sudo password, its sudo password command or else its
+login password (set them with 'leap edit'), asking on the terminal as a last
+resort. The password is sent over stdin, never shown in the output, and a
+PTY is allocated only if sudoers requires one.
+
+Examples:
+  leap exec web1 uptime
+  leap exec --tag web --parallel 20 --timeout 30s 'systemctl is-active nginx'
+  leap exec --tag web --group-output --diff 'md5sum /etc/nginx/nginx.conf'
+  leap exec --tag web --output ndjson 'cat /etc/os-release' | jq .stdout
+  leap exec --tag web --sudo 'systemctl restart nginx'`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+		tag, _ := cmd.Flags().GetString("tag")
+		if all || tag != "" {
+			return cobra.MinimumNArgs(1)(cmd, args)
+		}
+		return cobra.MinimumNArgs(2)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		cfg, err := config.LoadConfig(GetPassphrase())
 
@@ -24,6 +65,28 @@ var execCmd = &cobra.Command{
 
 		all, _ := cmd.Flags().GetBool("all")
 		tag, _ := cmd.Flags().GetString("tag")
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		byHost, _ := cmd.Flags().GetBool("by-host")
+		output, _ := cmd.Flags().GetString("output")
+		group, _ := cmd.Flags().GetBool("group-output")
+		diff, _ := cmd.Flags().GetBool("diff")
+		sudo, _ := cmd.Flags().GetBool("sudo")
+
+		if output != "text" && output != "json" && output != "ndjson" {
+			fmt.Printf("\n❌ Unknown output format '%s' (use text, json or ndjson)\n\n", output)
+			os.Exit(2)
+		}
+
+		if diff && !group {
+			fmt.Print("\n❌ --diff needs --group-output\n\n")
+			os.Exit(2)
+		}
+
+		if group && output != "text" {
+			fmt.Print("\n❌ --group-output only applies to text output\n\n")
+			os.Exit(2)
+		}
 
 		var connsToExec []config.Connection
 		var command string
@@ -61,58 +124,266 @@ var execCmd = &cobra.Command{
 			return
 		}
 
+		sort.Slice(connsToExec, func(i, j int) bool { return connsToExec[i].Name < connsToExec[j].Name })
+
+		opts := fleet.Options{
+			Parallel: parallel,
+			Timeout:  timeout,
+			Sudo:     sudo,
+			Dial: ssh.DialOptions{
+				Config:      cfg,
+				Timeout:     10 * time.Second,
+				Interactive: output == "text",
+			},
+		}
+
+		if timeout > 0 && timeout < opts.Dial.Timeout {
+			opts.Dial.Timeout = timeout
+		}
+
+		if output != "text" {
+			os.Exit(executeStructured(connsToExec, command, opts, output))
+		}
+
 		fmt.Println("\n⚡ \033[1;32mRemote Command Execution\033[0m")
 		fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
-		fmt.Printf("\n\033[90mCommand:\033[0m \033[1;35m%s\033[0m\n\n", command)
+		fmt.Printf("\n\033[90mCommand:\033[0m \033[1;35m%s\033[0m", command)
+		if sudo {
+			fmt.Print(" \033[90m(as root via sudo)\033[0m")
+		}
+		fmt.Println()
 
-		for _, conn := range connsToExec {
-			executeRemoteCommand(conn, command)
+		if len(connsToExec) == 1 && !group {
+			os.Exit(executeRemoteCommand(connsToExec[0], command, opts))
 		}
 
-		fmt.Println("\n\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n")
+		if parallel <= 0 {
+			parallel = fleet.DefaultParallel
+		}
+		fmt.Printf("\033[90mServers:\033[0m %d \033[90m(%d at a time)\033[0m\n\n", len(connsToExec), min(parallel, len(connsToExec)))
+
+		var results []fleet.Result
+		if group {
+			results = executeGrouped(connsToExec, command, opts, diff)
+		} else {
+			results = executeOnFleet(connsToExec, command, opts, byHost)
+		}
+
+		fmt.Println("\n\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+
+		if failed := printExecSummary(results); failed > 0 {
+			fmt.Printf("\n❌ Failed on %d of %d server(s)\n\n", failed, len(results))
+			os.Exit(1)
+		}
+
+		fmt.Printf("\n\033[32m✓\033[0m Succeeded on all %d servers\n\n", len(results))
 	},
 }
 
-func executeRemoteCommand(conn config.Connection, command string) {
-	fmt.Printf("\033[1;36m%s\033[0m (\033[33m%s\033[0m@\033[32m%s\033[0m)\n", conn.Name, conn.User, conn.Host)
+// executeRemoteCommand streams a single server's output unprefixed and
+// returns the exit status to leave with.
+func executeRemoteCommand(conn config.Connection, command string, opts fleet.Options) int {
+	fmt.Printf("\n\033[1;36m%s\033[0m (\033[33m%s\033[0m@\033[32m%s\033[0m)\n", conn.Name, conn.User, conn.Host)
+
+	opts.Output = func(config.Connection) (io.Writer, io.Writer) {
+		return os.Stdout, os.Stderr
+	}
+
+	res := fleet.Exec([]config.Connection{conn}, command, opts)[0]
+
+	if res.Err != nil {
+		fmt.Printf("\033[31m✗\033[0m Command failed: %v\n\n", res.Err)
+		if res.ExitCode > 0 {
+			return res.ExitCode
+		}
+		return 1
+	}
+
+	fmt.Print("\033[32m✓\033[0m Command completed successfully\n\n")
+	return 0
+}
+
+// executeOnFleet runs command everywhere, printing output as prefixed lines
+// or, with byHost, as one block per server once it finishes.
+func executeOnFleet(conns []config.Connection, command string, opts fleet.Options, byHost bool) []fleet.Result {
+	width := 0
+	colors := map[string]string{}
+	for i, conn := range conns {
+		width = max(width, len(conn.Name))
+		colors[conn.Name] = fleet.PrefixColor(i)
+	}
+
+	var outMu, writersMu sync.Mutex
+	writers := map[string][]*fleet.LineWriter{}
+
+	if !byHost {
+		opts.Output = func(conn config.Connection) (io.Writer, io.Writer) {
+			stdout := fleet.NewLineWriter(os.Stdout, &outMu, conn.Name, width, colors[conn.Name])
+			stderr := fleet.NewLineWriter(os.Stderr, &outMu, conn.Name, width, colors[conn.Name])
+
+			writersMu.Lock()
+			writers[conn.Name] = []*fleet.LineWriter{stdout, stderr}
+			writersMu.Unlock()
+
+			return stdout, stderr
+		}
+	}
+
+	opts.Done = func(res fleet.Result) {
+		if !byHost {
+			writersMu.Lock()
+			for _, w := range writers[res.Conn.Name] {
+				w.Flush()
+			}
+			writersMu.Unlock()
+
+			if res.Err != nil {
+				outMu.Lock()
+				fmt.Printf("\033[%sm%-*s\033[0m \033[90m│\033[0m \033[31m✗ %v\033[0m\n", colors[res.Conn.Name], width, res.Conn.Name, res.Err)
+				outMu.Unlock()
+			}
+			return
+		}
 
-	sshArgs := []string{}
+		outMu.Lock()
+		defer outMu.Unlock()
 
-	if conn.IdentityFile != "" {
-		sshArgs = append(sshArgs, "-i", conn.IdentityFile)
+		status := "\033[32m✓\033[0m"
+		if res.Err != nil {
+			status = fmt.Sprintf("\033[31m✗ %v\033[0m", res.Err)
+		}
+		fmt.Printf("\033[1;%sm%s\033[0m \033[90m(%s)\033[0m %s\n", colors[res.Conn.Name], res.Conn.Name, res.Duration().Round(time.Millisecond), status)
+		os.Stdout.Write(res.Stdout)
+		os.Stderr.Write(res.Stderr)
+		if n := len(res.Stdout); n > 0 && res.Stdout[n-1] != '\n' {
+			fmt.Println()
+		}
+		fmt.Println()
 	}
 
-	sshArgs = append(sshArgs, "-p", fmt.Sprintf("%d", conn.Port))
+	return fleet.Exec(conns, command, opts)
+}
 
-	if conn.JumpHost != "" {
-		sshArgs = append(sshArgs, "-J", conn.JumpHost)
+// executeGrouped runs command everywhere quietly, then prints each distinct
+// stdout once with the servers that produced it, dshbak style.
+func executeGrouped(conns []config.Connection, command string, opts fleet.Options, diff bool) []fleet.Result {
+	opts.Done = func(res fleet.Result) {
+		if res.ExitCode < 0 {
+			fmt.Printf("\033[1;36m%s\033[0m \033[31m✗ %v\033[0m\n", res.Conn.Name, res.Err)
+		}
 	}
 
-	sshArgs = append(sshArgs,
-		"-o", "ConnectTimeout=10",
-		"-o", "StrictHostKeyChecking=no",
-		fmt.Sprintf("%s@%s", conn.User, conn.Host),
-		command,
-	)
+	results := fleet.Exec(conns, command, opts)
+	groups := fleet.GroupOutput(results)
 
-	sshCmd := exec.Command("ssh", sshArgs...)
-	sshCmd.Stdout = os.Stdout
-	sshCmd.Stderr = os.Stderr
+	for i, g := range groups {
+		color := "32"
+		if i > 0 {
+			color = "33"
+		}
+
+		fmt.Printf("\n\033[1;%sm● %d server(s)\033[0m \033[90m%s\033[0m\n", color, len(g.Results), strings.Join(g.Names(), ", "))
+		fmt.Println("\033[90m────────────────────────────────────────\033[0m")
+
+		if len(g.Stdout) == 0 {
+			fmt.Println("  \033[90m(no output)\033[0m")
+			continue
+		}
 
-	err := sshCmd.Run()
+		if diff && i > 0 {
+			fmt.Printf("  \033[90mcompared with the %d server(s) above:\033[0m\n", len(groups[0].Results))
+			printLineDiff(string(groups[0].Stdout), string(g.Stdout), func(line string) string { return line })
+			continue
+		}
 
-	if err != nil {
-		fmt.Printf("\033[31m✗\033[0m Command failed: %v\n", err)
-	} else {
-		fmt.Printf("\033[32m✓\033[0m Command completed successfully\n")
+		for _, line := range strings.Split(strings.TrimRight(string(g.Stdout), "\n"), "\n") {
+			fmt.Printf("  %s\n", line)
+		}
 	}
 
+	if len(groups) > 1 {
+		fmt.Printf("\n\033[33m⚠\033[0m  %d different outputs\n", len(groups))
+	}
+
+	return results
+}
+
+// executeStructured prints results as JSON and returns the exit status: the
+// remote one for a single server, otherwise 1 if any server failed.
+func executeStructured(conns []config.Connection, command string, opts fleet.Options, output string) int {
+	enc := json.NewEncoder(os.Stdout)
+
+	if output == "ndjson" {
+		opts.Done = func(res fleet.Result) {
+			enc.Encode(res.Record())
+		}
+	}
+
+	results := fleet.Exec(conns, command, opts)
+
+	if output == "json" {
+		records := make([]fleet.Record, 0, len(results))
+		for _, res := range results {
+			records = append(records, res.Record())
+		}
+		enc.SetIndent("", "  ")
+		enc.Encode(records)
+	}
+
+	status := 0
+	for _, res := range results {
+		if res.Err == nil {
+			continue
+		}
+		if len(results) == 1 && res.ExitCode > 0 {
+			return res.ExitCode
+		}
+		status = 1
+	}
+
+	return status
+}
+
+// printExecSummary prints one row per server and returns how many failed.
+func printExecSummary(results []fleet.Result) int {
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+
 	fmt.Println()
+	fmt.Fprintln(w, "  \033[1;36mSERVER\033[0m\t\033[1;36mSTATUS\033[0m\t\033[1;36mEXIT\033[0m\t\033[1;36mDURATION\033[0m\t\033[1;36mERROR\033[0m")
+
+	for _, res := range results {
+		status := "\033[32m✓ ok\033[0m"
+		errText := "\033[90m-\033[0m"
+		if res.Err != nil {
+			failed++
+			status = "\033[31m✗ failed\033[0m"
+			errText = "\033[31m" + res.Err.Error() + "\033[0m"
+		}
+
+		exit := "-"
+		if res.ExitCode >= 0 {
+			exit = fmt.Sprintf("%d", res.ExitCode)
+		}
+
+		fmt.Fprintf(w, "  \033[1m%s\033[0m\t%s\t%s\t%s\t%s\n", res.Conn.Name, status, exit, res.Duration().Round(time.Millisecond), errText)
+	}
+
+	w.Flush()
+
+	return failed
 }
 
 func init() {
 	execCmd.Flags().BoolP("all", "a", false, "Execute on all connections")
 	execCmd.Flags().StringP("tag", "t", "", "Execute on connections with specific tag")
+	execCmd.Flags().IntP("parallel", "p", fleet.DefaultParallel, "Number of servers to run on at once")
+	execCmd.Flags().Duration("timeout", 0, "Give up on a server after this long, e.g. 30s (0 = no limit)")
+	execCmd.Flags().Bool("by-host", false, "Print each server's output as one block instead of prefixed lines")
+	execCmd.Flags().BoolP("group-output", "g", false, "Print each distinct output once with the servers that produced it")
+	execCmd.Flags().Bool("diff", false, "With --group-output, diff each group against the largest one")
+	execCmd.Flags().StringP("output", "o", "text", "Output format: text, json or ndjson")
+	execCmd.Flags().Bool("sudo", false, "Run the command as root, answering sudo with the saved sudo or login password")
 
 	rootCmd.AddCommand(execCmd)
 }
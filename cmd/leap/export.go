@@ -89,13 +89,6 @@ var importCmd = &cobra.Command{
 			return
 		}
 
-		cfg, err := config.LoadConfig(GetPassphrase())
-
-		if err != nil {
-			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
-			return
-		}
-
 		merge, _ := cmd.Flags().GetBool("merge")
 		added := 0
 		updated := 0
@@ -104,29 +97,28 @@ var importCmd = &cobra.Command{
 		fmt.Println("\n⚡ \033[1;32mImport Connections\033[0m")
 		fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n")
 
-		for name, conn := range importedCfg.Connections {
-			if _, exists := cfg.Connections[name]; exists {
-				if merge {
-					cfg.Connections[name] = conn
-					fmt.Printf("\033[33m⟳\033[0m Updated \033[1;36m%s\033[0m\n", name)
-					updated++
+		err = config.Update(GetPassphrase(), func(cfg *config.Config) error {
+			for name, conn := range importedCfg.Connections {
+				if _, exists := cfg.Connections[name]; exists {
+					if merge {
+						cfg.Connections[name] = conn
+						fmt.Printf("\033[33m⟳\033[0m Updated \033[1;36m%s\033[0m\n", name)
+						updated++
+					} else {
+						fmt.Printf("\033[90m⊘ Skipped \033[1;36m%s\033[0m (already exists)\n", name)
+						skipped++
+					}
 				} else {
-					fmt.Printf("\033[90m⊘ Skipped \033[1;36m%s\033[0m (already exists)\n", name)
-					skipped++
+					cfg.Connections[name] = conn
+					fmt.Printf("\033[32m✓\033[0m Added \033[1;36m%s\033[0m\n", name)
+					added++
 				}
-			} else {
-				cfg.Connections[name] = conn
-				fmt.Printf("\033[32m✓\033[0m Added \033[1;36m%s\033[0m\n", name)
-				added++
-			}
-		}
-
-		if added > 0 || updated > 0 {
-			err = config.SaveConfig(cfg, GetPassphrase())
-			if err != nil {
-				fmt.Printf("\n❌ Error saving config: %v\n\n", err)
-				return
 			}
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("\n❌ Error saving config: %v\n\n", err)
+			return
 		}
 
 		fmt.Println("\n\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
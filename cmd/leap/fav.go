@@ -14,14 +14,11 @@ var favCmd = &cobra.Command{
 	Args:    cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		name := args[0]
-		cfg, err := config.LoadConfig(GetPassphrase())
-		if err != nil {
-			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
-			return
-		}
-
-		isFav := cfg.ToggleFavorite(name)
-		err = config.SaveConfig(cfg, GetPassphrase())
+		var isFav bool
+		err := config.Update(GetPassphrase(), func(cfg *config.Config) error {
+			isFav = cfg.ToggleFavorite(name)
+			return nil
+		})
 		if err != nil {
 			fmt.Printf("\n❌ Error saving config: %v\n\n", err)
 			return
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/paramientos/leap/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var groupCmd = &cobra.Command{
+	Use:   "group",
+	Short: "Manage group defaults inherited by connections",
+	Long: `Manage group defaults. A connection whose group is "prod/eu/db" inherits
+User, Port, IdentityFile, JumpHost and tunnels from "prod/eu/db", then
+"prod/eu", then "prod", unless it sets them itself. Tags from every level are
+merged into the connection's own tags.`,
+}
+
+var groupListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List groups and their defaults",
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		members := make(map[string]int)
+		for _, conn := range cfg.Connections {
+			for _, path := range config.GroupChain(conn.Group) {
+				members[path]++
+			}
+		}
+
+		paths := make([]string, 0, len(cfg.Groups))
+		for path := range cfg.Groups {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		fmt.Println("\n⚡ \033[1;32mGroups\033[0m")
+		fmt.Print("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n")
+
+		if len(paths) == 0 {
+			fmt.Print("\n  No group defaults yet. Use 'leap group set [path] --user ...' to add some.\n\n")
+			return
+		}
+
+		for _, path := range paths {
+			g := cfg.Groups[path]
+			depth := strings.Count(path, "/")
+			label := path[strings.LastIndex(path, "/")+1:]
+
+			fmt.Printf("\n%s\033[1;33m📁 %s\033[0m \033[90m(%s, %d connection(s))\033[0m\n", strings.Repeat("  ", depth), label, path, members[path])
+
+			for _, line := range groupDefaults(g) {
+				fmt.Printf("%s   %s\n", strings.Repeat("  ", depth), line)
+			}
+		}
+
+		fmt.Println()
+	},
+}
+
+var groupSetCmd = &cobra.Command{
+	Use:   "set [path]",
+	Short: "Set defaults for a group such as prod/eu",
+	Long: `Set defaults for a group. Only the flags you pass are changed; pass an empty
+value (e.g. --user "") to clear a default.`,
+	Example: `  leap group set prod --user deploy --identity-file ~/.ssh/prod --jump-host bastion
+  leap group set prod/eu --tags eu,gdpr --port 2222
+  leap group set prod/eu/db --tunnel 5432:5432`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := config.NormalizeGroupPath(args[0])
+		if path == "" {
+			fmt.Print("\n❌ Invalid group path\n\n")
+			return
+		}
+
+		flags := cmd.Flags()
+
+		err := config.Update(GetPassphrase(), func(cfg *config.Config) error {
+			g := cfg.Groups[path]
+
+			if flags.Changed("user") {
+				g.User, _ = flags.GetString("user")
+			}
+			if flags.Changed("port") {
+				g.Port, _ = flags.GetInt("port")
+			}
+			if flags.Changed("identity-file") {
+				g.IdentityFile, _ = flags.GetString("identity-file")
+			}
+			if flags.Changed("jump-host") {
+				g.JumpHost, _ = flags.GetString("jump-host")
+			}
+			if flags.Changed("tags") {
+				g.Tags = nil
+				tags, _ := flags.GetStringSlice("tags")
+				for _, tag := range tags {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						g.Tags = append(g.Tags, tag)
+					}
+				}
+			}
+			if flags.Changed("tunnel") {
+				specs, _ := flags.GetStringSlice("tunnel")
+				tunnels, err := parseTunnelSpecs(specs)
+				if err != nil {
+					return err
+				}
+				g.Tunnels = tunnels
+			}
+
+			cfg.SetGroup(path, g)
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("\n❌ Error saving group: %v\n\n", err)
+			return
+		}
+
+		fmt.Printf("\n\033[32m✓\033[0m Group \033[1;33m%s\033[0m updated\n\n", path)
+	},
+}
+
+var groupDeleteCmd = &cobra.Command{
+	Use:     "delete [path]",
+	Aliases: []string{"rm"},
+	Short:   "Remove the defaults of a group",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := config.NormalizeGroupPath(args[0])
+		keep, _ := cmd.Flags().GetBool("keep-values")
+
+		err := config.Update(GetPassphrase(), func(cfg *config.Config) error {
+			if !cfg.DeleteGroup(path, keep) {
+				return fmt.Errorf("group '%s' has no defaults", path)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		fmt.Printf("\n\033[32m✓\033[0m Defaults of group \033[1;33m%s\033[0m removed\n", path)
+		if keep {
+			fmt.Println("\033[90mMember connections kept the values they inherited.\033[0m")
+		}
+		fmt.Println()
+	},
+}
+
+func groupDefaults(g config.Group) []string {
+	var lines []string
+	add := func(label, value string) {
+		lines = append(lines, fmt.Sprintf("\033[1m%-15s\033[0m %s", label, value))
+	}
+
+	if g.User != "" {
+		add("User:", g.User)
+	}
+	if g.Port != 0 {
+		add("Port:", strconv.Itoa(g.Port))
+	}
+	if g.IdentityFile != "" {
+		add("Identity File:", g.IdentityFile)
+	}
+	if g.JumpHost != "" {
+		add("Jump Host:", g.JumpHost)
+	}
+	if len(g.Tags) > 0 {
+		add("Tags:", strings.Join(g.Tags, ", "))
+	}
+	if len(g.Tunnels) > 0 {
+		var specs []string
+		for _, t := range g.Tunnels {
+			specs = append(specs, t.String())
+		}
+		add("Tunnels:", strings.Join(specs, ", "))
+	}
+
+	return lines
+}
+
+// parseTunnelSpecs parses tunnel specs, skipping empty ones.
+func parseTunnelSpecs(specs []string) ([]config.Tunnel, error) {
+	var tunnels []config.Tunnel
+
+	for _, spec := range specs {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+
+		t, err := config.ParseTunnel(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		tunnels = append(tunnels, t)
+	}
+
+	return tunnels, nil
+}
+
+func init() {
+	groupSetCmd.Flags().StringP("user", "u", "", "Default user")
+	groupSetCmd.Flags().IntP("port", "p", 0, "Default port (0 clears it)")
+	groupSetCmd.Flags().StringP("identity-file", "i", "", "Default identity file")
+	groupSetCmd.Flags().StringP("jump-host", "j", "", "Default jump host(s)")
+	groupSetCmd.Flags().StringSlice("tags", nil, "Tags added to every connection in the group")
+	groupSetCmd.Flags().StringSlice("tunnel", nil, "Default tunnels as [BIND:]LOCAL:HOST:REMOTE, R:[BIND:]REMOTE:HOST:LOCAL or D:[BIND:]LOCAL")
+	groupDeleteCmd.Flags().Bool("keep-values", false, "Copy the inherited values into the member connections")
+
+	groupCmd.AddCommand(groupListCmd)
+	groupCmd.AddCommand(groupSetCmd)
+	groupCmd.AddCommand(groupDeleteCmd)
+
+	rootCmd.AddCommand(groupCmd)
+}
@@ -7,6 +7,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/paramientos/leap/internal/config"
 	"github.com/spf13/cobra"
 )
 
@@ -14,8 +15,7 @@ var historyCmd = &cobra.Command{
 	Use:   "history",
 	Short: "List and play recorded SSH sessions",
 	Run: func(cmd *cobra.Command, args []string) {
-		home, _ := os.UserHomeDir()
-		historyDir := filepath.Join(home, ".leap", "history")
+		historyDir := config.GetHistoryDir()
 
 		if _, err := os.Stat(historyDir); os.IsNotExist(err) {
 			fmt.Println("\n📜 No history found. Record a session with \033[1m'leap connect [name] --record'\033[0m")
@@ -65,8 +65,7 @@ var replayCmd = &cobra.Command{
 			name += ".cast"
 		}
 
-		home, _ := os.UserHomeDir()
-		path := filepath.Join(home, ".leap", "history", name)
+		path := filepath.Join(config.GetHistoryDir(), name)
 
 		data, err := os.ReadFile(path)
 		if err != nil {
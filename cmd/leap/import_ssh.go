@@ -31,18 +31,12 @@ var importSSHCmd = &cobra.Command{
 		}
 		defer file.Close()
 
-		cfg, err := config.LoadConfig(GetPassphrase())
-		if err != nil {
-			fmt.Printf("\n❌ Error loading LEAP config: %v\n\n", err)
-			return
-		}
-
 		fmt.Println("\n⚡ \033[1;32mImporting from SSH Config\033[0m")
 		fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n")
 
 		scanner := bufio.NewScanner(file)
 		var currentConn *config.Connection
-		added := 0
+		var imported []config.Connection
 
 		for scanner.Scan() {
 			line := strings.TrimSpace(scanner.Text())
@@ -60,9 +54,8 @@ var importSSHCmd = &cobra.Command{
 
 			if key == "host" {
 				if currentConn != nil && currentConn.Name != "*" {
-					cfg.Connections[currentConn.Name] = *currentConn
+					imported = append(imported, *currentConn)
 					fmt.Printf("\033[32m✓\033[0m Added \033[1;36m%s\033[0m (%s)\n", currentConn.Name, currentConn.Host)
-					added++
 				}
 				currentConn = &config.Connection{
 					Name: value,
@@ -87,13 +80,19 @@ var importSSHCmd = &cobra.Command{
 		}
 
 		if currentConn != nil && currentConn.Name != "*" {
-			cfg.Connections[currentConn.Name] = *currentConn
+			imported = append(imported, *currentConn)
 			fmt.Printf("\033[32m✓\033[0m Added \033[1;36m%s\033[0m (%s)\n", currentConn.Name, currentConn.Host)
-			added++
 		}
 
+		added := len(imported)
+
 		if added > 0 {
-			err = config.SaveConfig(cfg, GetPassphrase())
+			err = config.Update(GetPassphrase(), func(cfg *config.Config) error {
+				for _, conn := range imported {
+					cfg.Connections[conn.Name] = conn
+				}
+				return nil
+			})
 			if err != nil {
 				fmt.Printf("\n❌ Error saving config: %v\n\n", err)
 				return
@@ -35,24 +35,55 @@ var infoCmd = &cobra.Command{
 		}
 		fmt.Println()
 
+		origins := cfg.Origins(name)
+
 		fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Host:", conn.Host)
-		fmt.Printf("  \033[1m%-15s\033[0m %s\n", "User:", conn.User)
-		fmt.Printf("  \033[1m%-15s\033[0m %d\n", "Port:", conn.Port)
+
+		if conn.Group != "" {
+			fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Group:", conn.Group)
+		}
+
+		fmt.Printf("  \033[1m%-15s\033[0m %s%s\n", "User:", conn.User, originLabel(origins["User"]))
+		fmt.Printf("  \033[1m%-15s\033[0m %d%s\n", "Port:", conn.Port, originLabel(origins["Port"]))
 
 		if conn.IdentityFile != "" {
-			fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Identity File:", conn.IdentityFile)
+			fmt.Printf("  \033[1m%-15s\033[0m %s%s\n", "Identity File:", conn.IdentityFile, originLabel(origins["IdentityFile"]))
+		}
+
+		if conn.CertificateFile != "" {
+			fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Certificate:", conn.CertificateFile)
+		}
+
+		if conn.PasswordCommand != "" {
+			fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Password Cmd:", conn.PasswordCommand)
+		}
+
+		if conn.KeyPassphrase != "" {
+			fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Key Passphrase:", "saved in vault")
+		}
+
+		if conn.SudoPassword != "" {
+			fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Sudo Password:", "saved in vault")
+		}
+
+		if conn.SudoPasswordCommand != "" {
+			fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Sudo Pass Cmd:", conn.SudoPasswordCommand)
+		}
+
+		if conn.TOTPSecret != "" {
+			fmt.Printf("  \033[1m%-15s\033[0m %s\n", "TOTP:", "seed saved in vault")
 		}
 
 		if len(conn.Tags) > 0 {
-			fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Tags:", strings.Join(conn.Tags, ", "))
+			fmt.Printf("  \033[1m%-15s\033[0m %s%s\n", "Tags:", strings.Join(conn.Tags, ", "), originLabel(origins["Tags"]))
 		}
 
 		if conn.JumpHost != "" {
-			fmt.Printf("  \033[1m%-15s\033[0m %s\n", "Jump Host:", conn.JumpHost)
+			fmt.Printf("  \033[1m%-15s\033[0m %s%s\n", "Jump Host:", conn.JumpHost, originLabel(origins["JumpHost"]))
 		}
 
 		if len(conn.Tunnels) > 0 {
-			fmt.Printf("  \033[1m%-15s\033[0m %d tunnels configured\n", "Tunnels:", len(conn.Tunnels))
+			fmt.Printf("  \033[1m%-15s\033[0m %s%s\n", "Tunnels:", tunnelSpecs(conn.Tunnels), originLabel(origins["Tunnels"]))
 		}
 
 		fmt.Println("\n  \033[1m--- Stats ---\033[0m")
@@ -73,6 +104,16 @@ var infoCmd = &cobra.Command{
 	},
 }
 
+// originLabel describes where an inherited value came from; values set on
+// the connection itself are not annotated.
+func originLabel(origin string) string {
+	if origin == "" || origin == config.SourceConnection {
+		return ""
+	}
+
+	return " \033[90m(" + origin + ")\033[0m"
+}
+
 func init() {
 	rootCmd.AddCommand(infoCmd)
 }
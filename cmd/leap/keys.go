@@ -0,0 +1,346 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/paramientos/leap/internal/config"
+	leapssh "github.com/paramientos/leap/internal/ssh"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "List, rotate and revoke keys in remote authorized_keys",
+}
+
+var keysListCmd = &cobra.Command{
+	Use:   "list [name]",
+	Short: "Show the keys a server accepts",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		conn, ok := cfg.Connections[name]
+		if !ok {
+			fmt.Printf("\n❌ Connection '\033[1;36m%s\033[0m' not found.\n\n", name)
+			return
+		}
+
+		client, err := leapssh.Dial(conn, leapssh.DialOptions{Config: cfg, Timeout: 15 * time.Second, Interactive: true})
+		if err != nil {
+			fmt.Printf("\n❌ Connection failed: %v\n\n", err)
+			return
+		}
+		defer client.Close()
+
+		keys, err := leapssh.ListAuthorizedKeys(client)
+		if err != nil {
+			fmt.Printf("\n❌ Failed to read authorized_keys: %v\n\n", err)
+			return
+		}
+
+		var own ssh.PublicKey
+		if conn.IdentityFile != "" {
+			own, _ = leapssh.ReadPublicKey(conn.IdentityFile)
+		}
+
+		fmt.Printf("\n⚡ \033[1;32mAuthorized Keys\033[0m \033[90m(%s@%s)\033[0m\n", conn.User, conn.Host)
+		fmt.Print("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n\n")
+
+		if len(keys) == 0 {
+			fmt.Print("\033[90mNo keys installed\033[0m\n\n")
+			return
+		}
+
+		for _, k := range keys {
+			marker := ""
+			if own != nil && leapssh.SameKey(own, k.Key) {
+				marker = " \033[32m(this connection's key)\033[0m"
+			}
+			fmt.Printf("  %s \033[90m%-12s\033[0m %s%s\n", ssh.FingerprintSHA256(k.Key), k.Key.Type(), k.Comment, marker)
+		}
+		fmt.Println()
+	},
+}
+
+var keysRotateCmd = &cobra.Command{
+	Use:   "rotate [name...]",
+	Short: "Replace the key of connections with a freshly generated one",
+	Long: `Generate a new ed25519 key and, for every selected connection:
+install it, verify that it can log in on its own, remove the old key from
+authorized_keys and point the connection's IdentityFile at the new key.
+
+Connections where any step fails keep their old key.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+		tag, _ := cmd.Flags().GetString("tag")
+
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		targets, err := selectConnections(cfg, args, tag, all)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		newPath := filepath.Join(config.GetBaseDir(), "id_ed25519_"+time.Now().Format("20060102150405"))
+		newPub, err := leapssh.GenerateKey(newPath, leapKeyComment)
+		if err != nil {
+			fmt.Printf("\n❌ Failed to generate SSH key: %v\n\n", err)
+			return
+		}
+
+		fmt.Println("\n⚡ \033[1;32mRotate Keys\033[0m")
+		fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+		fmt.Printf("\033[90mNew key: %s (%s)\033[0m\n\n", newPath, ssh.FingerprintSHA256(newPub))
+
+		var rotated []string
+		for _, conn := range targets {
+			if err := rotateKey(cfg, conn, newPath, newPub); err != nil {
+				fmt.Printf("\033[31m✗\033[0m \033[1;36m%s\033[0m: %v\n", conn.Name, err)
+				continue
+			}
+			rotated = append(rotated, conn.Name)
+
+			// Later targets may jump through this one
+			cfg.Connections[conn.Name] = withIdentity(conn, newPath)
+		}
+
+		if len(rotated) == 0 {
+			os.Remove(newPath)
+			os.Remove(newPath + ".pub")
+			fmt.Print("\n❌ No connection was rotated\n\n")
+			return
+		}
+
+		err = config.Update(GetPassphrase(), func(cfg *config.Config) error {
+			for _, name := range rotated {
+				if conn, ok := cfg.Connections[name]; ok {
+					cfg.Connections[name] = withIdentity(conn, newPath)
+				}
+			}
+			return nil
+		})
+
+		if err != nil {
+			fmt.Printf("\n❌ Keys rotated but failed to update config: %v\n", err)
+			fmt.Printf("\033[90mSet IdentityFile to %s for: %s\033[0m\n\n", newPath, strings.Join(rotated, ", "))
+			return
+		}
+
+		fmt.Println("\n\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+		fmt.Printf("\n\033[32m✓\033[0m Rotated %d of %d connection(s). Old key files were left on disk.\n\n", len(rotated), len(targets))
+	},
+}
+
+// rotateKey installs newPub using conn's current auth, proves the new key
+// logs in without help from the agent or a password, and only then removes
+// the old key through that new session.
+func rotateKey(cfg *config.Config, conn config.Connection, newPath string, newPub ssh.PublicKey) error {
+	var oldPub ssh.PublicKey
+	if conn.IdentityFile != "" {
+		pub, err := leapssh.ReadPublicKey(conn.IdentityFile)
+		if err != nil {
+			return err
+		}
+		oldPub = pub
+	}
+
+	client, err := leapssh.Dial(conn, leapssh.DialOptions{Config: cfg, Timeout: 15 * time.Second, Interactive: true})
+	if err != nil {
+		return err
+	}
+
+	_, err = leapssh.AddAuthorizedKey(client, newPub, leapKeyComment)
+	client.Close()
+	if err != nil {
+		return fmt.Errorf("installing new key: %v", err)
+	}
+
+	verify := withIdentity(conn, newPath)
+	verify.Password = ""
+	verify.PasswordCommand = ""
+
+	client, err = leapssh.Dial(verify, leapssh.DialOptions{Config: cfg, Timeout: 15 * time.Second, IdentitiesOnly: true})
+	if err != nil {
+		return fmt.Errorf("new key was installed but cannot log in, old key kept: %v", err)
+	}
+	defer client.Close()
+
+	removed := 0
+	if oldPub != nil && !leapssh.SameKey(oldPub, newPub) {
+		removed, err = leapssh.RemoveAuthorizedKeys(client, func(k ssh.PublicKey) bool {
+			return leapssh.SameKey(k, oldPub)
+		})
+		if err != nil {
+			return fmt.Errorf("new key works but removing the old one failed: %v", err)
+		}
+	}
+
+	if removed > 0 {
+		fmt.Printf("\033[32m✓\033[0m \033[1;36m%s\033[0m: new key verified, old key removed\n", conn.Name)
+	} else {
+		fmt.Printf("\033[32m✓\033[0m \033[1;36m%s\033[0m: new key verified\n", conn.Name)
+	}
+
+	return nil
+}
+
+// withIdentity points conn at a new key, dropping what belonged to the old one.
+func withIdentity(conn config.Connection, identityFile string) config.Connection {
+	conn.IdentityFile = identityFile
+	conn.CertificateFile = ""
+	conn.KeyPassphrase = ""
+	return conn
+}
+
+var keysRevokeCmd = &cobra.Command{
+	Use:   "revoke [key.pub|SHA256:fingerprint] [name...]",
+	Short: "Remove a key from authorized_keys on servers",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+		tag, _ := cmd.Flags().GetString("tag")
+		force, _ := cmd.Flags().GetBool("force")
+
+		fingerprint, err := resolveFingerprint(args[0])
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		targets, err := selectConnections(cfg, args[1:], tag, all)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		fmt.Println("\n⚡ \033[1;32mRevoke Key\033[0m")
+		fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+		fmt.Printf("\033[90mKey: %s\033[0m\n\n", fingerprint)
+
+		for _, conn := range targets {
+			if conn.IdentityFile != "" && !force {
+				if own, err := leapssh.ReadPublicKey(conn.IdentityFile); err == nil && ssh.FingerprintSHA256(own) == fingerprint {
+					fmt.Printf("\033[33m⊘\033[0m \033[1;36m%s\033[0m: skipped, this connection logs in with that key (use --force)\n", conn.Name)
+					continue
+				}
+			}
+
+			client, err := leapssh.Dial(conn, leapssh.DialOptions{Config: cfg, Timeout: 15 * time.Second, Interactive: true})
+			if err != nil {
+				fmt.Printf("\033[31m✗\033[0m \033[1;36m%s\033[0m: %v\n", conn.Name, err)
+				continue
+			}
+
+			removed, err := leapssh.RemoveAuthorizedKeys(client, func(k ssh.PublicKey) bool {
+				return ssh.FingerprintSHA256(k) == fingerprint
+			})
+			client.Close()
+
+			switch {
+			case err != nil:
+				fmt.Printf("\033[31m✗\033[0m \033[1;36m%s\033[0m: %v\n", conn.Name, err)
+			case removed == 0:
+				fmt.Printf("\033[90m·\033[0m \033[1;36m%s\033[0m: not installed\n", conn.Name)
+			default:
+				fmt.Printf("\033[32m✓\033[0m \033[1;36m%s\033[0m: removed\n", conn.Name)
+			}
+		}
+		fmt.Println()
+	},
+}
+
+// resolveFingerprint accepts a SHA256 fingerprint as printed by ssh-keygen -l
+// or a public key file.
+func resolveFingerprint(arg string) (string, error) {
+	if strings.HasPrefix(arg, "SHA256:") {
+		return arg, nil
+	}
+
+	data, err := os.ReadFile(arg)
+	if err != nil {
+		return "", err
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", arg, err)
+	}
+
+	return ssh.FingerprintSHA256(pub), nil
+}
+
+// selectConnections picks connections by name, tag or all of them, sorted
+// by name so fleet operations run in a predictable order.
+func selectConnections(cfg *config.Config, names []string, tag string, all bool) ([]config.Connection, error) {
+	var targets []config.Connection
+
+	switch {
+	case all:
+		for _, conn := range cfg.Connections {
+			targets = append(targets, conn)
+		}
+	case tag != "":
+		for _, conn := range cfg.Connections {
+			for _, t := range conn.Tags {
+				if t == tag {
+					targets = append(targets, conn)
+					break
+				}
+			}
+		}
+	default:
+		for _, name := range names {
+			conn, ok := cfg.Connections[name]
+			if !ok {
+				return nil, fmt.Errorf("connection '%s' not found", name)
+			}
+			targets = append(targets, conn)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no connections selected; name them or use --tag / --all")
+	}
+
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+
+	return targets, nil
+}
+
+func init() {
+	keysRotateCmd.Flags().BoolP("all", "a", false, "Rotate all connections")
+	keysRotateCmd.Flags().StringP("tag", "t", "", "Rotate connections with specific tag")
+
+	keysRevokeCmd.Flags().BoolP("all", "a", false, "Revoke on all connections")
+	keysRevokeCmd.Flags().StringP("tag", "t", "", "Revoke on connections with specific tag")
+	keysRevokeCmd.Flags().Bool("force", false, "Also revoke on connections that log in with this key")
+
+	keysCmd.AddCommand(keysListCmd)
+	keysCmd.AddCommand(keysRotateCmd)
+	keysCmd.AddCommand(keysRevokeCmd)
+	rootCmd.AddCommand(keysCmd)
+}
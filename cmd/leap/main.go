@@ -5,13 +5,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/manifoldco/promptui"
+	"github.com/paramientos/leap/internal/agent"
 	"github.com/paramientos/leap/internal/config"
 	"github.com/paramientos/leap/internal/ssh"
 	"github.com/paramientos/leap/internal/tui"
-	"github.com/paramientos/leap/internal/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -34,6 +33,27 @@ Features:
   • 🚇 SSH tunnel management
 `,
 	Args: cobra.ArbitraryArgs,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if profile, _ := cmd.Flags().GetString("profile"); profile != "" {
+			config.SetProfile(profile)
+		}
+
+		// 'leap profile ...' manages profiles itself and must work with a missing one
+		if cmd.HasParent() && cmd.Parent() == profileCmd {
+			return
+		}
+
+		profile := config.ActiveProfile()
+		if err := config.ValidateProfileName(profile); err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			os.Exit(1)
+		}
+		if !config.ProfileExists(profile) {
+			fmt.Printf("\n❌ Profile '\033[1;36m%s\033[0m' does not exist\n", profile)
+			fmt.Printf("\033[90mTip: Create it with 'leap profile create %s'\033[0m\n\n", profile)
+			os.Exit(1)
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		cfg, err := config.LoadConfig(GetPassphrase())
 		if err != nil {
@@ -45,7 +65,7 @@ Features:
 			name := strings.Join(args, " ")
 			if conn, ok := cfg.Connections[name]; ok {
 				fmt.Printf("\n🚀 Connecting to \033[1;36m%s\033[0m...\n\n", name)
-				err := ssh.Connect(conn, false)
+				err := ssh.Connect(conn, false, cfg)
 				if err != nil {
 					fmt.Printf("\n❌ SSH Connection closed with error: %v\n\n", err)
 				}
@@ -55,7 +75,7 @@ Features:
 			for _, conn := range cfg.Connections {
 				if strings.Contains(strings.ToLower(conn.Name), strings.ToLower(name)) {
 					fmt.Printf("\n🚀 Connecting to \033[1;36m%s\033[0m...\n\n", conn.Name)
-					err := ssh.Connect(conn, false)
+					err := ssh.Connect(conn, false, cfg)
 					if err != nil {
 						fmt.Printf("\n❌ SSH Connection closed with error: %v\n\n", err)
 					}
@@ -65,7 +85,7 @@ Features:
 				for _, tag := range conn.Tags {
 					if strings.EqualFold(tag, name) {
 						fmt.Printf("\n🚀 Connecting to \033[1;36m%s\033[0m...\n\n", conn.Name)
-						err := ssh.Connect(conn, false)
+						err := ssh.Connect(conn, false, cfg)
 						if err != nil {
 							fmt.Printf("\n❌ SSH Connection closed with error: %v\n\n", err)
 						}
@@ -75,15 +95,20 @@ Features:
 			}
 		}
 
-		choice, err := tui.Run(cfg)
+		choice, action, err := tui.Run(cfg)
 
 		if err != nil {
 			fmt.Printf("\n❌ Error running TUI: %v\n\n", err)
 			return
 		}
 
+		if choice != nil && action == tui.ActionFiles {
+			openFileManager(cfg, *choice)
+			return
+		}
+
 		if choice != nil {
-			err = ssh.Connect(*choice, false)
+			err = ssh.Connect(*choice, false, cfg)
 			if err != nil {
 				fmt.Printf("\n❌ SSH Connection closed with error: %v\n\n", err)
 			}
@@ -91,48 +116,49 @@ Features:
 	},
 }
 
-var masterPassword string
+var (
+	masterPassword        string
+	masterPasswordProfile string
+)
+
+// legacySessionPath is the obfuscated password cache used before the agent.
+func legacySessionPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".leap", ".session")
+}
 
 func GetPassphrase() string {
+	// A cached password belongs to the profile it was entered for
+	if profile := config.ActiveProfile(); profile != masterPasswordProfile {
+		masterPassword = ""
+		masterPasswordProfile = profile
+	}
+
 	if masterPassword != "" {
 		return masterPassword
 	}
 
+	// Vaults encrypted to age recipients are opened with the identity file
+	if config.UsesRecipients() {
+		return ""
+	}
+
 	envPass := os.Getenv("LEAP_MASTER_PASSWORD")
 	if envPass != "" {
 		masterPassword = envPass
 		return masterPassword
 	}
 
-	home, _ := os.UserHomeDir()
-	sessionFile := filepath.Join(home, ".leap", ".session")
-	hostname, _ := os.Hostname()
-	salt := hostname + home // Unique to this machine and user
-
-	// Check for active session (5 minute cache)
-	if info, err := os.Stat(sessionFile); err == nil {
-		if time.Since(info.ModTime()) < 5*time.Minute {
-			data, err := os.ReadFile(sessionFile)
-			if err == nil {
-				decrypted, err := utils.Deobfuscate(data, salt)
-				if err == nil {
-					masterPassword = string(decrypted)
-					// Refresh the session timeout on each use
-					os.Chtimes(sessionFile, time.Now(), time.Now())
-					return masterPassword
-				} else {
-					// File exists but is not valid obfuscated data (maybe old plaintext)
-					// Delete it to be safe
-					os.Remove(sessionFile)
-				}
-			}
-		} else {
-			// Session expired
-			os.Remove(sessionFile)
-		}
-	}
+	// The password no longer touches the disk; drop any cache left by older versions
+	os.Remove(legacySessionPath())
 
 	path := config.GetConfigPath()
+
+	if cached, err := agent.Get(path); err == nil {
+		masterPassword = cached
+		return masterPassword
+	}
+
 	isFirstRun := false
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		isFirstRun = true
@@ -176,12 +202,15 @@ func GetPassphrase() string {
 			os.Exit(1)
 		}
 		masterPassword = res
+
+		// Only hand verified passwords to the agent
+		if _, err := config.LoadConfig(masterPassword); err != nil {
+			return masterPassword
+		}
 	}
 
-	// Save to session cache (600 permissions - user only)
-	encrypted, err := utils.Obfuscate([]byte(masterPassword), salt)
-	if err == nil {
-		os.WriteFile(sessionFile, encrypted, 0600)
+	if err := cacheInAgent(masterPassword, agent.DefaultIdleTimeout); err != nil {
+		fmt.Printf("\033[33m⚠\033[0m  Could not cache password in agent: %v\n", err)
 	}
 
 	return masterPassword
@@ -193,7 +222,25 @@ func main() {
 	}
 }
 
+// saveKeyPassphrase stores a key passphrase the user chose to remember while
+// unlocking an identity file during a native connection.
+func saveKeyPassphrase(name, passphrase string) error {
+	return config.Update(GetPassphrase(), func(cfg *config.Config) error {
+		conn, ok := cfg.Connections[name]
+		if !ok {
+			return fmt.Errorf("connection '%s' not found", name)
+		}
+
+		conn.KeyPassphrase = passphrase
+		cfg.Connections[name] = conn
+		return nil
+	})
+}
+
 func init() {
 	rootCmd.Version = Version
 	rootCmd.SetVersionTemplate("⚡ LEAP SSH Manager v{{.Version}}\n")
+	rootCmd.PersistentFlags().String("profile", "", "Profile (vault) to use, overrides LEAP_PROFILE")
+
+	ssh.SaveKeyPassphrase = saveKeyPassphrase
 }
@@ -58,7 +58,7 @@ var monitorCmd = &cobra.Command{
 			return
 		}
 
-		err = tui.RunMonitor(connsToMonitor)
+		err = tui.RunMonitor(cfg, connsToMonitor)
 
 		if err != nil {
 			fmt.Printf("\n❌ Error running monitor: %v\n\n", err)
@@ -45,8 +45,12 @@ var notesCmd = &cobra.Command{
 				return
 			}
 
-			cfg.SetNotes(name, notes)
-			err = config.SaveConfig(cfg, GetPassphrase())
+			err = config.Update(GetPassphrase(), func(cfg *config.Config) error {
+				if !cfg.SetNotes(name, notes) {
+					return fmt.Errorf("connection '%s' no longer exists", name)
+				}
+				return nil
+			})
 
 			if err != nil {
 				fmt.Printf("\n❌ Error saving config: %v\n\n", err)
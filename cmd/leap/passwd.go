@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/manifoldco/promptui"
+	"github.com/paramientos/leap/internal/agent"
+	"github.com/paramientos/leap/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var passwdCmd = &cobra.Command{
+	Use:   "passwd",
+	Short: "Change the master password and re-encrypt the vault",
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := os.Stat(config.GetConfigPath()); os.IsNotExist(err) {
+			fmt.Print("\n❌ No vault found yet. Run any command to set a master password first.\n\n")
+			return
+		}
+
+		if config.UsesRecipients() {
+			fmt.Print("\n❌ The vault is encrypted to age recipients, not a master password.\n")
+			fmt.Print("\033[90mTip: Use 'leap vault recipients' to manage who can open it\033[0m\n\n")
+			return
+		}
+
+		fmt.Println("\n⚡ \033[1;32mChange Master Password\033[0m")
+		fmt.Print("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n\n")
+
+		promptOld := promptui.Prompt{
+			Label: "🔓 Current Master Password",
+			Mask:  '*',
+		}
+
+		oldPassword, err := promptOld.Run()
+		if err != nil {
+			return
+		}
+
+		if _, err := config.LoadConfig(oldPassword); err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		promptNew := promptui.Prompt{
+			Label: "🔒 New Master Password",
+			Mask:  '*',
+			Validate: func(input string) error {
+				if len(input) < 4 {
+					return fmt.Errorf("password must be at least 4 characters")
+				}
+				return nil
+			},
+		}
+
+		newPassword, err := promptNew.Run()
+		if err != nil {
+			return
+		}
+
+		promptConfirm := promptui.Prompt{
+			Label: "🔒 Confirm New Master Password",
+			Mask:  '*',
+			Validate: func(input string) error {
+				if input != newPassword {
+					return fmt.Errorf("passwords do not match")
+				}
+				return nil
+			},
+		}
+
+		if _, err := promptConfirm.Run(); err != nil {
+			return
+		}
+
+		if err := config.ChangePassphrase(oldPassword, newPassword); err != nil {
+			fmt.Printf("\n❌ Failed to re-encrypt vault: %v\n\n", err)
+			return
+		}
+
+		// The agent still holds the old password
+		if agent.Running() {
+			if err := agent.Set(config.GetConfigPath(), newPassword); err != nil {
+				agent.Lock(config.GetConfigPath())
+			}
+		}
+		masterPassword = newPassword
+
+		fmt.Println("\n\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+		fmt.Printf("\n\033[32m✓\033[0m Master password changed and vault re-encrypted.\n")
+
+		if os.Getenv("LEAP_MASTER_PASSWORD") != "" {
+			fmt.Println("\033[33m⚠\033[0m  LEAP_MASTER_PASSWORD is set in your environment. Update it to the new password.")
+		}
+
+		fmt.Println()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(passwdCmd)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/paramientos/leap/internal/agent"
+	"github.com/paramientos/leap/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage separate vaults for work, customers or personal hosts",
+	Long: `Manage profiles. Each profile has its own encrypted vault, master password,
+backups and session history.
+
+Pick a profile per command with --profile or LEAP_PROFILE, or make one the
+default with 'leap profile switch'.`,
+}
+
+var profileListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List profiles",
+	Run: func(cmd *cobra.Command, args []string) {
+		profiles, err := config.ListProfiles()
+		if err != nil {
+			fmt.Printf("\n❌ Error listing profiles: %v\n\n", err)
+			return
+		}
+
+		var unlocked []string
+		if status, err := agent.GetStatus(); err == nil {
+			unlocked = status.Unlocked
+		}
+
+		active := config.ActiveProfile()
+
+		fmt.Println("\n⚡ \033[1;32mProfiles\033[0m")
+		fmt.Print("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n\n")
+
+		for _, name := range profiles {
+			marker := "  "
+			if name == active {
+				marker = "\033[32m▶\033[0m "
+			}
+
+			dir := config.GetProfileDir(name)
+			vault := config.GetProfileConfigPath(name)
+
+			state := "\033[90mempty\033[0m"
+			if _, err := os.Stat(vault); err == nil {
+				state = "\033[33mlocked\033[0m"
+				if containsString(unlocked, vault) {
+					state = "\033[32munlocked\033[0m"
+				}
+			}
+
+			fmt.Printf("  %s\033[1;36m%-20s\033[0m %-20s \033[90m%s\033[0m\n", marker, name, state, dir)
+		}
+
+		fmt.Print("\n\033[90mTip: Use 'leap profile switch [name]' or '--profile [name]'\033[0m\n\n")
+	},
+}
+
+var profileCreateCmd = &cobra.Command{
+	Use:   "create [name]",
+	Short: "Create a profile with its own master password",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		if err := config.CreateProfile(name); err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		config.SetProfile(name)
+
+		fmt.Printf("\n✨ Creating profile \033[1;36m%s\033[0m\n", name)
+		fmt.Printf("\033[90mVault: %s\033[0m\n\n", config.GetConfigPath())
+
+		password, ok := promptNewMasterPassword()
+		if !ok {
+			config.DeleteProfile(name)
+			return
+		}
+
+		cfg := &config.Config{Connections: make(map[string]config.Connection)}
+		if err := config.SaveConfig(cfg, password); err != nil {
+			config.DeleteProfile(name)
+			fmt.Printf("\n❌ Failed to initialize vault: %v\n\n", err)
+			return
+		}
+
+		if err := cacheInAgent(password, agent.DefaultIdleTimeout); err != nil {
+			fmt.Printf("\033[33m⚠\033[0m  Could not cache password in agent: %v\n", err)
+		}
+
+		if switchTo, _ := cmd.Flags().GetBool("switch"); switchTo {
+			if err := config.SwitchProfile(name); err != nil {
+				fmt.Printf("\n❌ Failed to switch profile: %v\n\n", err)
+				return
+			}
+		}
+
+		fmt.Printf("\n\033[32m✓\033[0m Profile \033[1;36m%s\033[0m created\n", name)
+		fmt.Printf("\033[90mTip: Use 'leap --profile %s add' or 'leap profile switch %s'\033[0m\n\n", name, name)
+	},
+}
+
+var profileSwitchCmd = &cobra.Command{
+	Use:     "switch [name]",
+	Aliases: []string{"use"},
+	Short:   "Make a profile the default for future commands",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		if err := config.SwitchProfile(name); err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		fmt.Printf("\n\033[32m✓\033[0m Switched to profile \033[1;36m%s\033[0m\n", name)
+
+		if env := os.Getenv("LEAP_PROFILE"); env != "" && env != name {
+			fmt.Printf("\033[33m⚠\033[0m  LEAP_PROFILE=%s is set and still takes precedence.\n", env)
+		}
+
+		fmt.Println()
+	},
+}
+
+var profileDeleteCmd = &cobra.Command{
+	Use:     "delete [name]",
+	Aliases: []string{"rm"},
+	Short:   "Delete a profile with its vault, backups and history",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		force, _ := cmd.Flags().GetBool("force")
+
+		if err := config.ValidateProfileName(name); err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		if !config.ProfileExists(name) {
+			fmt.Printf("\n❌ Profile '%s' does not exist\n\n", name)
+			return
+		}
+
+		if !force {
+			fmt.Printf("\n\033[33m⚠\033[0m  This permanently deletes \033[1m%s\033[0m\n", config.GetProfileDir(name))
+
+			prompt := promptui.Prompt{
+				Label:     fmt.Sprintf("Delete profile '%s' and all its connections", name),
+				IsConfirm: true,
+			}
+
+			result, err := prompt.Run()
+			if err != nil || strings.ToLower(result) != "y" {
+				fmt.Print("\n\033[90m⊘ Cancelled\033[0m\n\n")
+				return
+			}
+		}
+
+		vault := config.GetProfileConfigPath(name)
+
+		if err := config.DeleteProfile(name); err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		agent.Lock(vault)
+
+		fmt.Printf("\n\033[32m✓\033[0m Profile \033[1;36m%s\033[0m deleted\n\n", name)
+	},
+}
+
+// promptNewMasterPassword asks for a new master password twice.
+func promptNewMasterPassword() (string, bool) {
+	prompt := promptui.Prompt{
+		Label: "🔒 Set Master Password",
+		Mask:  '*',
+		Validate: func(input string) error {
+			if len(input) < 4 {
+				return fmt.Errorf("password must be at least 4 characters")
+			}
+			return nil
+		},
+	}
+
+	password, err := prompt.Run()
+	if err != nil {
+		return "", false
+	}
+
+	confirm := promptui.Prompt{
+		Label: "🔒 Confirm Master Password",
+		Mask:  '*',
+		Validate: func(input string) error {
+			if input != password {
+				return fmt.Errorf("passwords do not match")
+			}
+			return nil
+		},
+	}
+
+	if _, err := confirm.Run(); err != nil {
+		return "", false
+	}
+
+	return password, true
+}
+
+func init() {
+	profileCreateCmd.Flags().BoolP("switch", "s", false, "Switch to the new profile")
+	profileDeleteCmd.Flags().BoolP("force", "f", false, "Delete without confirmation")
+
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileCreateCmd)
+	profileCmd.AddCommand(profileSwitchCmd)
+	profileCmd.AddCommand(profileDeleteCmd)
+
+	rootCmd.AddCommand(profileCmd)
+}
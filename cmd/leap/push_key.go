@@ -1,95 +1,122 @@
 package main
 
-// We can create a ssh key direcdtly in the server by usign ssh itself again
-// ssh-keygen -t ed25519 -f ~/.ssh/id_ed25519 -N "" -C "leap-ssh-manager" etc
-
 import (
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"time"
 
 	"github.com/paramientos/leap/internal/config"
+	leapssh "github.com/paramientos/leap/internal/ssh"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
 )
 
+// leapKeyComment marks keys LEAP installs in authorized_keys.
+const leapKeyComment = "leap-ssh-manager"
+
 var pushKeyCmd = &cobra.Command{
-	Use:   "push-key [name]",
-	Short: "Upload your public key to a remote server",
-	Args:  cobra.ExactArgs(1),
+	Use:   "push-key [name...]",
+	Short: "Upload your public key to remote server(s)",
 	Run: func(cmd *cobra.Command, args []string) {
-		name := args[0]
+		all, _ := cmd.Flags().GetBool("all")
+		tag, _ := cmd.Flags().GetString("tag")
+		keyPath, _ := cmd.Flags().GetString("key")
+
 		cfg, err := config.LoadConfig(GetPassphrase())
 		if err != nil {
 			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
 			return
 		}
 
-		conn, ok := cfg.Connections[name]
-		if !ok {
-			fmt.Printf("\n❌ Connection \033[1;36m%s\033[0m not found.\n\n", name)
+		targets, err := selectConnections(cfg, args, tag, all)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
 			return
 		}
 
-		home, _ := os.UserHomeDir()
-		leapKeyPath := filepath.Join(home, ".leap", "id_ed25519")
-		leapPubKeyPath := leapKeyPath + ".pub"
-
-		if _, err := os.Stat(leapKeyPath); os.IsNotExist(err) {
-			fmt.Printf("\n🔑 No Leap SSH key found. Generating a new one at \033[1;36m%s\033[0m...\n", leapKeyPath)
-
-			err := os.MkdirAll(filepath.Dir(leapKeyPath), 0700)
-
+		if keyPath == "" {
+			keyPath, err = ensureLeapKey()
 			if err != nil {
-				fmt.Printf("\n❌ Failed to create directory: %v\n", err)
+				fmt.Printf("\n❌ Failed to generate SSH key: %v\n\n", err)
 				return
 			}
+		}
 
-			genKey := exec.Command("ssh-keygen", "-t", "ed25519", "-f", leapKeyPath, "-N", "", "-C", "leap-ssh-manager")
+		pub, err := leapssh.ReadPublicKey(keyPath)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
 
-			err = genKey.Run()
+		fmt.Println("\n⚡ \033[1;32mPush Public Key\033[0m")
+		fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+		fmt.Printf("\033[90mKey: %s (%s)\033[0m\n\n", keyPath, ssh.FingerprintSHA256(pub))
 
-			if err != nil {
-				fmt.Printf("\n❌ Failed to generate SSH key: %v\n", err)
-				return
+		var pushed []string
+		for _, conn := range targets {
+			if err := pushKey(cfg, conn, pub); err != nil {
+				fmt.Printf("\033[31m✗\033[0m \033[1;36m%s\033[0m: %v\n", conn.Name, err)
+				continue
 			}
-			fmt.Println("✅ SSH key generated successfully.")
+			pushed = append(pushed, conn.Name)
 		}
 
-		fmt.Printf("\n🚀 Pushing public key to \033[1;36m%s\033[0m...\n", name)
-
-		sshCopyId := exec.Command("ssh-copy-id",
-			"-i", leapPubKeyPath,
-			"-p", fmt.Sprintf("%d", conn.Port),
-			fmt.Sprintf("%s@%s", conn.User, conn.Host),
-		)
-
-		sshCopyId.Stdout = os.Stdout
-		sshCopyId.Stderr = os.Stderr
-		sshCopyId.Stdin = os.Stdin
-
-		err = sshCopyId.Run()
-
-		if err != nil {
-			fmt.Printf("\n❌ Failed to push key: %v\n", err)
-			fmt.Println("\033[90mNote: You might need to enter your password for the last time.\033[0m\n")
+		if len(pushed) == 0 {
+			fmt.Println()
 			return
 		}
 
-		conn.IdentityFile = leapKeyPath
-		cfg.Connections[name] = conn
-		err = config.SaveConfig(cfg, GetPassphrase())
+		err = config.Update(GetPassphrase(), func(cfg *config.Config) error {
+			for _, name := range pushed {
+				conn, ok := cfg.Connections[name]
+				if !ok || conn.IdentityFile == keyPath {
+					continue
+				}
+				cfg.Connections[name] = withIdentity(conn, keyPath)
+			}
+			return nil
+		})
 
 		if err != nil {
-			fmt.Printf("\n⚠️  Key pushed but failed to update config: %v\n", err)
-		} else {
-			fmt.Printf("\n\033[32m✓\033[0m Public key successfully pushed and connection updated!\n")
+			fmt.Printf("\n⚠️  Key pushed but failed to update config: %v\n\n", err)
+			return
 		}
 
-		fmt.Println("\033[90mYou can now connect to \033[1m" + name + "\033[0m\033[90m without a password.\033[0m\n")
+		fmt.Println("\n\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+		fmt.Printf("\n\033[32m✓\033[0m Key installed on %d of %d server(s). Those connections now use it.\n\n", len(pushed), len(targets))
 	},
 }
 
+// pushKey installs pub over a native session, using whatever auth conn has
+// today (password, agent, 2FA) and honoring its jump hosts.
+func pushKey(cfg *config.Config, conn config.Connection, pub ssh.PublicKey) error {
+	client, err := leapssh.Dial(conn, leapssh.DialOptions{
+		Config:      cfg,
+		Timeout:     15 * time.Second,
+		Interactive: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	added, err := leapssh.AddAuthorizedKey(client, pub, leapKeyComment)
+	if err != nil {
+		return err
+	}
+
+	if added {
+		fmt.Printf("\033[32m✓\033[0m \033[1;36m%s\033[0m: key added\n", conn.Name)
+	} else {
+		fmt.Printf("\033[32m✓\033[0m \033[1;36m%s\033[0m: key already present\n", conn.Name)
+	}
+
+	return nil
+}
+
 func init() {
+	pushKeyCmd.Flags().BoolP("all", "a", false, "Push to all connections")
+	pushKeyCmd.Flags().StringP("tag", "t", "", "Push to connections with specific tag")
+	pushKeyCmd.Flags().StringP("key", "k", "", "Private key whose public half to push (default: ~/.leap/id_ed25519)")
+
 	rootCmd.AddCommand(pushKeyCmd)
 }
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/paramientos/leap/internal/config"
+	"github.com/paramientos/leap/internal/fleet"
+	"github.com/paramientos/leap/internal/runbook"
+	"github.com/paramientos/leap/internal/ssh"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run [name] [script|runbook.yml] [args...]",
+	Short: "Run a local script or a YAML runbook on remote server(s)",
+	Long: `Run a local script on remote server(s) by streaming it over stdin, or run
+a multi-step YAML runbook.
+
+Scripts run with the interpreter from their #! line (sh by default) and get
+the remaining arguments as $1, $2, ... Use --env to export variables.
+
+Runbooks (.yml/.yaml) list steps that each run a command, upload, download
+or pause for confirmation:
+
+  name: Deploy app
+  serial: 2                 # rolling batches of 2 servers
+  env:
+    APP_ENV: production
+  steps:
+    - name: Upload build
+      upload: {src: ./dist, dest: /var/www/app}
+    - name: Restart
+      command: systemctl restart app
+      sudo: true            # as root, see 'leap exec --help'
+    - name: Health check
+      command: curl -s localhost:8080/health
+      assert_contains: ok
+      timeout: 30s
+      on_failure: abort     # abort (default), continue or ignore
+    - pause: Check the dashboards before the next batch
+
+A step failing under "abort" stops that server and halts the rollout after
+the current batch. Under "continue" the server is marked failed but runs its
+remaining steps, and later batches still run; "ignore" treats the failure as
+success.
+
+Examples:
+  leap run web1 ./setup.sh --env VERSION=1.2.3 -- --force
+  leap run --tag web deploy.yml --dry-run`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+		tag, _ := cmd.Flags().GetString("tag")
+		if all || tag != "" {
+			return cobra.MinimumNArgs(1)(cmd, args)
+		}
+		return cobra.MinimumNArgs(2)(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+		tag, _ := cmd.Flags().GetString("tag")
+		envFlags, _ := cmd.Flags().GetStringArray("env")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		var names []string
+		if !all && tag == "" {
+			names, args = args[:1], args[1:]
+		}
+		path, scriptArgs := args[0], args[1:]
+
+		env := map[string]string{}
+		for _, kv := range envFlags {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok || !runbook.ValidEnvName(k) {
+				fmt.Printf("\n❌ Invalid --env '%s', expected NAME=value\n\n", kv)
+				os.Exit(2)
+			}
+			env[k] = v
+		}
+
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		targets, err := selectConnections(cfg, names, tag, all)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		dial := ssh.DialOptions{
+			Config:      cfg,
+			Timeout:     10 * time.Second,
+			Interactive: true,
+		}
+
+		if runbook.IsRunbook(path) {
+			if len(scriptArgs) > 0 {
+				fmt.Print("\n❌ Runbooks take no arguments; use --env instead\n\n")
+				os.Exit(2)
+			}
+			os.Exit(runRunbook(cmd, path, targets, env, dial, dryRun))
+		}
+
+		os.Exit(runScript(cmd, path, scriptArgs, targets, env, dial, dryRun))
+	},
+}
+
+// runScript streams a local script to every target and returns the exit
+// status to leave with.
+func runScript(cmd *cobra.Command, path string, args []string, targets []config.Connection, env map[string]string, dial ssh.DialOptions, dryRun bool) int {
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	byHost, _ := cmd.Flags().GetBool("by-host")
+	sudo, _ := cmd.Flags().GetBool("sudo")
+
+	script, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("\n❌ %v\n\n", err)
+		return 1
+	}
+
+	command := scriptCommand(script, args, env)
+
+	fmt.Println("\n⚡ \033[1;32mRun Script\033[0m")
+	fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+	fmt.Printf("\n\033[90mScript:\033[0m  \033[1;35m%s\033[0m\n", path)
+	fmt.Printf("\033[90mCommand:\033[0m %s", command)
+	if sudo {
+		fmt.Print(" \033[90m(as root via sudo)\033[0m")
+	}
+	fmt.Println()
+
+	if dryRun {
+		fmt.Printf("\033[90mServers:\033[0m %s\n", strings.Join(connectionNames(targets), ", "))
+		fmt.Print("\n\033[32m✓\033[0m Dry run complete, nothing was run\n\n")
+		return 0
+	}
+
+	opts := fleet.Options{Parallel: parallel, Timeout: timeout, Dial: dial, Stdin: script, Sudo: sudo}
+	if timeout > 0 && timeout < opts.Dial.Timeout {
+		opts.Dial.Timeout = timeout
+	}
+
+	if len(targets) == 1 {
+		return executeRemoteCommand(targets[0], command, opts)
+	}
+
+	if parallel <= 0 {
+		parallel = fleet.DefaultParallel
+	}
+	fmt.Printf("\033[90mServers:\033[0m %d \033[90m(%d at a time)\033[0m\n\n", len(targets), min(parallel, len(targets)))
+
+	results := executeOnFleet(targets, command, opts, byHost)
+
+	fmt.Println("\n\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+
+	if failed := printExecSummary(results); failed > 0 {
+		fmt.Printf("\n❌ Failed on %d of %d server(s)\n\n", failed, len(results))
+		return 1
+	}
+
+	fmt.Printf("\n\033[32m✓\033[0m Succeeded on all %d servers\n\n", len(results))
+	return 0
+}
+
+// scriptCommand builds the remote command that reads the script from stdin
+// with the interpreter named on its #! line.
+func scriptCommand(script []byte, args []string, env map[string]string) string {
+	interpreter := []string{"sh"}
+	if bytes.HasPrefix(script, []byte("#!")) {
+		line, _, _ := bytes.Cut(script[2:], []byte("\n"))
+		if fields := strings.Fields(string(line)); len(fields) > 0 {
+			interpreter = fields
+		}
+	}
+
+	// "#!/usr/bin/env bash" names the interpreter in its first argument
+	name := filepath.Base(interpreter[0])
+	if name == "env" && len(interpreter) > 1 {
+		name = filepath.Base(interpreter[1])
+	}
+
+	parts := append([]string{}, interpreter...)
+	switch name {
+	case "sh", "bash", "dash", "zsh", "ksh", "ash":
+		parts = append(parts, "-s", "--")
+	default:
+		parts = append(parts, "-")
+	}
+
+	for _, arg := range args {
+		parts = append(parts, ssh.ShellQuote(arg))
+	}
+
+	return runbook.EnvPrefix(env) + strings.Join(parts, " ")
+}
+
+// runRunbook loads and runs a runbook, printing a per-server summary, and
+// returns the exit status to leave with.
+func runRunbook(cmd *cobra.Command, path string, targets []config.Connection, env map[string]string, dial ssh.DialOptions, dryRun bool) int {
+	serial, _ := cmd.Flags().GetInt("serial")
+	sudo, _ := cmd.Flags().GetBool("sudo")
+
+	rb, err := runbook.Load(path)
+	if err != nil {
+		fmt.Printf("\n❌ %v\n\n", err)
+		return 2
+	}
+
+	title := "Runbook"
+	if dryRun {
+		title += " (dry run)"
+	}
+
+	fmt.Printf("\n⚡ \033[1;32m%s:\033[0m \033[1;36m%s\033[0m\n", title, rb.Name)
+	fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+	fmt.Println()
+
+	opts := runbook.Options{
+		Env:     env,
+		Serial:  serial,
+		Sudo:    sudo,
+		Dial:    dial,
+		Out:     os.Stdout,
+		Confirm: confirmPause,
+	}
+
+	if dryRun {
+		rb.Plan(targets, opts)
+		fmt.Print("\n\033[32m✓\033[0m Dry run complete, nothing was run\n\n")
+		return 0
+	}
+
+	fmt.Printf("\033[90mServers:\033[0m %s\n", strings.Join(connectionNames(targets), ", "))
+
+	results, runErr := rb.Run(targets, opts)
+
+	fmt.Println("\n\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+	fmt.Println()
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "  \033[1;36mSERVER\033[0m\t\033[1;36mSTATUS\033[0m\t\033[1;36mSTEPS\033[0m\t\033[1;36mDURATION\033[0m\t\033[1;36mERROR\033[0m")
+	for _, res := range results {
+		status := "\033[32m✓ ok\033[0m"
+		errText := "\033[90m-\033[0m"
+		if res.Failed {
+			failed++
+			status = "\033[31m✗ failed\033[0m"
+		}
+		if res.Err != nil {
+			errText = "\033[31m" + res.Err.Error() + "\033[0m"
+		}
+		fmt.Fprintf(w, "  \033[1m%s\033[0m\t%s\t%d/%d\t%s\t%s\n", res.Conn.Name, status, res.Steps, len(rb.Steps), res.Duration.Round(time.Millisecond), errText)
+	}
+	w.Flush()
+
+	if skipped := len(targets) - len(results); skipped > 0 {
+		fmt.Printf("\n\033[90m%d server(s) not started\033[0m\n", skipped)
+	}
+
+	if runErr != nil || failed > 0 {
+		if runErr != nil {
+			fmt.Printf("\n❌ %v\n\n", runErr)
+		} else {
+			fmt.Printf("\n❌ Failed on %d of %d server(s)\n\n", failed, len(targets))
+		}
+		return 1
+	}
+
+	fmt.Printf("\n\033[32m✓\033[0m Runbook completed on %d server(s)\n\n", len(results))
+	return 0
+}
+
+func confirmPause(message string) bool {
+	fmt.Printf("\n⏸  %s\n", message)
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Print("\033[90mNo terminal to confirm on; stopping\033[0m\n")
+		return false
+	}
+
+	prompt := promptui.Prompt{
+		Label:     "Continue",
+		IsConfirm: true,
+	}
+
+	result, err := prompt.Run()
+	return err == nil && strings.ToLower(result) == "y"
+}
+
+func connectionNames(conns []config.Connection) []string {
+	names := make([]string, 0, len(conns))
+	for _, conn := range conns {
+		names = append(names, conn.Name)
+	}
+	return names
+}
+
+func init() {
+	runCmd.Flags().BoolP("all", "a", false, "Run on all connections")
+	runCmd.Flags().StringP("tag", "t", "", "Run on connections with specific tag")
+	runCmd.Flags().StringArrayP("env", "e", nil, "Export NAME=value to the script or runbook (repeatable)")
+	runCmd.Flags().BoolP("dry-run", "n", false, "Print what would run without connecting")
+	runCmd.Flags().IntP("parallel", "p", fleet.DefaultParallel, "Scripts: number of servers to run on at once")
+	runCmd.Flags().Duration("timeout", 0, "Scripts: give up on a server after this long (0 = no limit)")
+	runCmd.Flags().Bool("by-host", false, "Scripts: print each server's output as one block")
+	runCmd.Flags().Bool("sudo", false, "Run the script or every runbook command as root via sudo")
+	runCmd.Flags().Int("serial", 0, "Runbooks: servers per rolling batch, overriding the runbook")
+
+	rootCmd.AddCommand(runCmd)
+}
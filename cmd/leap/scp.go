@@ -2,72 +2,102 @@ package main
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/paramientos/leap/internal/config"
+	leapssh "github.com/paramientos/leap/internal/ssh"
+	"github.com/paramientos/leap/internal/transfer"
+	"github.com/paramientos/leap/internal/tui"
 	"github.com/spf13/cobra"
 )
 
 var scpCmd = &cobra.Command{
-	Use:   "scp [connection] [local_path] [remote_path]",
+	Use:   "scp [connection] [source...] [destination]",
 	Short: "Transfer files using Leap connections",
 	Long: `Transfer files between local and remote using Leap connection settings.
-Example: leap scp myserver ./file.txt /tmp/`,
-	Args: cobra.MinimumNArgs(1),
+Prefix remote paths with ':' to download; plain paths are uploaded.
+With only a connection name, opens the interactive file manager.
 
+Examples:
+  leap scp myserver
+  leap scp myserver ./file.txt /tmp/
+  leap scp myserver :/var/log/app.log ./`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		name := args[0]
-		cfg, err := config.LoadConfig(GetPassphrase())
-		if err != nil {
-			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
-			return
-		}
 
-		conn, ok := cfg.Connections[name]
-		if !ok {
-			fmt.Printf("\n❌ Connection \033[1;36m%s\033[0m not found.\n\n", name)
+		if len(args) == 1 {
+			cfg, err := config.LoadConfig(GetPassphrase())
+			if err != nil {
+				fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+				return
+			}
+
+			conn, ok := cfg.Connections[name]
+			if !ok {
+				fmt.Printf("\n❌ Connection '\033[1;36m%s\033[0m' not found.\n", name)
+				fmt.Print("\033[90mTip: Use 'leap list' to see all available connections\033[0m\n\n")
+				return
+			}
+
+			openFileManager(cfg, conn)
 			return
 		}
 
 		if len(args) < 3 {
-			fmt.Println("\n📂 Interactive File Manager coming soon!")
-			fmt.Println("\033[90mUsage for now: leap scp [name] [local_src] [remote_dest]\033[0m\n")
+			fmt.Print("\n❌ Usage: leap scp [name] [source...] [destination]\n\n")
 			return
 		}
 
-		src := args[1]
-		dest := args[2]
+		sources := args[1 : len(args)-1]
+		dest := args[len(args)-1]
 
-		fmt.Printf("\n🚀 Transferring \033[1;33m%s\033[0m to \033[1;36m%s:%s\033[0m...\n", src, name, dest)
-
-		scpArgs := []string{"-P", fmt.Sprintf("%d", conn.Port)}
-
-		if conn.IdentityFile != "" {
-			scpArgs = append(scpArgs, "-i", conn.IdentityFile)
+		remote := 0
+		for _, src := range sources {
+			if strings.HasPrefix(src, ":") {
+				remote++
+			}
 		}
 
-		if conn.JumpHost != "" {
-			scpArgs = append(scpArgs, "-J", conn.JumpHost)
+		if remote == 0 {
+			runTransfer(cmd, name, true, sources, strings.TrimPrefix(dest, ":"))
+			return
 		}
 
-		remoteTarget := fmt.Sprintf("%s@%s:%s", conn.User, conn.Host, dest)
-		scpArgs = append(scpArgs, src, remoteTarget)
-
-		scpProcess := exec.Command("scp", scpArgs...)
-		scpProcess.Stdout = os.Stdout
-		scpProcess.Stderr = os.Stderr
-
-		err = scpProcess.Run()
+		if remote != len(sources) || strings.HasPrefix(dest, ":") {
+			fmt.Print("\n❌ Sources must be all remote (':path') or all local, and the destination the other side\n\n")
+			return
+		}
 
-		if err != nil {
-			fmt.Printf("\n❌ Transfer failed: %v\n\n", err)
-		} else {
-			fmt.Printf("\n\033[32m✓\033[0m File successfully transferred!\n\n")
+		for i, src := range sources {
+			sources[i] = strings.TrimPrefix(src, ":")
 		}
+		runTransfer(cmd, name, false, sources, dest)
 	},
 }
 
+// openFileManager connects to conn over SFTP and runs the dual-pane browser.
+func openFileManager(cfg *config.Config, conn config.Connection) {
+	fmt.Printf("\n📂 Opening files on \033[1;36m%s\033[0m...\n", conn.Name)
+
+	session, err := transfer.Open(conn, leapssh.DialOptions{
+		Config:      cfg,
+		Timeout:     15 * time.Second,
+		Interactive: true,
+	})
+	if err != nil {
+		fmt.Printf("\n❌ Connection failed: %v\n\n", err)
+		return
+	}
+	defer session.Close()
+
+	if err := tui.RunFileManager(conn, session); err != nil {
+		fmt.Printf("\n❌ Error running file manager: %v\n\n", err)
+	}
+}
+
 func init() {
+	addTransferFlags(scpCmd)
 	rootCmd.AddCommand(scpCmd)
 }
@@ -107,12 +107,6 @@ var importCodeCmd = &cobra.Command{
 			return
 		}
 
-		cfg, err := config.LoadConfig(GetPassphrase())
-		if err != nil {
-			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
-			return
-		}
-
 		conn := config.Connection{
 			Name:     s.N,
 			Host:     s.H,
@@ -123,9 +117,10 @@ var importCodeCmd = &cobra.Command{
 			Group:    s.G,
 		}
 
-		cfg.Connections[conn.Name] = conn
-
-		err = config.SaveConfig(cfg, GetPassphrase())
+		err = config.Update(GetPassphrase(), func(cfg *config.Config) error {
+			cfg.Connections[conn.Name] = conn
+			return nil
+		})
 
 		if err != nil {
 			fmt.Printf("\n❌ Error saving config: %v\n\n", err)
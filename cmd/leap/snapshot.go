@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/paramientos/leap/internal/config"
+	leapssh "github.com/paramientos/leap/internal/ssh"
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/ssh"
 	"gopkg.in/yaml.v3"
@@ -90,7 +91,7 @@ var snapshotCmd = &cobra.Command{
 		fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n")
 		fmt.Printf("  Server: \033[1;36m%s\033[0m (%s@%s)\n\n", name, conn.User, conn.Host)
 
-		snapshot, err := captureSnapshot(conn, name, includePackages)
+		snapshot, err := captureSnapshot(cfg, conn, name, includePackages)
 
 		if err != nil {
 			fmt.Printf("\n❌ Failed to capture snapshot: %v\n\n", err)
@@ -123,36 +124,14 @@ var snapshotCmd = &cobra.Command{
 	},
 }
 
-func captureSnapshot(conn config.Connection, name string, includePackages bool) (*ServerSnapshot, error) {
+func captureSnapshot(cfg *config.Config, conn config.Connection, name string, includePackages bool) (*ServerSnapshot, error) {
 	snapshot := &ServerSnapshot{
 		ServerName: name,
 		Host:       conn.Host,
 		Timestamp:  time.Now(),
 	}
 
-	sshConfig := &ssh.ClientConfig{
-		User:            conn.User,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         15 * time.Second,
-	}
-
-	if conn.IdentityFile != "" {
-		key, err := os.ReadFile(conn.IdentityFile)
-		if err == nil {
-			signer, err := ssh.ParsePrivateKey(key)
-			if err == nil {
-				sshConfig.Auth = append(sshConfig.Auth, ssh.PublicKeys(signer))
-			}
-		}
-	}
-
-	if conn.Password != "" {
-		sshConfig.Auth = append(sshConfig.Auth, ssh.Password(conn.Password))
-	}
-
-	addr := fmt.Sprintf("%s:%d", conn.Host, conn.Port)
-
-	client, err := ssh.Dial("tcp", addr, sshConfig)
+	client, err := leapssh.Dial(conn, leapssh.DialOptions{Config: cfg, Interactive: true})
 	if err != nil {
 		return nil, err
 	}
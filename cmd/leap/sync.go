@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/paramientos/leap/internal/config"
+	leapssh "github.com/paramientos/leap/internal/ssh"
+	"github.com/paramientos/leap/internal/transfer"
+	"github.com/paramientos/leap/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync [name] [local-dir] [remote-dir]",
+	Short: "Mirror a directory to or from servers, copying only changes",
+	Long: `Mirror the contents of a directory over SFTP, copying only files whose
+size or modification time differ (or whose SHA-256 differs with --checksum).
+
+By default the remote directory is made to match the local one. Use --pull to
+go the other way. With --tag, the name is omitted and every tagged connection
+is synced in turn; pulls then land in <local-dir>/<name>.
+
+Examples:
+  leap sync web1 ./dist /var/www/app --delete
+  leap sync --tag web ./dist /var/www/app --exclude '*.log' --dry-run
+  leap sync db1 ./backups /var/backups --pull`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if tag, _ := cmd.Flags().GetString("tag"); tag != "" {
+			return cobra.ExactArgs(2)(cmd, args)
+		}
+		return cobra.ExactArgs(3)(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		tag, _ := cmd.Flags().GetString("tag")
+		pull, _ := cmd.Flags().GetBool("pull")
+		noVerify, _ := cmd.Flags().GetBool("no-verify")
+
+		opts := transfer.SyncOptions{Verify: !noVerify, Out: os.Stdout}
+		opts.Delete, _ = cmd.Flags().GetBool("delete")
+		opts.Checksum, _ = cmd.Flags().GetBool("checksum")
+		opts.Exclude, _ = cmd.Flags().GetStringSlice("exclude")
+		opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+
+		var names []string
+		if tag == "" {
+			names, args = args[:1], args[1:]
+		}
+		local, remote := args[0], args[1]
+
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		targets, err := selectConnections(cfg, names, tag, false)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		title := "Directory Sync"
+		if opts.DryRun {
+			title += " (dry run)"
+		}
+		fmt.Printf("\n⚡ \033[1;32m%s\033[0m\n", title)
+		fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+
+		failed := 0
+		for _, conn := range targets {
+			dir := local
+			if pull && tag != "" {
+				dir = filepath.Join(local, conn.Name)
+			}
+
+			from := fmt.Sprintf("\033[1;35m%s\033[0m", dir)
+			to := fmt.Sprintf("\033[1;36m%s\033[0m:\033[1;35m%s\033[0m", conn.Name, remote)
+			if pull {
+				from, to = to, from
+			}
+			fmt.Printf("\n%s → %s\n", from, to)
+
+			if !syncOne(cfg, conn, pull, dir, remote, opts) {
+				failed++
+			}
+		}
+
+		fmt.Println("\n\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+
+		if failed > 0 {
+			fmt.Printf("\n❌ Sync failed on %d of %d server(s)\n\n", failed, len(targets))
+			os.Exit(1)
+		}
+
+		if opts.DryRun {
+			fmt.Print("\n\033[32m✓\033[0m Dry run complete, nothing was changed\n\n")
+			return
+		}
+		fmt.Printf("\n\033[32m✓\033[0m Synced %d server(s)\n\n", len(targets))
+	},
+}
+
+// syncOne syncs a single connection and prints its summary line.
+func syncOne(cfg *config.Config, conn config.Connection, pull bool, local, remote string, opts transfer.SyncOptions) bool {
+	session, err := transfer.Open(conn, leapssh.DialOptions{
+		Config:      cfg,
+		Timeout:     15 * time.Second,
+		Interactive: true,
+	})
+	if err != nil {
+		fmt.Printf("  \033[31m✗\033[0m Connection failed: %v\n", err)
+		return false
+	}
+	defer session.Close()
+
+	var stats transfer.SyncStats
+	if pull {
+		stats, err = session.Pull(remote, local, opts)
+	} else {
+		stats, err = session.Push(local, remote, opts)
+	}
+
+	verb := "copied"
+	if opts.DryRun {
+		verb = "to copy"
+	}
+	summary := fmt.Sprintf("%d added, %d updated, %d deleted, %d unchanged, %s %s",
+		stats.Added, stats.Updated, stats.Deleted, stats.Unchanged, utils.FormatBytes(stats.Bytes), verb)
+
+	if err != nil {
+		fmt.Printf("  \033[31m✗\033[0m %v \033[90m(%s)\033[0m\n", err, summary)
+		return false
+	}
+
+	fmt.Printf("  \033[32m✓\033[0m \033[90m%s\033[0m\n", summary)
+	return true
+}
+
+func init() {
+	syncCmd.Flags().StringP("tag", "t", "", "Sync every connection with this tag")
+	syncCmd.Flags().Bool("pull", false, "Copy from the server to the local directory")
+	syncCmd.Flags().Bool("delete", false, "Delete files that no longer exist on the source side")
+	syncCmd.Flags().BoolP("checksum", "c", false, "Compare files by SHA-256 instead of size and mtime")
+	syncCmd.Flags().StringSliceP("exclude", "x", nil, "Skip paths matching a glob (repeatable, 'dir/' matches directories only)")
+	syncCmd.Flags().BoolP("dry-run", "n", false, "Show what would change without changing anything")
+	syncCmd.Flags().Bool("no-verify", false, "Skip SHA-256 verification after each copy")
+
+	rootCmd.AddCommand(syncCmd)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/paramientos/leap/internal/config"
+	"github.com/paramientos/leap/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var totpCmd = &cobra.Command{
+	Use:   "totp",
+	Short: "Manage TOTP seeds used to answer two-factor prompts",
+}
+
+var totpSetCmd = &cobra.Command{
+	Use:   "set [name]",
+	Short: "Save a TOTP seed (base32 or otpauth:// URI) for a connection",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		if _, ok := cfg.Connections[name]; !ok {
+			fmt.Printf("\n❌ Connection '\033[1;36m%s\033[0m' not found.\n", name)
+			fmt.Print("\033[90mTip: Use 'leap list' to see all available connections\033[0m\n\n")
+			return
+		}
+
+		prompt := promptui.Prompt{
+			Label: "🔢 TOTP Seed",
+			Mask:  '*',
+			Validate: func(input string) error {
+				_, err := utils.ParseTOTPKey(input)
+				return err
+			},
+		}
+
+		seed, err := prompt.Run()
+		if err != nil {
+			return
+		}
+		seed = strings.TrimSpace(seed)
+
+		err = config.Update(GetPassphrase(), func(cfg *config.Config) error {
+			conn, ok := cfg.Connections[name]
+			if !ok {
+				return fmt.Errorf("connection '%s' no longer exists", name)
+			}
+			conn.TOTPSecret = seed
+			cfg.Connections[name] = conn
+			return nil
+		})
+
+		if err != nil {
+			fmt.Printf("\n❌ Error saving config: %v\n\n", err)
+			return
+		}
+
+		key, _ := utils.ParseTOTPKey(seed)
+		fmt.Printf("\n\033[32m✓\033[0m TOTP seed saved for \033[1;36m%s\033[0m\n", name)
+		fmt.Printf("\033[90mCurrent code: %s — compare it with your authenticator app\033[0m\n\n", key.Code(key.Step(time.Now())))
+	},
+}
+
+var totpRemoveCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Remove the TOTP seed of a connection",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		err := config.Update(GetPassphrase(), func(cfg *config.Config) error {
+			conn, ok := cfg.Connections[name]
+			if !ok {
+				return fmt.Errorf("connection '%s' not found", name)
+			}
+			conn.TOTPSecret = ""
+			cfg.Connections[name] = conn
+			return nil
+		})
+
+		if err != nil {
+			fmt.Printf("\n❌ Error saving config: %v\n\n", err)
+			return
+		}
+
+		fmt.Printf("\n\033[32m✓\033[0m TOTP seed removed from \033[1;36m%s\033[0m\n\n", name)
+	},
+}
+
+var totpCodeCmd = &cobra.Command{
+	Use:   "code [name]",
+	Short: "Print the current TOTP code of a connection",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		conn, ok := cfg.Connections[name]
+		if !ok {
+			fmt.Printf("\n❌ Connection '\033[1;36m%s\033[0m' not found.\n\n", name)
+			return
+		}
+
+		if conn.TOTPSecret == "" {
+			fmt.Printf("\n❌ Connection '\033[1;36m%s\033[0m' has no TOTP seed.\n", name)
+			fmt.Printf("\033[90mTip: Save one with 'leap totp set %s'\033[0m\n\n", name)
+			return
+		}
+
+		key, err := utils.ParseTOTPKey(conn.TOTPSecret)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		now := time.Now()
+		step := key.Step(now)
+		remaining := key.StepStart(step + 1).Sub(now).Round(time.Second)
+
+		fmt.Printf("%s \033[90m(valid for %s)\033[0m\n", key.Code(step), remaining)
+	},
+}
+
+func init() {
+	totpCmd.AddCommand(totpSetCmd)
+	totpCmd.AddCommand(totpRemoveCmd)
+	totpCmd.AddCommand(totpCodeCmd)
+	rootCmd.AddCommand(totpCmd)
+}
@@ -4,18 +4,51 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/manifoldco/promptui"
 	"github.com/paramientos/leap/internal/config"
+	leapssh "github.com/paramientos/leap/internal/ssh"
+	"github.com/paramientos/leap/internal/tunnel"
 	"github.com/spf13/cobra"
 )
 
 var tunnelCmd = &cobra.Command{
-	Use:   "tunnel [name] [local_port:remote_host:remote_port]",
-	Short: "Open an SSH tunnel",
-	Args:  cobra.MinimumNArgs(2),
+	Use:   "tunnel [name] [[bind:]local:host:remote...]",
+	Short: "Forward ports over SSH",
+	Long: `Forward ports over SSH: local ports to ports reachable from a server, like
+ssh -L; ports on the server back to ports reachable from here, like ssh -R;
+or a local SOCKS5 proxy that connects out through the server, like ssh -D.
+
+With specs, the tunnels stay open in the foreground until Ctrl+C. Without,
+the connection's saved tunnels are opened. To keep tunnels up after the
+terminal closes, use 'leap tunnel up', which hands them to a background
+tunnel manager.
+
+Specs take the ssh -L form [bind_address:]local_port:host:remote_port, or
+local_port:remote_port for a port on the server itself. Remote forwards
+(-R) are [bind_address:]remote_port:host:local_port, with host dialed from
+here, and dynamic forwards (-D) are [bind_address:]local_port. Saved specs
+mark these with an R: or D: prefix. Ports listen on 127.0.0.1 unless a bind
+address is given; the server may ignore the bind address of a remote
+forward unless its GatewayPorts allows it.
+
+Examples:
+  leap tunnel db 5432:localhost:5432
+  leap tunnel staging -R 8080:localhost:3000
+  leap tunnel bastion -D 1080
+  leap tunnel edit db --add 8080:localhost:80 --add D:1080
+  leap tunnel up db web1
+  leap tunnel status
+  leap tunnel down --all
+  leap tunnel stop`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		name := args[0]
-		tunnelSpec := args[1]
 
 		cfg, err := config.LoadConfig(GetPassphrase())
 
@@ -28,47 +61,657 @@ var tunnelCmd = &cobra.Command{
 
 		if !ok {
 			fmt.Printf("\n❌ Connection '\033[1;36m%s\033[0m' not found.\n", name)
-			fmt.Println("\033[90mTip: Use 'leap list' to see all available connections\033[0m\n")
+			fmt.Print("\033[90mTip: Use 'leap list' to see all available connections\033[0m\n\n")
 
 			return
 		}
 
-		sshArgs := []string{}
-
-		if conn.IdentityFile != "" {
-			sshArgs = append(sshArgs, "-i", conn.IdentityFile)
+		specs := args[1:]
+		for _, flag := range []struct{ name, prefix string }{{"local", "L:"}, {"remote", "R:"}, {"dynamic", "D:"}} {
+			values, _ := cmd.Flags().GetStringArray(flag.name)
+			for _, v := range values {
+				specs = append(specs, flag.prefix+v)
+			}
 		}
 
-		sshArgs = append(sshArgs, "-p", fmt.Sprintf("%d", conn.Port))
-
-		if conn.JumpHost != "" {
-			sshArgs = append(sshArgs, "-J", conn.JumpHost)
+		tunnels := conn.Tunnels
+		if len(specs) > 0 {
+			tunnels, err = parseTunnelSpecs(specs)
+			if err != nil {
+				fmt.Printf("\n❌ %v\n\n", err)
+				os.Exit(2)
+			}
 		}
 
-		sshArgs = append(sshArgs, "-L", tunnelSpec)
-		sshArgs = append(sshArgs, "-N") // Do not execute a remote command
-		sshArgs = append(sshArgs, fmt.Sprintf("%s@%s", conn.User, conn.Host))
+		if len(tunnels) == 0 {
+			fmt.Printf("\n❌ No tunnels saved for \033[1;36m%s\033[0m\n", name)
+			fmt.Printf("\033[90mTip: Pass a spec like 8080:localhost:80 or -D 1080, or save one with 'leap tunnel edit %s'\033[0m\n\n", name)
+			os.Exit(2)
+		}
 
 		fmt.Println("\n⚡ \033[1;32mSSH Tunnel\033[0m")
 		fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
-		fmt.Printf("\n\033[32m✓\033[0m Opening tunnel: \033[1;35m%s\033[0m → \033[1;36m%s\033[0m\n", tunnelSpec, name)
-		fmt.Printf("\033[90mPress Ctrl+C to close the tunnel\033[0m\n\n")
 
-		c := exec.Command("ssh", sshArgs...)
-		c.Stdin = os.Stdin
-		c.Stdout = os.Stdout
-		c.Stderr = os.Stderr
+		session, err := tunnel.Open(conn, tunnels, leapssh.DialOptions{Config: cfg, Interactive: true})
+		if err != nil {
+			fmt.Printf("\n❌ Failed to open tunnel: %v\n\n", err)
+			os.Exit(1)
+		}
+
+		session.Logf = func(format string, args ...any) {
+			fmt.Printf("\033[33m⚠\033[0m  "+format+"\n", args...)
+		}
 
-		err = c.Run()
+		fmt.Println()
+		for _, t := range tunnels {
+			fmt.Printf("\033[32m✓\033[0m %s\n", describeTunnel(name, t))
+		}
+		fmt.Print("\033[90mPress Ctrl+C to close the tunnel\033[0m\n\n")
 
-		if err != nil {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			<-interrupt
+			session.Close()
+		}()
+
+		if err := session.Wait(); err != nil {
 			fmt.Printf("\n❌ Tunnel closed: %v\n\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Print("\n\033[32m✓\033[0m Tunnel closed successfully\n\n")
+	},
+}
+
+var tunnelUpCmd = &cobra.Command{
+	Use:   "up [name...]",
+	Short: "Open saved tunnels in the background",
+	Long: `Open the saved tunnels of one or more connections in a background tunnel
+manager, which keeps them up after the terminal closes. Running 'up' again
+for a connection reopens its tunnels, e.g. after 'leap tunnel edit'.
+
+The manager cannot prompt, so accept new host keys and save passwords first,
+for instance by running the tunnel once in the foreground.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+		tag, _ := cmd.Flags().GetString("tag")
+
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		targets, err := selectConnections(cfg, args, tag, all)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			return
+		}
+
+		fmt.Println("\n⚡ \033[1;32mTunnels Up\033[0m")
+		fmt.Print("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n\n")
+
+		failed := 0
+		opened := 0
+		for _, conn := range targets {
+			if len(conn.Tunnels) == 0 {
+				if len(args) > 0 {
+					fmt.Printf("\033[90m⊘ %s: no saved tunnels\033[0m\n", conn.Name)
+				}
+				continue
+			}
+
+			if err := tunnelUp(cfg, conn); err != nil {
+				failed++
+				fmt.Printf("\033[31m✗\033[0m \033[1;36m%s\033[0m: %v\n", conn.Name, err)
+				continue
+			}
+
+			opened++
+			fmt.Printf("\033[32m✓\033[0m \033[1;36m%s\033[0m %s\n", conn.Name, tunnelSpecs(conn.Tunnels))
+		}
+
+		if opened == 0 && failed == 0 {
+			fmt.Print("\033[90mNo saved tunnels to open\033[0m\n\n")
+			return
+		}
+
+		fmt.Println()
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// tunnelUp hands the saved tunnels of conn to the manager, starting one if
+// needed.
+func tunnelUp(cfg *config.Config, conn config.Connection) error {
+	hops, err := leapssh.JumpChain(conn, cfg)
+	if err != nil {
+		return err
+	}
+
+	if !tunnel.Running() {
+		if err := startTunnelManager(); err != nil {
+			return err
+		}
+	}
+
+	return tunnel.Up(config.ActiveProfile(), conn, hops, conn.Tunnels)
+}
+
+// startTunnelManager launches `leap tunnel manager` detached from the
+// terminal and waits for its socket to answer.
+func startTunnelManager() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	c := exec.Command(exe, "tunnel", "manager")
+	detach(c)
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+	go c.Wait()
+
+	for i := 0; i < 40; i++ {
+		if tunnel.Running() {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return fmt.Errorf("tunnel manager did not come up on %s", tunnel.SocketPath())
+}
+
+var tunnelDownCmd = &cobra.Command{
+	Use:   "down [name...]",
+	Short: "Close tunnels opened with 'leap tunnel up'",
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+
+		if len(args) == 0 && !all {
+			fmt.Print("\n❌ Name the connections to close, or use --all\n\n")
+			os.Exit(2)
+		}
+
+		if !tunnel.Running() {
+			fmt.Print("\n\033[90mNo tunnels are up\033[0m\n\n")
+			return
+		}
+
+		names := args
+		if all {
+			names = nil
+		}
+
+		closed, err := tunnel.Down(config.ActiveProfile(), names)
+		if err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			os.Exit(1)
+		}
+
+		if closed < len(names) {
+			fmt.Printf("\n\033[90m⊘ %d of the named connections had no tunnels up\033[0m", len(names)-closed)
+		}
+
+		fmt.Printf("\n\033[32m✓\033[0m Closed the tunnels of %d connection(s)\n\n", closed)
+	},
+}
+
+var tunnelStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Close every background tunnel, in all profiles, and stop the manager",
+	Run: func(cmd *cobra.Command, args []string) {
+		if !tunnel.Running() {
+			fmt.Print("\n\033[90mNo tunnel manager is running\033[0m\n\n")
+			return
+		}
+
+		if err := tunnel.Stop(); err != nil {
+			fmt.Printf("\n❌ %v\n\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Print("\n\033[32m✓\033[0m Tunnel manager stopped\n\n")
+	},
+}
+
+var tunnelStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the tunnels the background manager keeps up",
+	Long: `Show the tunnels the background manager keeps up. Tunnels are watched with
+keepalives; one whose connection is lost shows as reconnecting while it is
+redialed with backoff, and as down only if the redial can't succeed, e.g.
+because the host key changed.
+
+With --line, print a one-line summary for a shell prompt instead, or nothing
+when no tunnels are up:
+  PS1='$(leap tunnel status --line) \w $ '`,
+	Run: func(cmd *cobra.Command, args []string) {
+		line, _ := cmd.Flags().GetBool("line")
+
+		sessions, pid, err := tunnel.List()
+		if line {
+			if err == nil {
+				fmt.Print(tunnelStatusLine(sessions))
+			}
+			return
+		}
+
+		if err != nil {
+			fmt.Print("\n\033[90mNo tunnels are up\033[0m\n\n")
+			return
+		}
+
+		fmt.Println("\n⚡ \033[1;32mTunnels\033[0m")
+		fmt.Print("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n\n")
+
+		profile := config.ActiveProfile()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+		fmt.Fprintln(w, "  \033[1;36mCONNECTION\033[0m\t\033[1;36mTUNNEL\033[0m\t\033[1;36mSTATE\033[0m\t\033[1;36mSINCE\033[0m\t\033[1;36mCONNS\033[0m")
+
+		for _, s := range sessions {
+			name := s.Name
+			if s.Profile != profile {
+				name = s.Profile + ":" + s.Name
+			}
+
+			state := "\033[32m● up"
+			switch s.State {
+			case tunnel.StateReconnecting:
+				state = "\033[33m● reconnecting"
+			case tunnel.StateDown:
+				state = "\033[31m● down"
+			}
+			switch {
+			case s.Reconnects == 1:
+				state += " (1 reconnect)"
+			case s.Reconnects > 1:
+				state += fmt.Sprintf(" (%d reconnects)", s.Reconnects)
+			}
+			state += "\033[0m"
+			since := time.Since(s.Since).Round(time.Second).String()
+
+			for _, f := range s.Forwards {
+				fmt.Fprintf(w, "  \033[1m%s\033[0m\t%s\t%s\t%s\t%d active, %d total\n", name, f.Spec, state, since, f.Active, f.Total)
+			}
+		}
+		w.Flush()
+
+		for _, s := range sessions {
+			switch {
+			case s.State == tunnel.StateReconnecting:
+				fmt.Printf("\n\033[33m⟳\033[0m \033[1;36m%s\033[0m: %s", s.Name, s.Error)
+				if s.Attempts > 0 {
+					fmt.Printf(" \033[90m(%d failed redials)\033[0m", s.Attempts)
+				}
+				if wait := time.Until(s.NextTry); wait > 0 {
+					fmt.Printf(" \033[90m- next try in %s\033[0m", wait.Round(time.Second))
+				}
+			case s.Error != "":
+				fmt.Printf("\n\033[31m✗\033[0m \033[1;36m%s\033[0m: %s", s.Name, s.Error)
+			}
+		}
+
+		fmt.Printf("\n\033[90mManager PID %d\033[0m\n\n", pid)
+	},
+}
+
+// tunnelStatusLine summarizes sessions for a shell prompt, naming the ones
+// that are not up: "⇅ 3 up", "⇅ 2/3 up · db reconnecting". It has no colors,
+// since prompts need them escaped in shell-specific ways.
+func tunnelStatusLine(sessions []tunnel.Status) string {
+	if len(sessions) == 0 {
+		return ""
+	}
+
+	up := 0
+	var others []string
+	for _, s := range sessions {
+		if s.State == tunnel.StateUp {
+			up++
+			continue
+		}
+		others = append(others, s.Name+" "+s.State)
+	}
+
+	if len(others) == 0 {
+		return fmt.Sprintf("⇅ %d up\n", up)
+	}
+	return fmt.Sprintf("⇅ %d/%d up · %s\n", up, len(sessions), strings.Join(others, " · "))
+}
+
+var tunnelEditCmd = &cobra.Command{
+	Use:   "edit [name]",
+	Short: "Manage the saved tunnels of a connection",
+	Long: `Add, change and remove the saved tunnels of a connection, interactively or
+with --add and --remove.
+
+Examples:
+  leap tunnel edit db
+  leap tunnel edit db --add 5432:localhost:5432 --add 0.0.0.0:8080:web:80
+  leap tunnel edit staging --add R:8080:localhost:3000 --add D:1080
+  leap tunnel edit db --remove 8080`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		add, _ := cmd.Flags().GetStringArray("add")
+		remove, _ := cmd.Flags().GetIntSlice("remove")
+
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		conn, ok := cfg.Connections[name]
+		if !ok {
+			fmt.Printf("\n❌ Connection '\033[1;36m%s\033[0m' not found.\n", name)
+			fmt.Print("\033[90mTip: Use 'leap list' to see all available connections\033[0m\n\n")
+			return
+		}
+
+		tunnels := append([]config.Tunnel(nil), conn.Tunnels...)
+
+		if len(add) > 0 || len(remove) > 0 {
+			tunnels, err = applyTunnelEdits(tunnels, add, remove)
+			if err != nil {
+				fmt.Printf("\n❌ %v\n\n", err)
+				os.Exit(2)
+			}
 		} else {
-			fmt.Println("\n\033[32m✓\033[0m Tunnel closed successfully\n")
+			fmt.Println("\n⚡ \033[1;32mEdit Tunnels\033[0m")
+			fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+			fmt.Printf("\033[90mEditing: \033[1;36m%s\033[0m\n\n", name)
+
+			var save bool
+			tunnels, save = editTunnelsInteractive(name, tunnels)
+			if !save {
+				fmt.Print("\n\033[90mNo changes saved\033[0m\n\n")
+				return
+			}
+		}
+
+		err = config.Update(GetPassphrase(), func(cfg *config.Config) error {
+			conn, ok := cfg.Connections[name]
+			if !ok {
+				return fmt.Errorf("connection '%s' no longer exists", name)
+			}
+			conn.Tunnels = tunnels
+			cfg.Connections[name] = conn
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("\n❌ Error saving config: %v\n\n", err)
+			return
+		}
+
+		fmt.Printf("\n\033[32m✓\033[0m Tunnels of \033[1;36m%s\033[0m saved", name)
+		if len(tunnels) > 0 {
+			fmt.Printf(": %s", tunnelSpecs(tunnels))
+		}
+		fmt.Println()
+		fmt.Printf("\033[90mTip: Run 'leap tunnel up %s' to (re)open them in the background\033[0m\n\n", name)
+	},
+}
+
+// applyTunnelEdits drops the tunnels listening on the given ports, then
+// adds the new specs, replacing any tunnel already listening where one of
+// them does.
+func applyTunnelEdits(tunnels []config.Tunnel, add []string, remove []int) ([]config.Tunnel, error) {
+	for _, port := range remove {
+		found := false
+		for i, t := range tunnels {
+			if listenPort(t) == port {
+				tunnels = append(tunnels[:i], tunnels[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no tunnel listening on port %d", port)
+		}
+	}
+
+	added, err := parseTunnelSpecs(add)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range added {
+		tunnels = putTunnel(tunnels, t, -1)
+	}
+
+	return tunnels, nil
+}
+
+// putTunnel replaces tunnels[at], or the tunnel listening on the same
+// address, or else appends t.
+func putTunnel(tunnels []config.Tunnel, t config.Tunnel, at int) []config.Tunnel {
+	onServer := t.Kind() == config.TunnelRemote
+
+	for i, existing := range tunnels {
+		if i != at && (existing.Kind() == config.TunnelRemote) == onServer && existing.ListenAddr() == t.ListenAddr() {
+			tunnels = append(tunnels[:i], tunnels[i+1:]...)
+			if i < at {
+				at--
+			}
+			break
+		}
+	}
+
+	if at >= 0 {
+		tunnels[at] = t
+		return tunnels
+	}
+	return append(tunnels, t)
+}
+
+// editTunnelsInteractive lets the user add, change and delete tunnels and
+// reports whether to save the result.
+func editTunnelsInteractive(name string, tunnels []config.Tunnel) ([]config.Tunnel, bool) {
+	const (
+		addItem  = "➕ Add tunnel"
+		saveItem = "💾 Save"
+		quitItem = "✗ Cancel"
+	)
+
+	for {
+		items := make([]string, 0, len(tunnels)+3)
+		for _, t := range tunnels {
+			items = append(items, "🚇 "+describeTunnel(name, t))
+		}
+		items = append(items, addItem, saveItem, quitItem)
+
+		sel := promptui.Select{
+			Label: "Tunnels",
+			Items: items,
+			Size:  min(len(items), 12),
+		}
+
+		i, choice, err := sel.Run()
+		if err != nil {
+			return nil, false
+		}
+
+		switch choice {
+		case saveItem:
+			return tunnels, true
+		case quitItem:
+			return nil, false
+		case addItem:
+			kind := promptui.Select{
+				Label: "Kind",
+				Items: []string{
+					"Local (-L): a port here reaches a port from the server",
+					"Remote (-R): a port on the server reaches a port from here",
+					"Dynamic (-D): a SOCKS5 proxy here connects out through the server",
+				},
+			}
+			k, _, err := kind.Run()
+			if err != nil {
+				continue
+			}
+
+			t := config.Tunnel{Type: []string{"", config.TunnelRemote, config.TunnelDynamic}[k]}
+			if t, ok := promptTunnel(t); ok {
+				tunnels = putTunnel(tunnels, t, -1)
+			}
+			continue
+		}
+
+		action := promptui.Select{
+			Label: tunnels[i].String(),
+			Items: []string{"✏️  Edit", "🗑️  Delete", "↩ Back"},
+		}
+		a, _, err := action.Run()
+		if err != nil {
+			continue
+		}
+
+		switch a {
+		case 0:
+			if t, ok := promptTunnel(tunnels[i]); ok {
+				tunnels = putTunnel(tunnels, t, i)
+			}
+		case 1:
+			tunnels = append(tunnels[:i], tunnels[i+1:]...)
+		}
+	}
+}
+
+// promptTunnel asks for the fields of a tunnel of t's kind, starting from t.
+func promptTunnel(t config.Tunnel) (config.Tunnel, bool) {
+	validPort := func(input string) error {
+		port, err := strconv.Atoi(input)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("enter a port between 1 and 65535")
+		}
+		return nil
+	}
+
+	portDefault := func(port int) string {
+		if port == 0 {
+			return ""
+		}
+		return strconv.Itoa(port)
+	}
+
+	askPort := func(label string, port *int) bool {
+		input, err := (&promptui.Prompt{Label: label, Default: portDefault(*port), Validate: validPort}).Run()
+		if err != nil {
+			return false
+		}
+		*port, _ = strconv.Atoi(input)
+		return true
+	}
+
+	askHost := func(label string, host *string, def string) bool {
+		input, err := (&promptui.Prompt{Label: label, Default: orDefault(*host, def)}).Run()
+		if err != nil {
+			return false
+		}
+		*host = strings.TrimSpace(input)
+		return true
+	}
+
+	var ok bool
+	switch t.Kind() {
+	case config.TunnelRemote:
+		ok = askPort("🔌 Remote Port (listens on the server)", &t.Remote) &&
+			askHost("🌐 Local Host (as seen from here)", &t.LocalHost, config.DefaultRemoteHost) &&
+			askPort("🎯 Local Port", &t.Local) &&
+			askHost("📍 Bind Address (on the server)", &t.BindAddress, config.DefaultBindAddress)
+	case config.TunnelDynamic:
+		ok = askPort("🔌 Local Port (SOCKS5 proxy)", &t.Local) &&
+			askHost("📍 Bind Address", &t.BindAddress, config.DefaultBindAddress)
+	default:
+		ok = askPort("🔌 Local Port", &t.Local) &&
+			askHost("🌐 Remote Host (as seen from the server)", &t.RemoteHost, config.DefaultRemoteHost) &&
+			askPort("🎯 Remote Port", &t.Remote) &&
+			askHost("📍 Bind Address", &t.BindAddress, config.DefaultBindAddress)
+	}
+	if !ok {
+		return t, false
+	}
+
+	// Round trip through the spec to drop defaults the way ParseTunnel does
+	t, err := config.ParseTunnel(t.String())
+	if err != nil {
+		return t, false
+	}
+
+	return t, true
+}
+
+// describeTunnel shows which way t forwards through the connection name.
+func describeTunnel(name string, t config.Tunnel) string {
+	switch t.Kind() {
+	case config.TunnelRemote:
+		return fmt.Sprintf("\033[1;36m%s\033[0m:\033[1;35m%s\033[0m → here → %s", name, t.ListenAddr(), t.TargetAddr())
+	case config.TunnelDynamic:
+		return fmt.Sprintf("\033[1;35m%s\033[0m (SOCKS5) → \033[1;36m%s\033[0m → anywhere", t.ListenAddr(), name)
+	}
+	return fmt.Sprintf("\033[1;35m%s\033[0m → \033[1;36m%s\033[0m → %s", t.ListenAddr(), name, t.TargetAddr())
+}
+
+// listenPort is the port t listens on, here or on the server.
+func listenPort(t config.Tunnel) int {
+	if t.Kind() == config.TunnelRemote {
+		return t.Remote
+	}
+	return t.Local
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+func tunnelSpecs(tunnels []config.Tunnel) string {
+	specs := make([]string, 0, len(tunnels))
+	for _, t := range tunnels {
+		specs = append(specs, t.String())
+	}
+	return strings.Join(specs, ", ")
+}
+
+var tunnelManagerCmd = &cobra.Command{
+	Use:    "manager",
+	Short:  "Run the tunnel manager in the foreground",
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := tunnel.Serve(); err != nil {
+			fmt.Printf("\n❌ Tunnel manager failed: %v\n\n", err)
+			os.Exit(1)
 		}
 	},
 }
 
 func init() {
+	tunnelUpCmd.Flags().BoolP("all", "a", false, "Open the saved tunnels of all connections")
+	tunnelUpCmd.Flags().StringP("tag", "t", "", "Open the saved tunnels of connections with specific tag")
+	tunnelDownCmd.Flags().BoolP("all", "a", false, "Close every tunnel of the active profile")
+	tunnelStatusCmd.Flags().Bool("line", false, "Print a one-line summary for shell prompts")
+	tunnelCmd.Flags().StringArrayP("local", "L", nil, "Forward [bind:]local:host:remote from here through the server (repeatable)")
+	tunnelCmd.Flags().StringArrayP("remote", "R", nil, "Forward [bind:]remote:host:local from the server back through here (repeatable)")
+	tunnelCmd.Flags().StringArrayP("dynamic", "D", nil, "Run a SOCKS5 proxy on [bind:]local through the server (repeatable)")
+	tunnelEditCmd.Flags().StringArray("add", nil, "Add a tunnel as [bind:]local:host:remote, R:[bind:]remote:host:local or D:[bind:]local (repeatable)")
+	tunnelEditCmd.Flags().IntSlice("remove", nil, "Remove the tunnel listening on this port (repeatable)")
+
+	tunnelCmd.AddCommand(tunnelUpCmd)
+	tunnelCmd.AddCommand(tunnelDownCmd)
+	tunnelCmd.AddCommand(tunnelStopCmd)
+	tunnelCmd.AddCommand(tunnelStatusCmd)
+	tunnelCmd.AddCommand(tunnelEditCmd)
+	tunnelCmd.AddCommand(tunnelManagerCmd)
+
 	rootCmd.AddCommand(tunnelCmd)
 }
@@ -3,148 +3,117 @@ package main
 import (
 	"fmt"
 	"os"
-	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/paramientos/leap/internal/config"
+	leapssh "github.com/paramientos/leap/internal/ssh"
+	"github.com/paramientos/leap/internal/transfer"
+	"github.com/paramientos/leap/internal/utils"
 	"github.com/spf13/cobra"
 )
 
 var uploadCmd = &cobra.Command{
-	Use:   "upload [name] [local-path] [remote-path]",
+	Use:   "upload [name] [local-path...] [remote-path]",
 	Short: "Upload file(s) to remote server",
-	Args:  cobra.ExactArgs(3),
-
+	Args:  cobra.MinimumNArgs(3),
 	Run: func(cmd *cobra.Command, args []string) {
-		name := args[0]
-		localPath := args[1]
-		remotePath := args[2]
-
-		cfg, err := config.LoadConfig(GetPassphrase())
-
-		if err != nil {
-			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
-			return
-		}
-
-		conn, ok := cfg.Connections[name]
-
-		if !ok {
-			fmt.Printf("\n❌ Connection '\033[1;36m%s\033[0m' not found.\n", name)
-			fmt.Println("\033[90mTip: Use 'leap list' to see all available connections\033[0m\n")
-
-			return
-		}
-
-		fmt.Println("\n⚡ \033[1;32mFile Upload\033[0m")
-		fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
-		fmt.Printf("\n\033[90mFrom:\033[0m \033[1;35m%s\033[0m\n", localPath)
-		fmt.Printf("\033[90mTo:\033[0m   \033[1;36m%s\033[0m:\033[1;35m%s\033[0m\n\n", conn.Name, remotePath)
-
-		scpArgs := []string{}
-
-		if conn.IdentityFile != "" {
-			scpArgs = append(scpArgs, "-i", conn.IdentityFile)
-		}
-
-		scpArgs = append(scpArgs, "-P", fmt.Sprintf("%d", conn.Port))
-
-		if conn.JumpHost != "" {
-			scpArgs = append(scpArgs, "-o", fmt.Sprintf("ProxyJump=%s", conn.JumpHost))
-		}
-
-		recursive, _ := cmd.Flags().GetBool("recursive")
-		if recursive {
-			scpArgs = append(scpArgs, "-r")
-		}
-
-		scpArgs = append(scpArgs, localPath)
-		scpArgs = append(scpArgs, fmt.Sprintf("%s@%s:%s", conn.User, conn.Host, remotePath))
-
-		scpCmd := exec.Command("scp", scpArgs...)
-		scpCmd.Stdout = os.Stdout
-		scpCmd.Stderr = os.Stderr
-		scpCmd.Stdin = os.Stdin
-
-		err = scpCmd.Run()
-
-		if err != nil {
-			fmt.Printf("\n❌ Upload failed: %v\n\n", err)
-			return
-		}
-
-		fmt.Println("\n\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
-		fmt.Printf("\n\033[32m✓\033[0m Upload completed successfully\n\n")
+		runTransfer(cmd, args[0], true, args[1:len(args)-1], args[len(args)-1])
 	},
 }
 
 var downloadCmd = &cobra.Command{
-	Use:   "download [name] [remote-path] [local-path]",
+	Use:   "download [name] [remote-path...] [local-path]",
 	Short: "Download file(s) from remote server",
-	Args:  cobra.ExactArgs(3),
-	Run: func(cmd *cobra.Command, args []string) {
-		name := args[0]
-		remotePath := args[1]
-		localPath := args[2]
-
-		cfg, err := config.LoadConfig(GetPassphrase())
-		if err != nil {
-			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
-			return
-		}
-
-		conn, ok := cfg.Connections[name]
-		if !ok {
-			fmt.Printf("\n❌ Connection '\033[1;36m%s\033[0m' not found.\n", name)
-			fmt.Println("\033[90mTip: Use 'leap list' to see all available connections\033[0m\n")
-			return
-		}
-
-		fmt.Println("\n⚡ \033[1;32mFile Download\033[0m")
-		fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
-		fmt.Printf("\n\033[90mFrom:\033[0m \033[1;36m%s\033[0m:\033[1;35m%s\033[0m\n", conn.Name, remotePath)
-		fmt.Printf("\033[90mTo:\033[0m   \033[1;35m%s\033[0m\n\n", localPath)
-
-		scpArgs := []string{}
-
-		if conn.IdentityFile != "" {
-			scpArgs = append(scpArgs, "-i", conn.IdentityFile)
-		}
-
-		scpArgs = append(scpArgs, "-P", fmt.Sprintf("%d", conn.Port))
-
-		if conn.JumpHost != "" {
-			scpArgs = append(scpArgs, "-o", fmt.Sprintf("ProxyJump=%s", conn.JumpHost))
-		}
-
-		recursive, _ := cmd.Flags().GetBool("recursive")
-
-		if recursive {
-			scpArgs = append(scpArgs, "-r")
-		}
-
-		scpArgs = append(scpArgs, fmt.Sprintf("%s@%s:%s", conn.User, conn.Host, remotePath))
-		scpArgs = append(scpArgs, localPath)
-
-		scpCmd := exec.Command("scp", scpArgs...)
-		scpCmd.Stdout = os.Stdout
-		scpCmd.Stderr = os.Stderr
-		scpCmd.Stdin = os.Stdin
+	Long: `Download file(s) from remote server.
 
-		err = scpCmd.Run()
+Remote paths may contain globs; quote them so your local shell leaves them alone:
+  leap download myserver '/var/log/*.log' ./logs/`,
+	Args: cobra.MinimumNArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTransfer(cmd, args[0], false, args[1:len(args)-1], args[len(args)-1])
+	},
+}
 
-		if err != nil {
-			fmt.Printf("\n❌ Download failed: %v\n\n", err)
-			return
+// runTransfer copies between the local machine and a saved connection over
+// SFTP, honoring --recursive and --no-verify.
+func runTransfer(cmd *cobra.Command, name string, upload bool, sources []string, dest string) {
+	recursive, _ := cmd.Flags().GetBool("recursive")
+	noVerify, _ := cmd.Flags().GetBool("no-verify")
+
+	cfg, err := config.LoadConfig(GetPassphrase())
+	if err != nil {
+		fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+		return
+	}
+
+	conn, ok := cfg.Connections[name]
+	if !ok {
+		fmt.Printf("\n❌ Connection '\033[1;36m%s\033[0m' not found.\n", name)
+		fmt.Print("\033[90mTip: Use 'leap list' to see all available connections\033[0m\n\n")
+		return
+	}
+
+	title, verb := "File Download", "Download"
+	from := fmt.Sprintf("\033[1;36m%s\033[0m:\033[1;35m%s\033[0m", conn.Name, strings.Join(sources, " "))
+	to := fmt.Sprintf("\033[1;35m%s\033[0m", dest)
+	if upload {
+		title, verb = "File Upload", "Upload"
+		from = fmt.Sprintf("\033[1;35m%s\033[0m", strings.Join(sources, " "))
+		to = fmt.Sprintf("\033[1;36m%s\033[0m:\033[1;35m%s\033[0m", conn.Name, dest)
+	}
+
+	fmt.Printf("\n⚡ \033[1;32m%s\033[0m\n", title)
+	fmt.Println("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+	fmt.Printf("\n\033[90mFrom:\033[0m %s\n", from)
+	fmt.Printf("\033[90mTo:\033[0m   %s\n\n", to)
+
+	session, err := transfer.Open(conn, leapssh.DialOptions{
+		Config:      cfg,
+		Timeout:     15 * time.Second,
+		Interactive: true,
+	})
+	if err != nil {
+		fmt.Printf("❌ Connection failed: %v\n\n", err)
+		return
+	}
+	defer session.Close()
+
+	opts := transfer.Options{Recursive: recursive, Verify: !noVerify, Out: os.Stdout}
+
+	var stats transfer.Stats
+	if upload {
+		stats, err = session.Upload(sources, dest, opts)
+	} else {
+		stats, err = session.Download(sources, dest, opts)
+	}
+
+	fmt.Println("\n\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+
+	if err != nil {
+		fmt.Printf("\n❌ %s failed: %v\n", verb, err)
+		if stats.Partial > 0 {
+			fmt.Print("\033[90mTip: Run the same command again to resume partial files\033[0m\n")
 		}
+		fmt.Println()
+		return
+	}
+
+	fmt.Printf("\n\033[32m✓\033[0m %s completed: %d file(s), %s", verb, stats.Files, utils.FormatBytes(stats.Bytes))
+	if stats.Resumed > 0 {
+		fmt.Printf(", %d resumed", stats.Resumed)
+	}
+	fmt.Print("\n\n")
+}
 
-		fmt.Println("\n\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
-		fmt.Printf("\n\033[32m✓\033[0m Download completed successfully\n\n")
-	},
+func addTransferFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("recursive", "r", false, "Copy directories recursively")
+	cmd.Flags().Bool("no-verify", false, "Skip SHA-256 verification after each file")
 }
 
 func init() {
-	uploadCmd.Flags().BoolP("recursive", "r", false, "Upload directory recursively")
-	downloadCmd.Flags().BoolP("recursive", "r", false, "Download directory recursively")
+	addTransferFlags(uploadCmd)
+	addTransferFlags(downloadCmd)
 
 	rootCmd.AddCommand(uploadCmd)
 	rootCmd.AddCommand(downloadCmd)
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/paramientos/leap/internal/config"
+	"github.com/paramientos/leap/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var vaultCmd = &cobra.Command{
+	Use:   "vault",
+	Short: "Manage how the connection vault is encrypted",
+}
+
+var vaultRecipientsCmd = &cobra.Command{
+	Use:     "recipients",
+	Aliases: []string{"recipient"},
+	Short:   "Manage the age/ssh public keys that can open the vault",
+}
+
+var vaultRecipientsListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List vault recipients",
+	Run: func(cmd *cobra.Command, args []string) {
+		recipients, err := config.LoadRecipients()
+		if err != nil {
+			fmt.Printf("\n❌ Error reading recipients: %v\n\n", err)
+			return
+		}
+
+		fmt.Println("\n⚡ \033[1;32mVault Recipients\033[0m")
+		fmt.Print("\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m\n\n")
+
+		if len(recipients) == 0 {
+			fmt.Println("  \033[90mNo recipients. The vault is encrypted with your master password.\033[0m")
+			fmt.Println("  \033[90mTip: Use 'leap vault recipients add [public-key]' to share it\033[0m")
+		}
+
+		local := config.LocalRecipient()
+		for i, r := range recipients {
+			marker := ""
+			if r == local {
+				marker = " \033[32m(you)\033[0m"
+			}
+			fmt.Printf("  [%d] \033[1;36m%s\033[0m%s\n", i+1, r, marker)
+		}
+
+		fmt.Println("\n\033[90m━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\033[0m")
+		fmt.Printf("\033[90mIdentity file: %s\033[0m\n\n", config.GetIdentityPath())
+	},
+}
+
+var vaultRecipientsAddCmd = &cobra.Command{
+	Use:   "add [public-key|file...]",
+	Short: "Encrypt the vault to additional age or ssh public keys",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var added []string
+		for _, arg := range args {
+			keys, err := readRecipientArg(arg)
+			if err != nil {
+				fmt.Printf("\n❌ %v\n\n", err)
+				return
+			}
+			added = append(added, keys...)
+		}
+
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		recipients, err := config.LoadRecipients()
+		if err != nil {
+			fmt.Printf("\n❌ Error reading recipients: %v\n\n", err)
+			return
+		}
+
+		// Switching away from the master password: make sure we can still open the vault
+		if len(recipients) == 0 {
+			self, err := config.EnsureIdentity()
+			if err != nil {
+				fmt.Printf("\n❌ Failed to prepare local identity: %v\n\n", err)
+				return
+			}
+
+			fmt.Printf("\n🔑 Using local identity \033[1;36m%s\033[0m\n", config.GetIdentityPath())
+			recipients = append(recipients, self)
+		}
+
+		for _, key := range added {
+			if containsString(recipients, key) {
+				fmt.Printf("\033[90m⊘ Already a recipient: %s\033[0m\n", key)
+				continue
+			}
+			recipients = append(recipients, key)
+			fmt.Printf("\033[32m✓\033[0m Added \033[1;36m%s\033[0m\n", key)
+		}
+
+		if err := config.SetRecipients(cfg, recipients, ""); err != nil {
+			fmt.Printf("\n❌ Failed to re-encrypt vault: %v\n\n", err)
+			return
+		}
+
+		fmt.Printf("\n\033[32m✓\033[0m Vault re-encrypted to \033[1m%d\033[0m recipient(s)\n\n", len(recipients))
+	},
+}
+
+var vaultRecipientsRemoveCmd = &cobra.Command{
+	Use:     "remove [public-key|index]",
+	Aliases: []string{"rm"},
+	Short:   "Stop encrypting the vault to a public key",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		recipients, err := config.LoadRecipients()
+		if err != nil {
+			fmt.Printf("\n❌ Error reading recipients: %v\n\n", err)
+			return
+		}
+
+		target := strings.TrimSpace(args[0])
+		if i, err := strconv.Atoi(target); err == nil && i >= 1 && i <= len(recipients) {
+			target = recipients[i-1]
+		}
+
+		if !containsString(recipients, target) {
+			fmt.Printf("\n❌ Recipient \033[1;36m%s\033[0m not found.\n\n", target)
+			return
+		}
+
+		cfg, err := config.LoadConfig(GetPassphrase())
+		if err != nil {
+			fmt.Printf("\n❌ Error loading config: %v\n\n", err)
+			return
+		}
+
+		var remaining []string
+		for _, r := range recipients {
+			if r != target {
+				remaining = append(remaining, r)
+			}
+		}
+
+		if target == config.LocalRecipient() && len(remaining) > 0 {
+			prompt := promptui.Prompt{
+				Label:     "This is your own key. You will no longer be able to open the vault. Continue",
+				IsConfirm: true,
+			}
+			result, err := prompt.Run()
+			if err != nil || strings.ToLower(result) != "y" {
+				fmt.Print("\n\033[90m⊘ Nothing changed\033[0m\n\n")
+				return
+			}
+		}
+
+		passphrase := ""
+		if len(remaining) == 0 {
+			fmt.Println("\n🔒 No recipients left. The vault will be encrypted with a master password again.")
+
+			prompt := promptui.Prompt{
+				Label: "🔒 Set Master Password",
+				Mask:  '*',
+				Validate: func(input string) error {
+					if len(input) < 4 {
+						return fmt.Errorf("password must be at least 4 characters")
+					}
+					return nil
+				},
+			}
+
+			passphrase, err = prompt.Run()
+			if err != nil {
+				return
+			}
+		}
+
+		if err := config.SetRecipients(cfg, remaining, passphrase); err != nil {
+			fmt.Printf("\n❌ Failed to re-encrypt vault: %v\n\n", err)
+			return
+		}
+
+		fmt.Printf("\n\033[32m✓\033[0m Removed \033[1;36m%s\033[0m\n", target)
+		fmt.Println("\033[90mNote: Copies of the vault made before this change can still be opened with that key.\033[0m")
+		fmt.Println()
+	},
+}
+
+// readRecipientArg accepts a public key or a path to a file of public keys.
+func readRecipientArg(arg string) ([]string, error) {
+	lines := []string{arg}
+
+	if data, err := os.ReadFile(arg); err == nil {
+		lines = strings.Split(string(data), "\n")
+	}
+
+	var keys []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if _, err := utils.ParseRecipient(line); err != nil {
+			return nil, err
+		}
+
+		// Drop ssh key comments so the same key is never listed twice
+		if fields := strings.Fields(line); strings.HasPrefix(line, "ssh-") && len(fields) > 2 {
+			line = fields[0] + " " + fields[1]
+		}
+
+		keys = append(keys, line)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys found in %s", arg)
+	}
+
+	return keys, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func init() {
+	vaultRecipientsCmd.AddCommand(vaultRecipientsListCmd)
+	vaultRecipientsCmd.AddCommand(vaultRecipientsAddCmd)
+	vaultRecipientsCmd.AddCommand(vaultRecipientsRemoveCmd)
+	vaultCmd.AddCommand(vaultRecipientsCmd)
+
+	rootCmd.AddCommand(vaultCmd)
+}
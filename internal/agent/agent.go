@@ -0,0 +1,282 @@
+// Package agent implements a small ssh-agent style daemon that keeps vault
+// passphrases in memory behind a user-only Unix socket.
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultIdleTimeout matches the old session cache window.
+const DefaultIdleTimeout = 5 * time.Minute
+
+type request struct {
+	Op         string `json:"op"`
+	Vault      string `json:"vault,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+type response struct {
+	OK          bool     `json:"ok"`
+	Error       string   `json:"error,omitempty"`
+	Passphrase  string   `json:"passphrase,omitempty"`
+	Unlocked    []string `json:"unlocked,omitempty"`
+	IdleTimeout string   `json:"idle_timeout,omitempty"`
+	ExpiresIn   string   `json:"expires_in,omitempty"`
+	PID         int      `json:"pid,omitempty"`
+}
+
+// Status describes a running agent.
+type Status struct {
+	PID         int
+	Unlocked    []string
+	IdleTimeout string
+	ExpiresIn   string
+}
+
+// SocketPath returns the control socket of the agent.
+func SocketPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".leap", "agent.sock")
+}
+
+type server struct {
+	mu          sync.Mutex
+	secrets     map[string][]byte
+	idleTimeout time.Duration
+	lastUsed    time.Time
+	listener    net.Listener
+}
+
+// Serve runs the agent in the foreground until it is stopped or stays idle
+// for idleTimeout (0 disables the timeout). On idle timeout every passphrase
+// is wiped and the agent exits.
+func Serve(idleTimeout time.Duration) error {
+	path := SocketPath()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	if Running() {
+		return fmt.Errorf("an agent is already running on %s", path)
+	}
+	os.Remove(path) // stale socket from a crashed agent
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+
+	s := &server{
+		secrets:     make(map[string][]byte),
+		idleTimeout: idleTimeout,
+		lastUsed:    time.Now(),
+		listener:    listener,
+	}
+
+	if idleTimeout > 0 {
+		go s.watchIdle()
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.wipe("")
+			return nil
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *server) watchIdle() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		idle := time.Since(s.lastUsed) >= s.idleTimeout
+		s.mu.Unlock()
+
+		if idle {
+			s.listener.Close()
+			return
+		}
+	}
+}
+
+func (s *server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return
+	}
+
+	if err := CheckPeer(unixConn); err != nil {
+		json.NewEncoder(conn).Encode(response{Error: err.Error()})
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		return
+	}
+
+	json.NewEncoder(conn).Encode(s.dispatch(req))
+}
+
+func (s *server) dispatch(req request) response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch req.Op {
+	case "get":
+		secret, ok := s.secrets[req.Vault]
+		if !ok {
+			return response{Error: "locked"}
+		}
+		s.lastUsed = time.Now()
+		return response{OK: true, Passphrase: string(secret)}
+
+	case "set":
+		if req.Vault == "" || req.Passphrase == "" {
+			return response{Error: "vault and passphrase are required"}
+		}
+		s.wipeLocked(req.Vault)
+		s.secrets[req.Vault] = []byte(req.Passphrase)
+		s.lastUsed = time.Now()
+		return response{OK: true}
+
+	case "lock":
+		s.wipeLocked(req.Vault)
+		return response{OK: true}
+
+	case "status":
+		res := response{OK: true, PID: os.Getpid()}
+		for vault := range s.secrets {
+			res.Unlocked = append(res.Unlocked, vault)
+		}
+		sort.Strings(res.Unlocked)
+
+		if s.idleTimeout > 0 {
+			res.IdleTimeout = s.idleTimeout.String()
+			res.ExpiresIn = (s.idleTimeout - time.Since(s.lastUsed)).Round(time.Second).String()
+		}
+		return res
+
+	case "stop":
+		go s.listener.Close()
+		return response{OK: true}
+	}
+
+	return response{Error: fmt.Sprintf("unknown operation %q", req.Op)}
+}
+
+// wipe forgets the passphrase of vault, or every passphrase when vault is empty.
+func (s *server) wipe(vault string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wipeLocked(vault)
+}
+
+func (s *server) wipeLocked(vault string) {
+	for name, secret := range s.secrets {
+		if vault != "" && name != vault {
+			continue
+		}
+
+		for i := range secret {
+			secret[i] = 0
+		}
+		delete(s.secrets, name)
+	}
+}
+
+func call(req request) (response, error) {
+	conn, err := net.DialTimeout("unix", SocketPath(), time.Second)
+	if err != nil {
+		return response{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return response{}, err
+	}
+
+	var res response
+	if err := json.NewDecoder(conn).Decode(&res); err != nil {
+		return response{}, err
+	}
+
+	if !res.OK {
+		return res, fmt.Errorf("agent: %s", res.Error)
+	}
+
+	return res, nil
+}
+
+// Running reports whether an agent answers on the socket.
+func Running() bool {
+	_, err := call(request{Op: "status"})
+	return err == nil
+}
+
+// Get returns the cached passphrase for vault.
+func Get(vault string) (string, error) {
+	res, err := call(request{Op: "get", Vault: vault})
+	if err != nil {
+		return "", err
+	}
+
+	return res.Passphrase, nil
+}
+
+// Set stores the passphrase for vault in the agent.
+func Set(vault, passphrase string) error {
+	_, err := call(request{Op: "set", Vault: vault, Passphrase: passphrase})
+	return err
+}
+
+// Lock makes the agent forget vault's passphrase, or all of them if vault is empty.
+func Lock(vault string) error {
+	_, err := call(request{Op: "lock", Vault: vault})
+	return err
+}
+
+// Stop shuts the agent down, wiping every passphrase.
+func Stop() error {
+	_, err := call(request{Op: "stop"})
+	return err
+}
+
+// GetStatus reports what the running agent holds.
+func GetStatus() (*Status, error) {
+	res, err := call(request{Op: "status"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Status{
+		PID:         res.PID,
+		Unlocked:    res.Unlocked,
+		IdleTimeout: res.IdleTimeout,
+		ExpiresIn:   res.ExpiresIn,
+	}, nil
+}
@@ -0,0 +1,38 @@
+//go:build darwin || freebsd
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// CheckPeer rejects connections from processes owned by another user.
+func CheckPeer(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var cred *unix.Xucred
+	var credErr error
+
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	})
+	if err != nil {
+		return err
+	}
+	if credErr != nil {
+		return credErr
+	}
+
+	if int(cred.Uid) != os.Getuid() {
+		return fmt.Errorf("permission denied for uid %d", cred.Uid)
+	}
+
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+
+package agent
+
+import "net"
+
+// CheckPeer relies on the socket living in the user-only ~/.leap directory
+// on platforms without peer credential support.
+func CheckPeer(conn *net.UnixConn) error {
+	return nil
+}
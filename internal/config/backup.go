@@ -0,0 +1,177 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/paramientos/leap/internal/utils"
+)
+
+// MaxBackups is how many previous versions of the vault are kept.
+const MaxBackups = 10
+
+const backupTimeFormat = "20060102-150405.000"
+
+// Backup is an encrypted copy of the vault taken just before it was overwritten.
+type Backup struct {
+	Path string
+	Time time.Time
+	Size int64
+}
+
+// GetBackupDir returns the directory holding vault backups.
+func GetBackupDir() string {
+	return filepath.Join(filepath.Dir(GetConfigPath()), "backups")
+}
+
+// ListBackups returns the available backups, newest first.
+func ListBackups() ([]Backup, error) {
+	entries, err := os.ReadDir(GetBackupDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, suffix := backupAffixes()
+
+	var backups []Backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		t, err := time.ParseInLocation(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffix), time.Local)
+		if err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, Backup{
+			Path: filepath.Join(GetBackupDir(), name),
+			Time: t,
+			Size: info.Size(),
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+
+	return backups, nil
+}
+
+// LoadBackup decrypts a backup with the same credentials as the live vault.
+func LoadBackup(path, passphrase string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted, err := decryptVault(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := decodeConfig(decrypted)
+	return cfg, err
+}
+
+// RestoreBackup replaces the vault with the contents of a backup. The current
+// vault is backed up first, so a restore can itself be undone.
+func RestoreBackup(path, passphrase string) error {
+	cfg, err := LoadBackup(path, passphrase)
+	if err != nil {
+		return err
+	}
+
+	return withLock(func() error {
+		return saveConfig(cfg, passphrase, true)
+	})
+}
+
+func backupAffixes() (string, string) {
+	base := filepath.Base(GetConfigPath())
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-", ".age"
+}
+
+// backupVault copies the current vault into the backup directory and prunes
+// the oldest copies beyond MaxBackups. The copy is as encrypted as the vault.
+func backupVault() error {
+	data, err := os.ReadFile(GetConfigPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	dir := GetBackupDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	prefix, suffix := backupAffixes()
+	name := prefix + time.Now().Format(backupTimeFormat) + suffix
+
+	if err := writeFileAtomic(filepath.Join(dir, name), data, 0600); err != nil {
+		return err
+	}
+
+	backups, err := ListBackups()
+	if err != nil {
+		return err
+	}
+
+	for i := MaxBackups; i < len(backups); i++ {
+		os.Remove(backups[i].Path)
+	}
+
+	return nil
+}
+
+// reencryptBackups moves backups from oldPassphrase to newPassphrase so an
+// old master password cannot open them. Backups it cannot decrypt are left alone.
+func reencryptBackups(oldPassphrase, newPassphrase string) error {
+	backups, err := ListBackups()
+	if err != nil {
+		return err
+	}
+
+	for _, backup := range backups {
+		data, err := os.ReadFile(backup.Path)
+		if err != nil {
+			return err
+		}
+
+		if !utils.IsPassphraseEncrypted(data) {
+			continue
+		}
+
+		decrypted, err := utils.Decrypt(data, oldPassphrase)
+		if err != nil {
+			continue
+		}
+
+		encrypted, err := utils.Encrypt(decrypted, newPassphrase)
+		if err != nil {
+			return fmt.Errorf("failed to re-encrypt backup %s: %v", filepath.Base(backup.Path), err)
+		}
+
+		if err := writeFileAtomic(backup.Path, encrypted, 0600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
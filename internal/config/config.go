@@ -7,46 +7,87 @@ import (
 	"path/filepath"
 	"time"
 
+	"filippo.io/age"
 	"github.com/paramientos/leap/internal/utils"
 	"gopkg.in/yaml.v3"
 )
 
 type Connection struct {
-	Name         string    `yaml:"name"`
-	Host         string    `yaml:"host"`
-	User         string    `yaml:"user"`
-	Port         int       `yaml:"port"`
-	Password     string    `yaml:"password,omitempty"`
-	IdentityFile string    `yaml:"identity_file,omitempty"`
-	Tags         []string  `yaml:"tags,omitempty"`
-	JumpHost     string    `yaml:"jump_host,omitempty"`
-	Tunnels      []Tunnel  `yaml:"tunnels,omitempty"`
-	LastUsed     time.Time `yaml:"last_used,omitempty"`
-	Favorite     bool      `yaml:"favorite,omitempty"`
-	Notes        string    `yaml:"notes,omitempty"`
-	UsageCount   int       `yaml:"usage_count,omitempty"`
-	Group        string    `yaml:"group,omitempty"`
-	CreatedAt    time.Time `yaml:"created_at,omitempty"`
+	Name            string    `yaml:"name"`
+	Host            string    `yaml:"host"`
+	User            string    `yaml:"user"`
+	Port            int       `yaml:"port"`
+	Password        string    `yaml:"password,omitempty"`
+	PasswordCommand string    `yaml:"password_command,omitempty"`
+	IdentityFile    string    `yaml:"identity_file,omitempty"`
+	CertificateFile string    `yaml:"certificate_file,omitempty"`
+	KeyPassphrase   string    `yaml:"key_passphrase,omitempty"`
+	TOTPSecret      string    `yaml:"totp_secret,omitempty"`
+	Tags            []string  `yaml:"tags,omitempty"`
+	JumpHost        string    `yaml:"jump_host,omitempty"`
+	Tunnels         []Tunnel  `yaml:"tunnels,omitempty"`
+	LastUsed        time.Time `yaml:"last_used,omitempty"`
+	Favorite        bool      `yaml:"favorite,omitempty"`
+	Notes           string    `yaml:"notes,omitempty"`
+	UsageCount      int       `yaml:"usage_count,omitempty"`
+	Group           string    `yaml:"group,omitempty"`
+	CreatedAt       time.Time `yaml:"created_at,omitempty"`
+
+	// SudoPassword and SudoPasswordCommand answer sudo for --sudo; without
+	// them the login password is used.
+	SudoPassword        string `yaml:"sudo_password,omitempty"`
+	SudoPasswordCommand string `yaml:"sudo_password_command,omitempty"`
 }
 
+// Tunnel is a port forward carried by a connection. A local tunnel, the
+// default, is ssh -L [bind_address:]local:remote_host:remote; a remote one is
+// ssh -R [bind_address:]remote:local_host:local; a dynamic one is a SOCKS5
+// proxy on the local port, like ssh -D [bind_address:]local.
 type Tunnel struct {
-	Local  int `yaml:"local"`
-	Remote int `yaml:"remote"`
+	Type   string `yaml:"type,omitempty"`
+	Local  int    `yaml:"local,omitempty"`
+	Remote int    `yaml:"remote,omitempty"`
+	// BindAddress is where the listening side binds; empty means 127.0.0.1.
+	BindAddress string `yaml:"bind_address,omitempty"`
+	// RemoteHost is dialed from the server; empty means localhost.
+	RemoteHost string `yaml:"remote_host,omitempty"`
+	// LocalHost is dialed from here by remote tunnels; empty means localhost.
+	LocalHost string `yaml:"local_host,omitempty"`
 }
 
 type Config struct {
+	Version     int                   `yaml:"version"`
+	Groups      map[string]Group      `yaml:"groups,omitempty"`
 	Connections map[string]Connection `yaml:"connections"`
+
+	// raw holds connections as stored, before group defaults were applied
+	raw map[string]Connection
 }
 
+// GetConfigPath returns the vault of the active profile.
 func GetConfigPath() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".leap", "connections.yaml")
+	return GetProfileConfigPath(ActiveProfile())
 }
 
+// LoadConfig decrypts the vault and upgrades it to CurrentVersion in memory.
+// The upgraded document is written back on the next save.
 func LoadConfig(passphrase string) (*Config, error) {
+	data, err := readVault(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := decodeConfig(data)
+	return cfg, err
+}
+
+// readVault returns the decrypted vault document, or an empty one if the
+// vault does not exist yet. Legacy plain-text files are returned as is and
+// get encrypted on the next save.
+func readVault(passphrase string) ([]byte, error) {
 	path := GetConfigPath()
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return &Config{Connections: make(map[string]Connection)}, nil
+		return nil, nil
 	}
 
 	data, err := os.ReadFile(path)
@@ -54,38 +95,71 @@ func LoadConfig(passphrase string) (*Config, error) {
 		return nil, err
 	}
 
-	// Always expect encryption with "age"
 	if bytes.HasPrefix(data, []byte("age-encryption.org")) {
-		if passphrase == "" {
-			return nil, fmt.Errorf("PassphraseRequired")
-		}
-		decrypted, err := utils.Decrypt(data, passphrase)
-		if err != nil {
-			return nil, fmt.Errorf("invalid master password")
+		return decryptVault(data, passphrase)
+	}
+
+	return data, nil
+}
+
+// decryptVault tries the local identity file first and falls back to the
+// master password for passphrase-encrypted vaults.
+func decryptVault(data []byte, passphrase string) ([]byte, error) {
+	if identities, err := loadIdentities(); err == nil {
+		if decrypted, err := utils.DecryptWithIdentities(data, identities...); err == nil {
+			return decrypted, nil
 		}
-		data = decrypted
-	} else {
-		// Migration: If file is not encrypted yet, we will encrypt it on next save
 	}
 
-	var cfg Config
-	err = yaml.Unmarshal(data, &cfg)
-	if err != nil {
-		return nil, err
+	if !utils.IsPassphraseEncrypted(data) {
+		return nil, fmt.Errorf("vault is encrypted to age recipients and no key in %s can decrypt it", GetIdentityPath())
+	}
+
+	if passphrase == "" {
+		return nil, fmt.Errorf("PassphraseRequired")
 	}
 
-	if cfg.Connections == nil {
-		cfg.Connections = make(map[string]Connection)
+	decrypted, err := utils.Decrypt(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid master password")
 	}
 
-	return &cfg, nil
+	return decrypted, nil
 }
 
+// SaveConfig encrypts cfg to the configured recipients, or with passphrase
+// when the vault has none. Use Update for load-modify-save cycles.
 func SaveConfig(cfg *Config, passphrase string) error {
+	return withLock(func() error {
+		return saveConfig(cfg, passphrase, true)
+	})
+}
+
+// saveConfig writes cfg, backing up the current vault first when backup is
+// set.
+func saveConfig(cfg *Config, passphrase string, backup bool) error {
+	recipients, err := LoadRecipients()
+	if err != nil {
+		return err
+	}
+
+	if len(recipients) > 0 {
+		parsed, err := parseRecipients(recipients)
+		if err != nil {
+			return err
+		}
+
+		return writeConfig(cfg, parsed, "", backup)
+	}
+
 	if passphrase == "" {
 		return fmt.Errorf("master password is required to save configuration")
 	}
 
+	return writeConfig(cfg, nil, passphrase, backup)
+}
+
+func writeConfig(cfg *Config, recipients []age.Recipient, passphrase string, backup bool) error {
 	path := GetConfigPath()
 	dir := filepath.Dir(path)
 
@@ -96,19 +170,101 @@ func SaveConfig(cfg *Config, passphrase string) error {
 		}
 	}
 
-	data, err := yaml.Marshal(cfg)
+	cfg.Version = CurrentVersion
+
+	data, err := yaml.Marshal(cfg.stored())
 	if err != nil {
 		return err
 	}
 
 	// ALWAYS ENCRYPT
-	encrypted, err := utils.Encrypt(data, passphrase)
+	var encrypted []byte
+	if len(recipients) > 0 {
+		encrypted, err = utils.EncryptToRecipients(data, recipients...)
+	} else {
+		encrypted, err = utils.Encrypt(data, passphrase)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to encrypt config: %v", err)
 	}
 	data = encrypted
 
-	return os.WriteFile(path, data, 0600)
+	if backup {
+		if err := backupVault(); err != nil {
+			return fmt.Errorf("failed to back up config: %v", err)
+		}
+	}
+
+	return writeFileAtomic(path, data, 0600)
+}
+
+// ChangePassphrase verifies oldPassphrase against the vault and re-encrypts
+// it under newPassphrase. The vault is replaced atomically, so a failure
+// leaves the old file untouched.
+func ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	if newPassphrase == "" {
+		return fmt.Errorf("new master password must not be empty")
+	}
+
+	if UsesRecipients() {
+		return fmt.Errorf("the vault is encrypted to age recipients, not a master password")
+	}
+
+	return withLock(func() error {
+		cfg, err := LoadConfig(oldPassphrase)
+		if err != nil {
+			return err
+		}
+
+		if err := saveConfig(cfg, newPassphrase, true); err != nil {
+			return err
+		}
+
+		return reencryptBackups(oldPassphrase, newPassphrase)
+	})
+}
+
+// writeFileAtomic writes data to a temporary file next to path, syncs it and
+// renames it into place, so readers never observe a partially written file
+// and a crash leaves either the old or the new contents.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Best effort: the rename is already visible, this only makes it durable
+	syncDir(filepath.Dir(path))
+
+	return nil
 }
 
 func (cfg *Config) UpdateLastUsed(name string) {
@@ -119,6 +275,20 @@ func (cfg *Config) UpdateLastUsed(name string) {
 	}
 }
 
+// withoutUsage serializes cfg as it would be saved, minus the usage stats
+// bumped on every connect, to tell real edits from bookkeeping.
+func (cfg *Config) withoutUsage() ([]byte, error) {
+	out := *cfg
+	out.Connections = make(map[string]Connection, len(cfg.Connections))
+	for name, conn := range cfg.Connections {
+		conn.LastUsed = time.Time{}
+		conn.UsageCount = 0
+		out.Connections[name] = conn
+	}
+
+	return yaml.Marshal(out.stored())
+}
+
 func (cfg *Config) DeleteConnection(name string) bool {
 	if _, ok := cfg.Connections[name]; ok {
 		delete(cfg.Connections, name)
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Group holds defaults for the connections in it. A connection in
+// "prod/eu/db" inherits from "prod/eu/db", then "prod/eu", then "prod".
+type Group struct {
+	User         string   `yaml:"user,omitempty"`
+	Port         int      `yaml:"port,omitempty"`
+	IdentityFile string   `yaml:"identity_file,omitempty"`
+	JumpHost     string   `yaml:"jump_host,omitempty"`
+	Tags         []string `yaml:"tags,omitempty"`
+	Tunnels      []Tunnel `yaml:"tunnels,omitempty"`
+}
+
+// Sources of a resolved value, as reported by Config.Origins.
+const (
+	SourceConnection = "connection"
+	SourceDefault    = "default"
+	sourceGroup      = "group "
+)
+
+// NormalizeGroupPath trims blanks and empty segments: " prod / eu/ " is "prod/eu".
+func NormalizeGroupPath(path string) string {
+	var parts []string
+	for _, part := range strings.Split(path, "/") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// GroupChain returns path and its parents, most specific first.
+func GroupChain(path string) []string {
+	path = NormalizeGroupPath(path)
+
+	var chain []string
+	for path != "" {
+		chain = append(chain, path)
+
+		i := strings.LastIndex(path, "/")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+
+	return chain
+}
+
+// Origins reports where each inheritable field of a connection comes from:
+// SourceConnection, SourceDefault or "group <path>".
+func (cfg *Config) Origins(name string) map[string]string {
+	conn, ok := cfg.raw[name]
+	if !ok {
+		conn = cfg.Connections[name]
+	}
+
+	_, origins := cfg.resolve(conn)
+	return origins
+}
+
+// Defaults returns the values a new connection in group would inherit.
+func (cfg *Config) Defaults(group string) Connection {
+	conn, _ := cfg.resolve(Connection{Group: NormalizeGroupPath(group)})
+	return conn
+}
+
+// resolve fills the fields conn leaves empty from its groups. Tags are
+// merged from every level; all other fields come from the nearest group
+// that sets them.
+func (cfg *Config) resolve(conn Connection) (Connection, map[string]string) {
+	origins := map[string]string{
+		"User":         SourceConnection,
+		"Port":         SourceConnection,
+		"IdentityFile": SourceConnection,
+		"JumpHost":     SourceConnection,
+		"Tunnels":      SourceConnection,
+	}
+
+	chain := GroupChain(conn.Group)
+
+	inherit := func(field string, empty bool, set func(g Group) bool) {
+		if !empty {
+			return
+		}
+
+		origins[field] = ""
+		for _, path := range chain {
+			if g, ok := cfg.Groups[path]; ok && set(g) {
+				origins[field] = sourceGroup + path
+				return
+			}
+		}
+	}
+
+	inherit("User", conn.User == "", func(g Group) bool {
+		conn.User = g.User
+		return g.User != ""
+	})
+	inherit("Port", conn.Port == 0, func(g Group) bool {
+		conn.Port = g.Port
+		return g.Port != 0
+	})
+	inherit("IdentityFile", conn.IdentityFile == "", func(g Group) bool {
+		conn.IdentityFile = g.IdentityFile
+		return g.IdentityFile != ""
+	})
+	inherit("JumpHost", conn.JumpHost == "", func(g Group) bool {
+		// A group's jump host must not jump through itself
+		if g.JumpHost == "" || containsSpec(g.JumpHost, conn.Name) {
+			conn.JumpHost = ""
+			return false
+		}
+		conn.JumpHost = g.JumpHost
+		return true
+	})
+	inherit("Tunnels", len(conn.Tunnels) == 0, func(g Group) bool {
+		conn.Tunnels = g.Tunnels
+		return len(g.Tunnels) > 0
+	})
+
+	if conn.Port == 0 {
+		conn.Port = 22
+		origins["Port"] = SourceDefault
+	}
+
+	// Tags accumulate from the outermost group inwards
+	var tags, tagSources []string
+	seen := make(map[string]bool)
+	add := func(list []string) {
+		for _, tag := range list {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		if g, ok := cfg.Groups[chain[i]]; ok && len(g.Tags) > 0 {
+			add(g.Tags)
+			tagSources = append(tagSources, sourceGroup+chain[i])
+		}
+	}
+	add(conn.Tags)
+	if len(conn.Tags) > 0 {
+		tagSources = append(tagSources, SourceConnection)
+	}
+	conn.Tags = tags
+	origins["Tags"] = strings.Join(tagSources, ", ")
+
+	return conn, origins
+}
+
+// applyGroups replaces every connection with its resolved form, keeping the
+// stored form so saving does not bake inherited values into connections.
+func (cfg *Config) applyGroups() {
+	cfg.raw = make(map[string]Connection, len(cfg.Connections))
+
+	for name, conn := range cfg.Connections {
+		conn.Group = NormalizeGroupPath(conn.Group)
+		cfg.raw[name] = conn
+		cfg.Connections[name], _ = cfg.resolve(conn)
+	}
+}
+
+// stored returns a copy of cfg in which values equal to what a connection
+// would inherit anyway are left empty, unless the connection set them itself.
+func (cfg *Config) stored() *Config {
+	out := *cfg
+	out.Connections = make(map[string]Connection, len(cfg.Connections))
+
+	for name, conn := range cfg.Connections {
+		raw, hadRaw := cfg.raw[name]
+
+		conn.Group = NormalizeGroupPath(conn.Group)
+
+		base := Connection{Name: conn.Name, Group: conn.Group}
+		inherited, _ := cfg.resolve(base)
+
+		keep := func(same, explicit bool) bool {
+			return !same || (hadRaw && explicit)
+		}
+
+		if !keep(conn.User == inherited.User, raw.User != "") {
+			conn.User = ""
+		}
+		if !keep(conn.Port == inherited.Port, raw.Port != 0) {
+			conn.Port = 0
+		}
+		if !keep(conn.IdentityFile == inherited.IdentityFile, raw.IdentityFile != "") {
+			conn.IdentityFile = ""
+		}
+		if !keep(conn.JumpHost == inherited.JumpHost, raw.JumpHost != "") {
+			conn.JumpHost = ""
+		}
+		if !keep(reflect.DeepEqual(conn.Tunnels, inherited.Tunnels), len(raw.Tunnels) > 0) {
+			conn.Tunnels = nil
+		}
+
+		// Keep only the tags the groups do not already contribute
+		groupTags := make(map[string]bool)
+		for _, tag := range inherited.Tags {
+			groupTags[tag] = true
+		}
+		ownTags := make(map[string]bool)
+		for _, tag := range raw.Tags {
+			ownTags[tag] = true
+		}
+
+		var tags []string
+		for _, tag := range conn.Tags {
+			if !groupTags[tag] || ownTags[tag] {
+				tags = append(tags, tag)
+			}
+		}
+		conn.Tags = tags
+
+		out.Connections[name] = conn
+	}
+
+	return &out
+}
+
+func containsSpec(specs, name string) bool {
+	for _, spec := range strings.Split(specs, ",") {
+		if strings.TrimSpace(spec) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetGroup stores the defaults of a group and re-resolves the connections
+// that inherit from it.
+func (cfg *Config) SetGroup(path string, g Group) {
+	if cfg.Groups == nil {
+		cfg.Groups = make(map[string]Group)
+	}
+
+	cfg.Groups[NormalizeGroupPath(path)] = g
+	cfg.regroup()
+}
+
+// DeleteGroup removes the defaults of a group. With keepValues the member
+// connections keep what they inherited as their own values.
+func (cfg *Config) DeleteGroup(path string, keepValues bool) bool {
+	path = NormalizeGroupPath(path)
+	if _, ok := cfg.Groups[path]; !ok {
+		return false
+	}
+
+	delete(cfg.Groups, path)
+	if !keepValues {
+		cfg.regroup()
+	}
+
+	return true
+}
+
+// regroup resolves stored connections again after group defaults changed.
+func (cfg *Config) regroup() {
+	for name, raw := range cfg.raw {
+		if _, ok := cfg.Connections[name]; ok {
+			cfg.Connections[name], _ = cfg.resolve(raw)
+		}
+	}
+}
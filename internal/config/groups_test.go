@@ -0,0 +1,184 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestNormalizeGroupPath(t *testing.T) {
+	tests := map[string]string{
+		"":               "",
+		"prod":           "prod",
+		" prod / eu/ ":   "prod/eu",
+		"/prod//eu/db/":  "prod/eu/db",
+		" / ":            "",
+		"prod / eu west": "prod/eu west",
+	}
+
+	for in, want := range tests {
+		if got := NormalizeGroupPath(in); got != want {
+			t.Errorf("NormalizeGroupPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestGroupChain(t *testing.T) {
+	got := GroupChain("prod / eu / db")
+	want := []string{"prod/eu/db", "prod/eu", "prod"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupChain = %q, want %q", got, want)
+	}
+
+	if got := GroupChain(""); got != nil {
+		t.Errorf("GroupChain(\"\") = %q, want nil", got)
+	}
+}
+
+func testGroups() *Config {
+	return &Config{
+		Groups: map[string]Group{
+			"prod":    {User: "deploy", Port: 2222, Tags: []string{"prod"}, JumpHost: "bastion"},
+			"prod/eu": {User: "eu-admin", Tags: []string{"eu", "prod"}},
+		},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		conn    Connection
+		want    Connection
+		origins map[string]string
+	}{
+		{
+			name: "nearest group wins",
+			conn: Connection{Name: "db", Group: "prod/eu"},
+			want: Connection{Name: "db", Group: "prod/eu", User: "eu-admin", Port: 2222, JumpHost: "bastion", Tags: []string{"prod", "eu"}},
+			origins: map[string]string{
+				"User":     "group prod/eu",
+				"Port":     "group prod",
+				"JumpHost": "group prod",
+				"Tags":     "group prod, group prod/eu",
+			},
+		},
+		{
+			name: "connection values win",
+			conn: Connection{Name: "db", Group: "prod/eu", User: "root", Port: 22, Tags: []string{"db"}},
+			want: Connection{Name: "db", Group: "prod/eu", User: "root", Port: 22, JumpHost: "bastion", Tags: []string{"prod", "eu", "db"}},
+			origins: map[string]string{
+				"User": SourceConnection,
+				"Port": SourceConnection,
+				"Tags": "group prod, group prod/eu, connection",
+			},
+		},
+		{
+			name: "jump host never points at itself",
+			conn: Connection{Name: "bastion", Group: "prod"},
+			want: Connection{Name: "bastion", Group: "prod", User: "deploy", Port: 2222, Tags: []string{"prod"}},
+			origins: map[string]string{
+				"JumpHost": "",
+			},
+		},
+		{
+			name: "no group",
+			conn: Connection{Name: "home"},
+			want: Connection{Name: "home", Port: 22},
+			origins: map[string]string{
+				"User": "",
+				"Port": SourceDefault,
+			},
+		},
+	}
+
+	cfg := testGroups()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, origins := cfg.resolve(tt.conn)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolve = %+v, want %+v", got, tt.want)
+			}
+			for field, want := range tt.origins {
+				if origins[field] != want {
+					t.Errorf("origin of %s = %q, want %q", field, origins[field], want)
+				}
+			}
+		})
+	}
+}
+
+func TestStoredRoundTrip(t *testing.T) {
+	doc := `version: 2
+groups:
+  prod:
+    user: deploy
+    port: 2222
+    tags: [prod]
+connections:
+  web:
+    name: web
+    host: web.example.com
+    group: prod
+  db:
+    name: db
+    host: db.example.com
+    user: deploy
+    group: prod
+    tags: [prod, db]
+`
+
+	cfg, _, err := decodeConfig([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if web := cfg.Connections["web"]; web.User != "deploy" || web.Port != 2222 {
+		t.Fatalf("web resolved to %+v", web)
+	}
+
+	stored := cfg.stored()
+
+	// Inherited values are not baked into the connection
+	if web := stored.Connections["web"]; web.User != "" || web.Port != 0 || len(web.Tags) != 0 {
+		t.Errorf("web stored as %+v, want inherited fields empty", web)
+	}
+
+	// Values the connection set itself survive even when they match the group
+	if db := stored.Connections["db"]; db.User != "deploy" || !reflect.DeepEqual(db.Tags, []string{"prod", "db"}) {
+		t.Errorf("db stored as %+v, want its own user and tags kept", db)
+	}
+
+	data, err := yaml.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _, err := decodeConfig(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again.Connections, cfg.Connections) {
+		t.Errorf("round trip changed connections:\n got %+v\nwant %+v", again.Connections, cfg.Connections)
+	}
+}
+
+func TestStoredKeepsChangesAfterGroupEdit(t *testing.T) {
+	cfg := testGroups()
+	cfg.Connections = map[string]Connection{"db": {Name: "db", Group: "prod/eu"}}
+	cfg.applyGroups()
+
+	// Editing a resolved connection to something else stores the new value
+	db := cfg.Connections["db"]
+	db.User = "postgres"
+	cfg.Connections["db"] = db
+
+	if got := cfg.stored().Connections["db"].User; got != "postgres" {
+		t.Errorf("stored user = %q, want postgres", got)
+	}
+
+	// Removing a group re-resolves its members from their stored form
+	cfg.DeleteGroup("prod/eu", false)
+	if got := cfg.Connections["db"].User; got != "deploy" {
+		t.Errorf("user after deleting prod/eu = %q, want deploy", got)
+	}
+}
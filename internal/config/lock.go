@@ -0,0 +1,82 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockTimeout bounds how long a leap process waits for another one to finish
+// writing the vault.
+const lockTimeout = 10 * time.Second
+
+// GetLockPath returns the advisory lock file guarding connections.yaml.
+func GetLockPath() string {
+	return GetConfigPath() + ".lock"
+}
+
+// withLock runs fn while holding the vault lock. The lock is not reentrant,
+// so fn must not call SaveConfig or Update.
+func withLock(fn func() error) error {
+	path := GetLockPath()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			return fmt.Errorf("failed to lock %s: %v", path, err)
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("config is locked by another leap process (%s)", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	defer unlockFile(f)
+
+	return fn()
+}
+
+// Update loads the vault, applies fn and saves the result while holding the
+// lock, so concurrent leap processes never overwrite each other's changes.
+// Returning an error from fn aborts without saving. Saves that only touch
+// usage stats are not backed up, so connecting doesn't rotate out the
+// backups worth restoring.
+func Update(passphrase string, fn func(cfg *Config) error) error {
+	return withLock(func() error {
+		cfg, err := LoadConfig(passphrase)
+		if err != nil {
+			return err
+		}
+
+		before, err := cfg.withoutUsage()
+		if err != nil {
+			return err
+		}
+
+		if err := fn(cfg); err != nil {
+			return err
+		}
+
+		after, err := cfg.withoutUsage()
+		if err != nil {
+			return err
+		}
+
+		return saveConfig(cfg, passphrase, !bytes.Equal(before, after))
+	})
+}
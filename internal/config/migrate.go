@@ -0,0 +1,234 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the schema version written by this build.
+const CurrentVersion = 2
+
+// Migration upgrades a decoded document from version From to From+1.
+// Migrations work on the generic YAML map so they can read fields that no
+// longer exist on Config.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(doc map[string]interface{}) error
+}
+
+// migrations holds one step per version, indexed by Migration.From.
+var migrations = map[int]Migration{}
+
+func registerMigration(m Migration) {
+	if _, ok := migrations[m.From]; ok {
+		panic(fmt.Sprintf("config: duplicate migration from version %d", m.From))
+	}
+	migrations[m.From] = m
+}
+
+func init() {
+	registerMigration(Migration{
+		From:        0,
+		Description: "Add the schema version and fill in missing connection names",
+		Apply: func(doc map[string]interface{}) error {
+			conns, _ := doc["connections"].(map[string]interface{})
+			for key, raw := range conns {
+				conn, ok := raw.(map[string]interface{})
+				if !ok {
+					continue
+				}
+
+				// A missing port stays unset so group defaults can apply;
+				// resolve falls back to 22
+				if name, _ := conn["name"].(string); name == "" {
+					conn["name"] = key
+				}
+			}
+
+			return nil
+		},
+	})
+
+	registerMigration(Migration{
+		From:        1,
+		Description: "Introduce group defaults and normalize group paths like \"prod / eu\" to \"prod/eu\"",
+		Apply: func(doc map[string]interface{}) error {
+			conns, _ := doc["connections"].(map[string]interface{})
+			for _, raw := range conns {
+				conn, ok := raw.(map[string]interface{})
+				if !ok {
+					continue
+				}
+
+				if group, ok := conn["group"].(string); ok {
+					if group = NormalizeGroupPath(group); group != "" {
+						conn["group"] = group
+					} else {
+						delete(conn, "group")
+					}
+				}
+			}
+
+			return nil
+		},
+	})
+}
+
+// documentVersion returns the schema version of doc; unversioned documents are 0.
+func documentVersion(doc map[string]interface{}) (int, error) {
+	raw, ok := doc["version"]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+
+	version, ok := raw.(int)
+	if !ok {
+		return 0, fmt.Errorf("invalid config version %v", raw)
+	}
+
+	return version, nil
+}
+
+// migrate upgrades doc in place to CurrentVersion and returns the
+// descriptions of the steps it ran.
+func migrate(doc map[string]interface{}) ([]string, error) {
+	version, err := documentVersion(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if version > CurrentVersion {
+		return nil, fmt.Errorf("config version %d is newer than this leap supports (%d); please upgrade leap", version, CurrentVersion)
+	}
+
+	var steps []string
+	for ; version < CurrentVersion; version++ {
+		m, ok := migrations[version]
+		if !ok {
+			return nil, fmt.Errorf("no migration from config version %d", version)
+		}
+
+		if err := m.Apply(doc); err != nil {
+			return nil, fmt.Errorf("migration v%d → v%d failed: %v", version, version+1, err)
+		}
+
+		doc["version"] = version + 1
+		steps = append(steps, fmt.Sprintf("v%d → v%d: %s", version, version+1, m.Description))
+	}
+
+	return steps, nil
+}
+
+// decodeConfig parses a decrypted document, migrating it to CurrentVersion.
+func decodeConfig(data []byte) (*Config, []string, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+
+	steps, err := migrate(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(steps) > 0 {
+		if data, err = yaml.Marshal(doc); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.Connections == nil {
+		cfg.Connections = make(map[string]Connection)
+	}
+
+	cfg.applyGroups()
+
+	return &cfg, steps, nil
+}
+
+// MigrationPlan describes what migrating the vault to CurrentVersion changes.
+type MigrationPlan struct {
+	From   int
+	To     int
+	Steps  []string
+	Before string
+	After  string
+}
+
+// PlanMigration reports how the stored vault would be upgraded without
+// writing anything.
+func PlanMigration(passphrase string) (*MigrationPlan, error) {
+	data, err := readVault(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+
+	from, err := documentVersion(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, steps, err := decodeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Version = CurrentVersion
+	after, err := yaml.Marshal(cfg.stored())
+	if err != nil {
+		return nil, err
+	}
+
+	return &MigrationPlan{
+		From:   from,
+		To:     CurrentVersion,
+		Steps:  steps,
+		Before: string(data),
+		After:  string(after),
+	}, nil
+}
+
+// MigrateVault upgrades the stored vault to CurrentVersion. The previous
+// version is kept as a backup like any other save.
+func MigrateVault(passphrase string) (*MigrationPlan, error) {
+	var plan *MigrationPlan
+
+	err := withLock(func() error {
+		var err error
+		plan, err = PlanMigration(passphrase)
+		if err != nil {
+			return err
+		}
+
+		if plan.Before == plan.After {
+			return nil
+		}
+
+		cfg, _, err := decodeConfig([]byte(plan.Before))
+		if err != nil {
+			return err
+		}
+
+		return saveConfig(cfg, passphrase, true)
+	})
+
+	return plan, err
+}
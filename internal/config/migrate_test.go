@@ -0,0 +1,182 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMigrationsCoverEveryVersion(t *testing.T) {
+	for v := 0; v < CurrentVersion; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			t.Fatalf("no migration from version %d", v)
+		}
+		if m.From != v {
+			t.Errorf("migration registered under %d has From %d", v, m.From)
+		}
+		if m.Description == "" {
+			t.Errorf("migration from version %d has no description", v)
+		}
+	}
+}
+
+func TestRegisterMigrationDuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a second migration from version 0 did not panic")
+		}
+	}()
+
+	registerMigration(Migration{From: 0, Apply: func(map[string]interface{}) error { return nil }})
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		steps   int
+		wantErr string
+		check   func(t *testing.T, doc map[string]interface{})
+	}{
+		{
+			name:  "unversioned",
+			doc:   "connections:\n  web:\n    host: example.com\n    group: ' prod / eu/ '\n",
+			steps: 2,
+			check: func(t *testing.T, doc map[string]interface{}) {
+				conn := doc["connections"].(map[string]interface{})["web"].(map[string]interface{})
+				if conn["name"] != "web" {
+					t.Errorf("name = %v, want web", conn["name"])
+				}
+				if _, ok := conn["port"]; ok {
+					t.Errorf("port = %v, want it left unset", conn["port"])
+				}
+				if conn["group"] != "prod/eu" {
+					t.Errorf("group = %v, want prod/eu", conn["group"])
+				}
+			},
+		},
+		{
+			name:  "blank group dropped",
+			doc:   "version: 1\nconnections:\n  web:\n    name: web\n    group: ' / '\n",
+			steps: 1,
+			check: func(t *testing.T, doc map[string]interface{}) {
+				conn := doc["connections"].(map[string]interface{})["web"].(map[string]interface{})
+				if _, ok := conn["group"]; ok {
+					t.Errorf("group = %v, want it removed", conn["group"])
+				}
+			},
+		},
+		{
+			name: "current",
+			doc:  "version: 2\nconnections: {}\n",
+		},
+		{
+			name:    "newer",
+			doc:     "version: 99\n",
+			wantErr: "newer than this leap supports",
+		},
+		{
+			name:    "invalid version",
+			doc:     "version: two\n",
+			wantErr: "invalid config version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tt.doc), &doc); err != nil {
+				t.Fatal(err)
+			}
+
+			steps, err := migrate(doc)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(steps) != tt.steps {
+				t.Errorf("ran %d steps, want %d: %q", len(steps), tt.steps, steps)
+			}
+			if doc["version"] != CurrentVersion {
+				t.Errorf("version = %v, want %d", doc["version"], CurrentVersion)
+			}
+			if tt.check != nil {
+				tt.check(t, doc)
+			}
+		})
+	}
+}
+
+func TestMigratedConnectionsInheritGroupPort(t *testing.T) {
+	cfg, _, err := decodeConfig([]byte("connections:\n  web:\n    host: example.com\n    group: prod\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if port := cfg.Connections["web"].Port; port != 22 {
+		t.Errorf("port = %d, want the default 22", port)
+	}
+
+	cfg.SetGroup("prod", Group{Port: 2222})
+	if port := cfg.Connections["web"].Port; port != 2222 {
+		t.Errorf("port after setting a group default = %d, want 2222", port)
+	}
+}
+
+func TestPlanMigration(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("LEAP_PROFILE", "")
+
+	legacy := "connections:\n  web:\n    host: example.com\n    user: deploy\n"
+	path := GetConfigPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := PlanMigration("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.From != 0 || plan.To != CurrentVersion {
+		t.Errorf("plan is v%d → v%d, want v0 → v%d", plan.From, plan.To, CurrentVersion)
+	}
+	if len(plan.Steps) != CurrentVersion {
+		t.Errorf("plan has %d steps, want %d", len(plan.Steps), CurrentVersion)
+	}
+	if plan.Before != legacy {
+		t.Errorf("Before = %q, want the stored document", plan.Before)
+	}
+
+	var after Config
+	if err := yaml.Unmarshal([]byte(plan.After), &after); err != nil {
+		t.Fatal(err)
+	}
+	if after.Version != CurrentVersion {
+		t.Errorf("After has version %d, want %d", after.Version, CurrentVersion)
+	}
+	if conn := after.Connections["web"]; conn.Name != "web" || conn.Port != 0 || conn.User != "deploy" {
+		t.Errorf("After has connection %+v", conn)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != legacy {
+		t.Error("PlanMigration modified the vault")
+	}
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultProfile lives directly in ~/.leap, so existing installs keep working.
+const DefaultProfile = "default"
+
+var (
+	profileOverride string
+	profileNameRe   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+// GetBaseDir returns ~/.leap, which holds the default profile and state
+// shared by all profiles.
+func GetBaseDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".leap")
+}
+
+// SetProfile selects the profile for the rest of the process, taking
+// precedence over LEAP_PROFILE and the saved current profile.
+func SetProfile(name string) {
+	profileOverride = name
+}
+
+// ActiveProfile returns the selected profile: SetProfile, then LEAP_PROFILE,
+// then the profile chosen with 'leap profile switch'.
+func ActiveProfile() string {
+	if profileOverride != "" {
+		return profileOverride
+	}
+
+	if env := os.Getenv("LEAP_PROFILE"); env != "" {
+		return env
+	}
+
+	if data, err := os.ReadFile(currentProfilePath()); err == nil {
+		if name := strings.TrimSpace(string(data)); name != "" {
+			return name
+		}
+	}
+
+	return DefaultProfile
+}
+
+// GetProfileDir returns the directory holding a profile's vault, keys,
+// backups and history.
+func GetProfileDir(name string) string {
+	if name == DefaultProfile {
+		return GetBaseDir()
+	}
+
+	return filepath.Join(GetBaseDir(), "profiles", name)
+}
+
+// GetProfileConfigPath returns the vault of the named profile.
+func GetProfileConfigPath(name string) string {
+	return filepath.Join(GetProfileDir(name), "connections.yaml")
+}
+
+// GetConfigDir returns the directory of the active profile.
+func GetConfigDir() string {
+	return GetProfileDir(ActiveProfile())
+}
+
+// GetHistoryDir returns where session recordings of the active profile go.
+func GetHistoryDir() string {
+	return filepath.Join(GetConfigDir(), "history")
+}
+
+// ValidateProfileName rejects names that are unsafe as a directory name.
+func ValidateProfileName(name string) error {
+	if !profileNameRe.MatchString(name) {
+		return fmt.Errorf("invalid profile name '%s' (use letters, digits, '.', '_' and '-')", name)
+	}
+
+	return nil
+}
+
+// ProfileExists reports whether a profile has been created. The default
+// profile always exists; invalid names never do.
+func ProfileExists(name string) bool {
+	if name == DefaultProfile {
+		return true
+	}
+
+	dir, err := namedProfileDir(name)
+	if err != nil {
+		return false
+	}
+
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+// namedProfileDir returns the directory of a non-default profile after
+// checking that name cannot point outside ~/.leap/profiles.
+func namedProfileDir(name string) (string, error) {
+	if err := ValidateProfileName(name); err != nil {
+		return "", err
+	}
+
+	root := filepath.Join(GetBaseDir(), "profiles")
+	dir := GetProfileDir(name)
+	if rel, err := filepath.Rel(root, dir); err != nil || rel != name {
+		return "", fmt.Errorf("invalid profile name '%s'", name)
+	}
+
+	return dir, nil
+}
+
+// ListProfiles returns the default profile followed by the others in
+// alphabetical order.
+func ListProfiles() ([]string, error) {
+	profiles := []string{DefaultProfile}
+
+	entries, err := os.ReadDir(filepath.Join(GetBaseDir(), "profiles"))
+	if os.IsNotExist(err) {
+		return profiles, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && ValidateProfileName(entry.Name()) == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return append(profiles, names...), nil
+}
+
+// CreateProfile creates an empty profile directory. Its vault is written on
+// the first save.
+func CreateProfile(name string) error {
+	if err := ValidateProfileName(name); err != nil {
+		return err
+	}
+
+	if ProfileExists(name) {
+		return fmt.Errorf("profile '%s' already exists", name)
+	}
+
+	return os.MkdirAll(GetProfileDir(name), 0700)
+}
+
+// DeleteProfile removes a profile with its vault, backups and history.
+func DeleteProfile(name string) error {
+	if name == DefaultProfile {
+		return fmt.Errorf("the default profile cannot be deleted")
+	}
+
+	dir, err := namedProfileDir(name)
+	if err != nil {
+		return err
+	}
+
+	if !ProfileExists(name) {
+		return fmt.Errorf("profile '%s' does not exist", name)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	// Fall back to the default profile if the deleted one was selected
+	if data, err := os.ReadFile(currentProfilePath()); err == nil && strings.TrimSpace(string(data)) == name {
+		os.Remove(currentProfilePath())
+	}
+
+	return nil
+}
+
+// SwitchProfile makes name the profile used when neither --profile nor
+// LEAP_PROFILE is given.
+func SwitchProfile(name string) error {
+	if err := ValidateProfileName(name); err != nil {
+		return err
+	}
+
+	if !ProfileExists(name) {
+		return fmt.Errorf("profile '%s' does not exist", name)
+	}
+
+	if name == DefaultProfile {
+		if err := os.Remove(currentProfilePath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(GetBaseDir(), 0700); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(currentProfilePath(), []byte(name+"\n"), 0600)
+}
+
+func currentProfilePath() string {
+	return filepath.Join(GetBaseDir(), "current_profile")
+}
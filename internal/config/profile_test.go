@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfileNamesStayInProfilesDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("LEAP_PROFILE", "")
+
+	// Something a path-traversing name would reach
+	victim := filepath.Join(home, "keep")
+	if err := os.MkdirAll(filepath.Join(GetBaseDir(), "profiles"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(victim, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"..", "../x", "a/b", "../..", "../../keep", ".", ""} {
+		if err := ValidateProfileName(name); err == nil {
+			t.Errorf("ValidateProfileName(%q) accepted it", name)
+		}
+		if ProfileExists(name) {
+			t.Errorf("ProfileExists(%q) = true", name)
+		}
+		if err := DeleteProfile(name); err == nil {
+			t.Errorf("DeleteProfile(%q) succeeded", name)
+		}
+		if err := SwitchProfile(name); err == nil {
+			t.Errorf("SwitchProfile(%q) succeeded", name)
+		}
+	}
+
+	if _, err := os.Stat(victim); err != nil {
+		t.Fatalf("file outside the profiles directory is gone: %v", err)
+	}
+	if _, err := os.Stat(GetBaseDir()); err != nil {
+		t.Fatalf("%s is gone: %v", GetBaseDir(), err)
+	}
+}
+
+func TestCreateAndDeleteProfile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("LEAP_PROFILE", "")
+
+	if err := CreateProfile("work"); err != nil {
+		t.Fatal(err)
+	}
+	if !ProfileExists("work") {
+		t.Fatal("created profile does not exist")
+	}
+	if err := SwitchProfile("work"); err != nil {
+		t.Fatal(err)
+	}
+	if got := ActiveProfile(); got != "work" {
+		t.Errorf("ActiveProfile = %q, want work", got)
+	}
+
+	if err := DeleteProfile("work"); err != nil {
+		t.Fatal(err)
+	}
+	if ProfileExists("work") {
+		t.Error("deleted profile still exists")
+	}
+	if got := ActiveProfile(); got != DefaultProfile {
+		t.Errorf("ActiveProfile after delete = %q, want %s", got, DefaultProfile)
+	}
+	if err := DeleteProfile(DefaultProfile); err == nil {
+		t.Error("deleting the default profile succeeded")
+	}
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/paramientos/leap/internal/utils"
+)
+
+// GetRecipientsPath returns the file listing the public keys the vault is
+// encrypted to. When it is empty or missing, the master password is used.
+func GetRecipientsPath() string {
+	return filepath.Join(filepath.Dir(GetConfigPath()), "recipients.txt")
+}
+
+// GetIdentityPath returns the private key LoadConfig tries before asking for
+// the master password. It may hold age identities or an ssh private key.
+func GetIdentityPath() string {
+	return filepath.Join(filepath.Dir(GetConfigPath()), "identity.txt")
+}
+
+// LoadRecipients returns the configured recipients, one public key per entry.
+func LoadRecipients() ([]string, error) {
+	data, err := os.ReadFile(GetRecipientsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var recipients []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		recipients = append(recipients, line)
+	}
+
+	return recipients, scanner.Err()
+}
+
+// UsesRecipients reports whether the vault is encrypted to public keys rather
+// than the master password.
+func UsesRecipients() bool {
+	recipients, err := LoadRecipients()
+	return err == nil && len(recipients) > 0
+}
+
+// SetRecipients re-encrypts cfg to the given recipients and records them. An
+// empty list switches the vault back to passphrase encryption.
+func SetRecipients(cfg *Config, recipients []string, passphrase string) error {
+	return withLock(func() error {
+		return setRecipients(cfg, recipients, passphrase)
+	})
+}
+
+func setRecipients(cfg *Config, recipients []string, passphrase string) error {
+	if len(recipients) == 0 {
+		if passphrase == "" {
+			return fmt.Errorf("master password is required to switch back to passphrase encryption")
+		}
+
+		if err := writeConfig(cfg, nil, passphrase, true); err != nil {
+			return err
+		}
+
+		if err := os.Remove(GetRecipientsPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	parsed, err := parseRecipients(recipients)
+	if err != nil {
+		return err
+	}
+
+	// Write the vault first: a stale recipients file is harmless, an
+	// unreadable vault is not
+	if err := writeConfig(cfg, parsed, "", true); err != nil {
+		return err
+	}
+
+	data := "# Public keys the LEAP vault is encrypted to. Manage with 'leap vault recipients'.\n" +
+		strings.Join(recipients, "\n") + "\n"
+
+	return writeFileAtomic(GetRecipientsPath(), []byte(data), 0600)
+}
+
+// EnsureIdentity returns the local identity, generating an X25519 identity
+// at GetIdentityPath if none exists yet. The returned string is its public key.
+func EnsureIdentity() (string, error) {
+	path := GetIdentityPath()
+
+	if data, err := os.ReadFile(path); err == nil {
+		return identityRecipient(data)
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+
+	data := fmt.Sprintf("# LEAP vault identity\n# public key: %s\n%s\n", identity.Recipient(), identity)
+	if err := writeFileAtomic(path, []byte(data), 0600); err != nil {
+		return "", err
+	}
+
+	return identity.Recipient().String(), nil
+}
+
+// LocalRecipient returns the public key of the local identity, if any.
+func LocalRecipient() string {
+	data, err := os.ReadFile(GetIdentityPath())
+	if err != nil {
+		return ""
+	}
+
+	recipient, _ := identityRecipient(data)
+	return recipient
+}
+
+func identityRecipient(data []byte) (string, error) {
+	identities, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("%s does not contain an age identity: %v", GetIdentityPath(), err)
+	}
+
+	for _, identity := range identities {
+		if x, ok := identity.(*age.X25519Identity); ok {
+			return x.Recipient().String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("%s does not contain an X25519 identity", GetIdentityPath())
+}
+
+func loadIdentities() ([]age.Identity, error) {
+	data, err := os.ReadFile(GetIdentityPath())
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.ParseIdentities(data)
+}
+
+func parseRecipients(recipients []string) ([]age.Recipient, error) {
+	var parsed []age.Recipient
+	for _, r := range recipients {
+		recipient, err := utils.ParseRecipient(r)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, recipient)
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Kinds of Tunnel.
+const (
+	TunnelLocal   = "local"
+	TunnelRemote  = "remote"
+	TunnelDynamic = "dynamic"
+)
+
+// Defaults for the optional fields of a Tunnel.
+const (
+	DefaultBindAddress = "127.0.0.1"
+	DefaultRemoteHost  = "localhost"
+)
+
+// ParseTunnel parses a tunnel spec. A plain spec is ssh -L style:
+// [bind_address:]local:host:remote, or the short local:remote form. An "R:"
+// prefix makes it ssh -R style, R:[bind_address:]remote:host:local, and a
+// "D:" prefix a SOCKS5 proxy, D:[bind_address:]local. IPv6 addresses go in
+// brackets.
+func ParseTunnel(spec string) (Tunnel, error) {
+	spec = strings.TrimSpace(spec)
+
+	switch {
+	case strings.HasPrefix(spec, "R:"):
+		return parseRemoteTunnel(spec)
+	case strings.HasPrefix(spec, "D:"):
+		return parseDynamicTunnel(spec)
+	}
+
+	fields := splitSpec(strings.TrimPrefix(spec, "L:"))
+
+	var t Tunnel
+	var local, remote string
+
+	switch len(fields) {
+	case 2:
+		local, remote = fields[0], fields[1]
+	case 3:
+		local, t.RemoteHost, remote = fields[0], fields[1], fields[2]
+	case 4:
+		t.BindAddress, local, t.RemoteHost, remote = fields[0], fields[1], fields[2], fields[3]
+	default:
+		return Tunnel{}, fmt.Errorf("invalid tunnel '%s', expected [BIND:]LOCAL:HOST:REMOTE or LOCAL:REMOTE", spec)
+	}
+
+	var err error
+	if t.Local, err = parsePort(local); err != nil {
+		return Tunnel{}, fmt.Errorf("invalid tunnel '%s': local %v", spec, err)
+	}
+	if t.Remote, err = parsePort(remote); err != nil {
+		return Tunnel{}, fmt.Errorf("invalid tunnel '%s': remote %v", spec, err)
+	}
+
+	return t.normalize(), nil
+}
+
+func parseRemoteTunnel(spec string) (Tunnel, error) {
+	fields := splitSpec(strings.TrimPrefix(spec, "R:"))
+
+	t := Tunnel{Type: TunnelRemote}
+	var remote, local string
+
+	switch len(fields) {
+	case 2:
+		remote, local = fields[0], fields[1]
+	case 3:
+		remote, t.LocalHost, local = fields[0], fields[1], fields[2]
+	case 4:
+		t.BindAddress, remote, t.LocalHost, local = fields[0], fields[1], fields[2], fields[3]
+	default:
+		return Tunnel{}, fmt.Errorf("invalid tunnel '%s', expected R:[BIND:]REMOTE:HOST:LOCAL or R:REMOTE:LOCAL", spec)
+	}
+
+	var err error
+	if t.Remote, err = parsePort(remote); err != nil {
+		return Tunnel{}, fmt.Errorf("invalid tunnel '%s': remote %v", spec, err)
+	}
+	if t.Local, err = parsePort(local); err != nil {
+		return Tunnel{}, fmt.Errorf("invalid tunnel '%s': local %v", spec, err)
+	}
+
+	return t.normalize(), nil
+}
+
+func parseDynamicTunnel(spec string) (Tunnel, error) {
+	fields := splitSpec(strings.TrimPrefix(spec, "D:"))
+
+	t := Tunnel{Type: TunnelDynamic}
+	var local string
+
+	switch len(fields) {
+	case 1:
+		local = fields[0]
+	case 2:
+		t.BindAddress, local = fields[0], fields[1]
+	default:
+		return Tunnel{}, fmt.Errorf("invalid tunnel '%s', expected D:[BIND:]LOCAL", spec)
+	}
+
+	var err error
+	if t.Local, err = parsePort(local); err != nil {
+		return Tunnel{}, fmt.Errorf("invalid tunnel '%s': local %v", spec, err)
+	}
+
+	return t.normalize(), nil
+}
+
+// normalize empties fields holding their default, so equal tunnels compare
+// and save the same.
+func (t Tunnel) normalize() Tunnel {
+	if t.Type == TunnelLocal {
+		t.Type = ""
+	}
+	if t.BindAddress == DefaultBindAddress {
+		t.BindAddress = ""
+	}
+	if t.RemoteHost == DefaultRemoteHost {
+		t.RemoteHost = ""
+	}
+	if t.LocalHost == DefaultRemoteHost {
+		t.LocalHost = ""
+	}
+	return t
+}
+
+// Kind returns TunnelLocal, TunnelRemote or TunnelDynamic.
+func (t Tunnel) Kind() string {
+	if t.Type == "" {
+		return TunnelLocal
+	}
+	return t.Type
+}
+
+// String formats t as ParseTunnel accepts it, leaving out a default bind
+// address.
+func (t Tunnel) String() string {
+	var spec, prefix string
+
+	switch t.Kind() {
+	case TunnelRemote:
+		prefix = "R:"
+		spec = fmt.Sprintf("%d:%s:%d", t.Remote, bracket(t.localHost()), t.Local)
+	case TunnelDynamic:
+		prefix = "D:"
+		spec = strconv.Itoa(t.Local)
+	default:
+		spec = fmt.Sprintf("%d:%s:%d", t.Local, bracket(t.remoteHost()), t.Remote)
+	}
+
+	if t.BindAddress != "" {
+		spec = bracket(t.BindAddress) + ":" + spec
+	}
+	return prefix + spec
+}
+
+// ListenAddr is the address the tunnel listens on: on the server for a
+// remote tunnel, here otherwise.
+func (t Tunnel) ListenAddr() string {
+	bind := t.BindAddress
+	if bind == "" {
+		bind = DefaultBindAddress
+	}
+
+	port := t.Local
+	if t.Kind() == TunnelRemote {
+		port = t.Remote
+	}
+
+	return net.JoinHostPort(bind, strconv.Itoa(port))
+}
+
+// TargetAddr is the address connections are forwarded to: dialed by the
+// server for a local tunnel, from here for a remote one. Dynamic tunnels
+// have none; each SOCKS5 client names its own.
+func (t Tunnel) TargetAddr() string {
+	switch t.Kind() {
+	case TunnelRemote:
+		return net.JoinHostPort(t.localHost(), strconv.Itoa(t.Local))
+	case TunnelDynamic:
+		return ""
+	}
+	return net.JoinHostPort(t.remoteHost(), strconv.Itoa(t.Remote))
+}
+
+func (t Tunnel) remoteHost() string {
+	if t.RemoteHost == "" {
+		return DefaultRemoteHost
+	}
+	return t.RemoteHost
+}
+
+func (t Tunnel) localHost() string {
+	if t.LocalHost == "" {
+		return DefaultRemoteHost
+	}
+	return t.LocalHost
+}
+
+// splitSpec splits on colons outside of [brackets], dropping the brackets.
+func splitSpec(spec string) []string {
+	var fields []string
+	var field strings.Builder
+	depth := 0
+
+	for _, r := range spec {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		case r == ':' && depth == 0:
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteRune(r)
+		}
+	}
+
+	return append(fields, field.String())
+}
+
+func bracket(host string) string {
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("port '%s' is not between 1 and 65535", s)
+	}
+	return port, nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTunnel(t *testing.T) {
+	tests := []struct {
+		spec   string
+		want   Tunnel
+		str    string
+		listen string
+		target string
+	}{
+		{
+			spec:   "8080:80",
+			want:   Tunnel{Local: 8080, Remote: 80},
+			str:    "8080:localhost:80",
+			listen: "127.0.0.1:8080",
+			target: "localhost:80",
+		},
+		{
+			spec:   "5432:db.internal:5432",
+			want:   Tunnel{Local: 5432, Remote: 5432, RemoteHost: "db.internal"},
+			str:    "5432:db.internal:5432",
+			listen: "127.0.0.1:5432",
+			target: "db.internal:5432",
+		},
+		{
+			spec:   "L:0.0.0.0:8080:localhost:80",
+			want:   Tunnel{Local: 8080, Remote: 80, BindAddress: "0.0.0.0"},
+			str:    "0.0.0.0:8080:localhost:80",
+			listen: "0.0.0.0:8080",
+			target: "localhost:80",
+		},
+		{
+			spec:   "127.0.0.1:8080:localhost:80",
+			want:   Tunnel{Local: 8080, Remote: 80},
+			str:    "8080:localhost:80",
+			listen: "127.0.0.1:8080",
+			target: "localhost:80",
+		},
+		{
+			spec:   "[::1]:8080:[fd00::5]:80",
+			want:   Tunnel{Local: 8080, Remote: 80, BindAddress: "::1", RemoteHost: "fd00::5"},
+			str:    "[::1]:8080:[fd00::5]:80",
+			listen: "[::1]:8080",
+			target: "[fd00::5]:80",
+		},
+		{
+			spec:   "R:9000:3000",
+			want:   Tunnel{Type: TunnelRemote, Remote: 9000, Local: 3000},
+			str:    "R:9000:localhost:3000",
+			listen: "127.0.0.1:9000",
+			target: "localhost:3000",
+		},
+		{
+			spec:   "R:[::]:9000:[::1]:3000",
+			want:   Tunnel{Type: TunnelRemote, Remote: 9000, Local: 3000, BindAddress: "::", LocalHost: "::1"},
+			str:    "R:[::]:9000:[::1]:3000",
+			listen: "[::]:9000",
+			target: "[::1]:3000",
+		},
+		{
+			spec:   "D:1080",
+			want:   Tunnel{Type: TunnelDynamic, Local: 1080},
+			str:    "D:1080",
+			listen: "127.0.0.1:1080",
+		},
+		{
+			spec:   "D:[::1]:1080",
+			want:   Tunnel{Type: TunnelDynamic, Local: 1080, BindAddress: "::1"},
+			str:    "D:[::1]:1080",
+			listen: "[::1]:1080",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseTunnel(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseTunnel = %+v, want %+v", got, tt.want)
+			}
+			if s := got.String(); s != tt.str {
+				t.Errorf("String = %q, want %q", s, tt.str)
+			}
+			if addr := got.ListenAddr(); addr != tt.listen {
+				t.Errorf("ListenAddr = %q, want %q", addr, tt.listen)
+			}
+			if addr := got.TargetAddr(); addr != tt.target {
+				t.Errorf("TargetAddr = %q, want %q", addr, tt.target)
+			}
+
+			again, err := ParseTunnel(got.String())
+			if err != nil {
+				t.Fatalf("String %q does not parse: %v", got.String(), err)
+			}
+			if again != got {
+				t.Errorf("round trip gave %+v, want %+v", again, got)
+			}
+		})
+	}
+}
+
+func TestParseTunnelErrors(t *testing.T) {
+	tests := map[string]string{
+		"":                "expected [BIND:]LOCAL:HOST:REMOTE",
+		"8080":            "expected [BIND:]LOCAL:HOST:REMOTE",
+		"a:b:c:d:e":       "expected [BIND:]LOCAL:HOST:REMOTE",
+		"http:80":         "local port 'http'",
+		"8080:0":          "remote port '0'",
+		"8080:host:70000": "remote port '70000'",
+		"R:9000":          "expected R:[BIND:]REMOTE:HOST:LOCAL",
+		"R:x:3000":        "remote port 'x'",
+		"D:":              "local port ''",
+		"D:a:b:1080":      "expected D:[BIND:]LOCAL",
+		"::1:8080:x:80":   "expected [BIND:]LOCAL:HOST:REMOTE",
+	}
+
+	for spec, want := range tests {
+		_, err := ParseTunnel(spec)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseTunnel(%q) error = %v, want %q", spec, err, want)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Package fleet runs commands on many connections at once over the native
+// dialer, collecting per-host results.
+package fleet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/paramientos/leap/internal/config"
+	leapssh "github.com/paramientos/leap/internal/ssh"
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultParallel is how many hosts run at once unless told otherwise.
+const DefaultParallel = 10
+
+// Options controls a fan-out.
+type Options struct {
+	// Parallel caps how many hosts run at the same time.
+	Parallel int
+	// Timeout bounds each host, dial included. Zero means no limit.
+	Timeout time.Duration
+	// Dial is passed to every dial.
+	Dial leapssh.DialOptions
+	// Stdin, when set, is fed to the command on every host.
+	Stdin []byte
+	// Sudo runs the command as root, answering sudo's password prompt.
+	Sudo bool
+	// Output, when set, returns where a host's output is streamed as it
+	// arrives. Output is captured in the Result either way.
+	Output func(conn config.Connection) (stdout, stderr io.Writer)
+	// Done, when set, is called as each host finishes.
+	Done func(Result)
+}
+
+// Result is the outcome of a command on one host.
+type Result struct {
+	Conn    config.Connection
+	Command string
+	Stdout  []byte
+	Stderr  []byte
+	// ExitCode is the remote exit status, or -1 when the command never
+	// reported one.
+	ExitCode int
+	Start    time.Time
+	End      time.Time
+	Err      error
+	// Class says at which stage Err happened.
+	Class ErrorClass
+}
+
+// ErrorClass groups failures so scripts can react without parsing messages.
+type ErrorClass string
+
+const (
+	ClassNone    ErrorClass = ""
+	ClassDial    ErrorClass = "dial"
+	ClassAuth    ErrorClass = "auth"
+	ClassTimeout ErrorClass = "timeout"
+	ClassExit    ErrorClass = "nonzero-exit"
+	// ClassSession covers failures after login, such as a refused channel
+	// or a command killed by a signal.
+	ClassSession ErrorClass = "session"
+)
+
+// Duration is how long the host took, dial included.
+func (r Result) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// Exec runs command on every connection, at most opts.Parallel at a time,
+// and returns the results in the order of conns.
+func Exec(conns []config.Connection, command string, opts Options) []Result {
+	parallel := opts.Parallel
+	if parallel <= 0 {
+		parallel = DefaultParallel
+	}
+
+	results := make([]Result, len(conns))
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	var doneMu sync.Mutex
+
+	for i, conn := range conns {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(i int, conn config.Connection) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			results[i] = runHost(conn, command, opts)
+
+			if opts.Done != nil {
+				doneMu.Lock()
+				opts.Done(results[i])
+				doneMu.Unlock()
+			}
+		}(i, conn)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+func runHost(conn config.Connection, command string, opts Options) Result {
+	res := Result{Conn: conn, Command: command, ExitCode: -1, Start: time.Now()}
+
+	stdout, stderr := &lockedBuffer{}, &lockedBuffer{}
+	var outW, errW io.Writer = stdout, stderr
+	if opts.Output != nil {
+		o, e := opts.Output(conn)
+		outW, errW = io.MultiWriter(stdout, o), io.MultiWriter(stderr, e)
+	}
+
+	h := &hostRun{}
+	done := make(chan error, 1)
+	go func() {
+		done <- h.run(conn, command, opts, outW, errW)
+	}()
+
+	var timeout <-chan time.Time
+	if opts.Timeout > 0 {
+		timer := time.NewTimer(opts.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	timedOut := false
+	select {
+	case err = <-done:
+	case <-timeout:
+		h.abort()
+		err = fmt.Errorf("timed out after %s", opts.Timeout)
+		timedOut = true
+	}
+
+	res.End = time.Now()
+	res.Stdout = stdout.Bytes()
+	res.Stderr = stderr.Bytes()
+
+	var exitErr *ssh.ExitError
+	var authErr *leapssh.AuthError
+	switch {
+	case err == nil:
+		res.ExitCode = 0
+	case timedOut:
+		res.Class = ClassTimeout
+	case errors.As(err, &exitErr):
+		res.ExitCode = exitErr.ExitStatus()
+		res.Class = ClassExit
+	case errors.As(err, &authErr):
+		res.Class = ClassAuth
+	case !h.connected():
+		res.Class = ClassDial
+	default:
+		res.Class = ClassSession
+	}
+	res.Err = err
+
+	return res
+}
+
+// hostRun lets a timeout close a dial or session that is still running.
+type hostRun struct {
+	mu      sync.Mutex
+	client  *ssh.Client
+	aborted bool
+}
+
+func (h *hostRun) run(conn config.Connection, command string, opts Options, stdout, stderr io.Writer) error {
+	client, err := leapssh.Dial(conn, opts.Dial)
+	if err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+
+	h.mu.Lock()
+	if h.aborted {
+		h.mu.Unlock()
+		client.Close()
+		return fmt.Errorf("aborted")
+	}
+	h.client = client
+	h.mu.Unlock()
+	defer client.Close()
+
+	if opts.Sudo {
+		return leapssh.RunSudo(func() (*ssh.Session, error) {
+			session, err := client.NewSession()
+			if err != nil {
+				return nil, fmt.Errorf("session failed: %v", err)
+			}
+			return session, nil
+		}, command, leapssh.SudoOptions{
+			Conn:   conn,
+			Dial:   opts.Dial,
+			Stdin:  opts.Stdin,
+			Stdout: stdout,
+			Stderr: stderr,
+		})
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("session failed: %v", err)
+	}
+	defer session.Close()
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if opts.Stdin != nil {
+		session.Stdin = bytes.NewReader(opts.Stdin)
+	}
+
+	return session.Run(command)
+}
+
+func (h *hostRun) connected() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.client != nil
+}
+
+func (h *hostRun) abort() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.aborted = true
+	if h.client != nil {
+		h.client.Close()
+	}
+}
+
+// lockedBuffer collects output that may still arrive after a timeout.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
@@ -0,0 +1,53 @@
+package fleet
+
+import (
+	"bytes"
+	"sort"
+)
+
+// OutputGroup is a set of hosts whose command printed the same stdout.
+type OutputGroup struct {
+	Stdout  []byte
+	Results []Result
+}
+
+// Names lists the hosts in the group.
+func (g OutputGroup) Names() []string {
+	names := make([]string, 0, len(g.Results))
+	for _, res := range g.Results {
+		names = append(names, res.Conn.Name)
+	}
+	return names
+}
+
+// GroupOutput buckets the hosts whose command ran by identical stdout,
+// largest group first. Hosts that never ran the command, e.g. because the
+// dial failed or timed out, are left out.
+func GroupOutput(results []Result) []OutputGroup {
+	var groups []OutputGroup
+
+	for _, res := range results {
+		if res.ExitCode < 0 {
+			continue
+		}
+
+		found := false
+		for i := range groups {
+			if bytes.Equal(groups[i].Stdout, res.Stdout) {
+				groups[i].Results = append(groups[i].Results, res)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			groups = append(groups, OutputGroup{Stdout: res.Stdout, Results: []Result{res}})
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Results) > len(groups[j].Results)
+	})
+
+	return groups
+}
@@ -0,0 +1,65 @@
+package fleet
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var prefixColors = []string{"36", "35", "33", "32", "34", "96", "95", "93", "92", "94"}
+
+// PrefixColor picks a stable color for the i-th host.
+func PrefixColor(i int) string {
+	return prefixColors[i%len(prefixColors)]
+}
+
+// LineWriter prefixes every complete line with a host label before writing
+// it to a shared output, so lines from parallel hosts never interleave.
+type LineWriter struct {
+	out    io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+// NewLineWriter writes to out under mu, starting each line with label padded
+// to width in the given ANSI color.
+func NewLineWriter(out io.Writer, mu *sync.Mutex, label string, width int, color string) *LineWriter {
+	return &LineWriter{
+		out:    out,
+		mu:     mu,
+		prefix: fmt.Sprintf("\033[%sm%-*s\033[0m \033[90m│\033[0m ", color, width, label),
+	}
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.writeLine(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush writes a trailing line that had no newline.
+func (w *LineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *LineWriter) writeLine(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	io.WriteString(w.out, w.prefix)
+	w.out.Write(line)
+}
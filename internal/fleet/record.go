@@ -0,0 +1,51 @@
+package fleet
+
+import "time"
+
+// Record is the machine-readable form of a Result, as printed by
+// --output json and ndjson.
+type Record struct {
+	Connection string    `json:"connection"`
+	Host       string    `json:"host"`
+	User       string    `json:"user"`
+	Port       int       `json:"port"`
+	Command    string    `json:"command"`
+	Stdout     string    `json:"stdout"`
+	Stderr     string    `json:"stderr"`
+	ExitCode   *int      `json:"exit_code"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	DurationMs int64     `json:"duration_ms"`
+	OK         bool      `json:"ok"`
+	ErrorClass string    `json:"error_class,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Record converts r. ExitCode is null when the command never reported one.
+func (r Result) Record() Record {
+	rec := Record{
+		Connection: r.Conn.Name,
+		Host:       r.Conn.Host,
+		User:       r.Conn.User,
+		Port:       r.Conn.Port,
+		Command:    r.Command,
+		Stdout:     string(r.Stdout),
+		Stderr:     string(r.Stderr),
+		Start:      r.Start,
+		End:        r.End,
+		DurationMs: r.Duration().Milliseconds(),
+		OK:         r.Err == nil,
+		ErrorClass: string(r.Class),
+	}
+
+	if r.ExitCode >= 0 {
+		code := r.ExitCode
+		rec.ExitCode = &code
+	}
+
+	if r.Err != nil {
+		rec.Error = r.Err.Error()
+	}
+
+	return rec
+}
@@ -0,0 +1,423 @@
+package runbook
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paramientos/leap/internal/config"
+	"github.com/paramientos/leap/internal/fleet"
+	leapssh "github.com/paramientos/leap/internal/ssh"
+	"github.com/paramientos/leap/internal/transfer"
+	"github.com/paramientos/leap/internal/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// Options controls a runbook run.
+type Options struct {
+	// Env is merged over the runbook's env.
+	Env map[string]string
+	// Serial, when positive, overrides the runbook's batch size.
+	Serial int
+	// Sudo runs every command step as root.
+	Sudo bool
+	Dial leapssh.DialOptions
+	Out  io.Writer
+	// Confirm answers pause steps; nil declines them.
+	Confirm func(message string) bool
+}
+
+// HostResult is the outcome of a runbook on one server.
+type HostResult struct {
+	Conn config.Connection
+	// Steps counts the steps that ran on the server.
+	Steps    int
+	Failed   bool
+	Err      error
+	Duration time.Duration
+}
+
+// Batches splits conns into rolling batches of size serial (all at once when
+// serial is 0).
+func Batches(conns []config.Connection, serial int) [][]config.Connection {
+	if serial <= 0 || serial >= len(conns) {
+		return [][]config.Connection{conns}
+	}
+
+	var batches [][]config.Connection
+	for start := 0; start < len(conns); start += serial {
+		end := min(start+serial, len(conns))
+		batches = append(batches, conns[start:end])
+	}
+
+	return batches
+}
+
+func (rb *Runbook) serial(opts Options) int {
+	if opts.Serial > 0 {
+		return opts.Serial
+	}
+	return rb.Serial
+}
+
+func (rb *Runbook) env(opts Options) map[string]string {
+	env := map[string]string{}
+	for k, v := range rb.Env {
+		env[k] = v
+	}
+	for k, v := range opts.Env {
+		env[k] = v
+	}
+	return env
+}
+
+// Plan prints what Run would do, without connecting anywhere.
+func (rb *Runbook) Plan(conns []config.Connection, opts Options) {
+	out := opts.Out
+	if out == nil {
+		out = io.Discard
+	}
+
+	batches := Batches(conns, rb.serial(opts))
+	for i, batch := range batches {
+		names := make([]string, 0, len(batch))
+		for _, conn := range batch {
+			names = append(names, conn.Name)
+		}
+		fmt.Fprintf(out, "  \033[1;33mBatch %d/%d\033[0m \033[90m%s\033[0m\n", i+1, len(batches), strings.Join(names, ", "))
+	}
+
+	if env := rb.env(opts); len(env) > 0 {
+		fmt.Fprintf(out, "\n  \033[1mEnv:\033[0m %s\n", strings.TrimSuffix(EnvPrefix(env), "; "))
+	}
+
+	fmt.Fprintln(out)
+	for i, step := range rb.Steps {
+		fmt.Fprintf(out, "  \033[1;36m%2d.\033[0m \033[1m%s\033[0m \033[90m[%s", i+1, step.Name, step.kind())
+		if step.Command != "" && (step.Sudo || opts.Sudo) {
+			fmt.Fprint(out, ", sudo")
+		}
+		if step.OnFailure != OnFailureAbort {
+			fmt.Fprintf(out, ", on_failure: %s", step.OnFailure)
+		}
+		if step.Timeout > 0 {
+			fmt.Fprintf(out, ", timeout: %s", step.Timeout)
+		}
+		fmt.Fprint(out, "]\033[0m\n")
+
+		if step.Name != step.describe() {
+			fmt.Fprintf(out, "      \033[90m%s\033[0m\n", step.describe())
+		}
+		if step.AssertContains != "" {
+			fmt.Fprintf(out, "      \033[90mexpect output to contain %q\033[0m\n", step.AssertContains)
+		}
+	}
+}
+
+// host is a server taking part in the current batch.
+type host struct {
+	conn    config.Connection
+	client  *ssh.Client
+	start   time.Time
+	steps   int
+	failed  bool
+	stopped bool
+	err     error
+	stdout  io.Writer
+	stderr  io.Writer
+	flush   func()
+}
+
+// Run executes the runbook batch by batch. Within a batch every step runs on
+// all servers in parallel before the next step starts. A server that can't be
+// reached, or whose step fails under the abort policy, stops there, and the
+// rollout halts after that batch. Failures under the continue policy are
+// reported but don't halt it. The returned error explains why the run
+// stopped early, if it did.
+func (rb *Runbook) Run(conns []config.Connection, opts Options) ([]HostResult, error) {
+	out := opts.Out
+	if out == nil {
+		out = io.Discard
+	}
+
+	width := 0
+	colors := map[string]string{}
+	for i, conn := range conns {
+		width = max(width, len(conn.Name))
+		colors[conn.Name] = fleet.PrefixColor(i)
+	}
+
+	env := EnvPrefix(rb.env(opts))
+	batches := Batches(conns, rb.serial(opts))
+
+	var results []HostResult
+	var outMu sync.Mutex
+
+	for b, batch := range batches {
+		if len(batches) > 1 {
+			fmt.Fprintf(out, "\n\033[1;33m━━ Batch %d/%d\033[0m\n", b+1, len(batches))
+		}
+
+		hosts := make([]*host, len(batch))
+		for i, conn := range batch {
+			stdout := fleet.NewLineWriter(out, &outMu, conn.Name, width, colors[conn.Name])
+			stderr := fleet.NewLineWriter(out, &outMu, conn.Name, width, colors[conn.Name])
+			hosts[i] = &host{
+				conn:   conn,
+				start:  time.Now(),
+				stdout: stdout,
+				stderr: stderr,
+				flush:  func() { stdout.Flush(); stderr.Flush() },
+			}
+		}
+
+		// Log in everywhere first so a bad host doesn't fail halfway through
+		parallel(hosts, func(h *host) {
+			client, err := leapssh.Dial(h.conn, opts.Dial)
+			if err != nil {
+				h.fail(fmt.Errorf("connection failed: %v", err))
+				fmt.Fprintf(h.stderr, "\033[31m✗ %v\033[0m\n", h.err)
+				h.flush()
+				return
+			}
+			h.client = client
+		})
+
+		halted := ""
+		for i, step := range rb.Steps {
+			active := activeHosts(hosts)
+			if len(active) == 0 {
+				break
+			}
+
+			fmt.Fprintf(out, "\n\033[1;36m▸ [%d/%d]\033[0m \033[1m%s\033[0m\n", i+1, len(rb.Steps), step.Name)
+
+			if step.Pause != "" {
+				if opts.Confirm == nil || !opts.Confirm(step.Pause) {
+					halted = "stopped at pause step"
+					break
+				}
+				for _, h := range active {
+					h.steps++
+				}
+				continue
+			}
+
+			parallel(active, func(h *host) {
+				err := rb.runStep(h, step, env, len(conns) > 1, opts)
+				h.steps++
+				h.flush()
+
+				if err == nil {
+					return
+				}
+
+				switch step.OnFailure {
+				case OnFailureIgnore:
+					fmt.Fprintf(h.stderr, "\033[33m⚠ %v (ignored)\033[0m\n", err)
+				case OnFailureContinue:
+					fmt.Fprintf(h.stderr, "\033[31m✗ %v (continuing)\033[0m\n", err)
+					h.failed = true
+					if h.err == nil {
+						h.err = fmt.Errorf("%s: %v", step.Name, err)
+					}
+				default:
+					fmt.Fprintf(h.stderr, "\033[31m✗ %v\033[0m\n", err)
+					h.fail(fmt.Errorf("%s: %v", step.Name, err))
+				}
+				h.flush()
+			})
+		}
+
+		aborted := 0
+		for _, h := range hosts {
+			if h.client != nil {
+				h.client.Close()
+			}
+			if h.stopped {
+				aborted++
+			}
+
+			err := h.err
+			if err == nil && halted != "" {
+				err = fmt.Errorf("%s", halted)
+			}
+			results = append(results, HostResult{
+				Conn:     h.conn,
+				Steps:    h.steps,
+				Failed:   h.failed || halted != "",
+				Err:      err,
+				Duration: time.Since(h.start),
+			})
+		}
+
+		if halted != "" {
+			return results, fmt.Errorf("%s", halted)
+		}
+
+		if aborted > 0 && b < len(batches)-1 {
+			return results, fmt.Errorf("rollout halted: %d server(s) aborted in batch %d/%d", aborted, b+1, len(batches))
+		}
+	}
+
+	return results, nil
+}
+
+func (h *host) fail(err error) {
+	h.failed = true
+	h.stopped = true
+	h.err = err
+}
+
+func activeHosts(hosts []*host) []*host {
+	var active []*host
+	for _, h := range hosts {
+		if !h.stopped {
+			active = append(active, h)
+		}
+	}
+	return active
+}
+
+func parallel(hosts []*host, fn func(h *host)) {
+	var wg sync.WaitGroup
+	for _, h := range hosts {
+		wg.Add(1)
+		go func(h *host) {
+			defer wg.Done()
+			fn(h)
+		}(h)
+	}
+	wg.Wait()
+}
+
+// runStep runs one command or transfer step on h. Downloads from several
+// servers land in a subdirectory per server.
+func (rb *Runbook) runStep(h *host, step Step, env string, perHostDownloads bool, opts Options) error {
+	switch {
+	case step.Command != "":
+		return runCommand(h, env+step.Command, step, opts)
+
+	case step.Upload != nil:
+		session, err := transfer.NewSession(h.client)
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+
+		stats, err := session.Upload([]string{rb.localPath(step.Upload.Src)}, step.Upload.Dest, transfer.Options{Recursive: true, Verify: true, Out: h.stdout})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h.stdout, "\033[32m✓\033[0m uploaded %d file(s), %s\n", stats.Files, utils.FormatBytes(stats.Bytes))
+		return nil
+
+	case step.Download != nil:
+		session, err := transfer.NewSession(h.client)
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+
+		dest := rb.localPath(step.Download.Dest)
+		if perHostDownloads {
+			dest = filepath.Join(dest, h.conn.Name)
+			if err := transfer.LocalFS().MkdirAll(dest); err != nil {
+				return err
+			}
+		}
+
+		stats, err := session.Download([]string{step.Download.Src}, dest, transfer.Options{Recursive: true, Verify: true, Out: h.stdout})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h.stdout, "\033[32m✓\033[0m downloaded %d file(s), %s → %s\n", stats.Files, utils.FormatBytes(stats.Bytes), dest)
+		return nil
+	}
+
+	return nil
+}
+
+func runCommand(h *host, command string, step Step, opts Options) error {
+	var mu sync.Mutex
+	var current *ssh.Session
+	timedOut := false
+
+	// open hands out sessions the timeout can close; sudo may open a second one
+	open := func() (*ssh.Session, error) {
+		session, err := h.client.NewSession()
+		if err != nil {
+			return nil, fmt.Errorf("session failed: %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if timedOut {
+			session.Close()
+		}
+		current = session
+
+		return session, nil
+	}
+
+	if step.Timeout > 0 {
+		// Closing the channel alone can leave the remote command running, so
+		// it is sent SIGTERM first
+		timer := time.AfterFunc(step.Timeout, func() {
+			mu.Lock()
+			defer mu.Unlock()
+			timedOut = true
+			if current != nil {
+				current.Signal(ssh.SIGTERM)
+				current.Close()
+			}
+		})
+		defer timer.Stop()
+	}
+
+	var captured bytes.Buffer
+	stdout := io.MultiWriter(h.stdout, &captured)
+
+	var err error
+	if step.Sudo || opts.Sudo {
+		err = leapssh.RunSudo(open, command, leapssh.SudoOptions{
+			Conn:   h.conn,
+			Dial:   opts.Dial,
+			Stdout: stdout,
+			Stderr: h.stderr,
+		})
+	} else {
+		var session *ssh.Session
+		session, err = open()
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+
+		session.Stdout = stdout
+		session.Stderr = h.stderr
+		err = session.Run(command)
+	}
+
+	mu.Lock()
+	expired := timedOut
+	mu.Unlock()
+
+	if expired {
+		return fmt.Errorf("timed out after %s", step.Timeout)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if step.AssertContains != "" && !strings.Contains(captured.String(), step.AssertContains) {
+		return fmt.Errorf("output does not contain %q", step.AssertContains)
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+// Package runbook loads and runs multi-step YAML runbooks across servers.
+package runbook
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	leapssh "github.com/paramientos/leap/internal/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+// Failure policies for a step.
+const (
+	// OnFailureAbort stops the runbook on that server and halts the rollout
+	// after the current batch. It is the default.
+	OnFailureAbort = "abort"
+	// OnFailureContinue marks the server failed but runs its remaining steps,
+	// and lets the rollout go on to the next batch.
+	OnFailureContinue = "continue"
+	// OnFailureIgnore treats the failure as success.
+	OnFailureIgnore = "ignore"
+)
+
+// Runbook is an ordered list of steps run on every target server.
+type Runbook struct {
+	Name string `yaml:"name"`
+	// Serial is how many servers run at a time; 0 runs them all at once.
+	Serial int               `yaml:"serial,omitempty"`
+	Env    map[string]string `yaml:"env,omitempty"`
+	Steps  []Step            `yaml:"steps"`
+
+	// dir is where relative local paths are resolved from
+	dir string
+}
+
+// Step does exactly one of: run a command, upload, download or pause.
+type Step struct {
+	Name     string `yaml:"name"`
+	Command  string `yaml:"command,omitempty"`
+	Upload   *Copy  `yaml:"upload,omitempty"`
+	Download *Copy  `yaml:"download,omitempty"`
+	// Pause asks for confirmation with this message before going on.
+	Pause string `yaml:"pause,omitempty"`
+	// Sudo runs a command step as root.
+	Sudo bool `yaml:"sudo,omitempty"`
+	// AssertContains fails a command step whose stdout lacks this text.
+	AssertContains string        `yaml:"assert_contains,omitempty"`
+	OnFailure      string        `yaml:"on_failure,omitempty"`
+	Timeout        time.Duration `yaml:"timeout,omitempty"`
+}
+
+// Copy names the source and destination of a transfer step.
+type Copy struct {
+	Src  string `yaml:"src"`
+	Dest string `yaml:"dest"`
+}
+
+// IsRunbook reports whether path looks like a runbook rather than a script.
+func IsRunbook(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yml" || ext == ".yaml"
+}
+
+// Load reads and validates a runbook. Relative local paths in upload and
+// download steps are resolved against the runbook's directory.
+func Load(path string) (*Runbook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	var rb Runbook
+	if err := dec.Decode(&rb); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if err := rb.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	rb.dir = filepath.Dir(abs)
+
+	if rb.Name == "" {
+		rb.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	return &rb, nil
+}
+
+func (rb *Runbook) validate() error {
+	if len(rb.Steps) == 0 {
+		return fmt.Errorf("no steps")
+	}
+
+	if rb.Serial < 0 {
+		return fmt.Errorf("serial must not be negative")
+	}
+
+	for name := range rb.Env {
+		if !ValidEnvName(name) {
+			return fmt.Errorf("invalid env name %q", name)
+		}
+	}
+
+	for i := range rb.Steps {
+		step := &rb.Steps[i]
+		label := fmt.Sprintf("step %d", i+1)
+		if step.Name != "" {
+			label += fmt.Sprintf(" (%s)", step.Name)
+		}
+
+		kinds := 0
+		for _, set := range []bool{step.Command != "", step.Upload != nil, step.Download != nil, step.Pause != ""} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			return fmt.Errorf("%s: needs exactly one of command, upload, download or pause", label)
+		}
+
+		for _, c := range []*Copy{step.Upload, step.Download} {
+			if c != nil && (c.Src == "" || c.Dest == "") {
+				return fmt.Errorf("%s: src and dest are required", label)
+			}
+		}
+
+		if step.Sudo && step.Command == "" {
+			return fmt.Errorf("%s: sudo only applies to command steps", label)
+		}
+
+		if step.AssertContains != "" && step.Command == "" {
+			return fmt.Errorf("%s: assert_contains only applies to command steps", label)
+		}
+
+		switch step.OnFailure {
+		case "":
+			step.OnFailure = OnFailureAbort
+		case OnFailureAbort, OnFailureContinue, OnFailureIgnore:
+		default:
+			return fmt.Errorf("%s: on_failure must be abort, continue or ignore", label)
+		}
+
+		if step.Name == "" {
+			step.Name = step.describe()
+		}
+	}
+
+	return nil
+}
+
+// describe summarizes what the step does.
+func (s Step) describe() string {
+	switch {
+	case s.Command != "":
+		return s.Command
+	case s.Upload != nil:
+		return fmt.Sprintf("upload %s → %s", s.Upload.Src, s.Upload.Dest)
+	case s.Download != nil:
+		return fmt.Sprintf("download %s → %s", s.Download.Src, s.Download.Dest)
+	default:
+		return "pause: " + s.Pause
+	}
+}
+
+func (s Step) kind() string {
+	switch {
+	case s.Command != "":
+		return "command"
+	case s.Upload != nil:
+		return "upload"
+	case s.Download != nil:
+		return "download"
+	default:
+		return "pause"
+	}
+}
+
+// localPath resolves p against the runbook directory.
+func (rb *Runbook) localPath(p string) string {
+	if filepath.IsAbs(p) || rb.dir == "" {
+		return p
+	}
+	return filepath.Join(rb.dir, p)
+}
+
+// EnvPrefix renders env as shell exports to put in front of a command.
+func EnvPrefix(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "export %s=%s; ", k, leapssh.ShellQuote(env[k]))
+	}
+
+	return b.String()
+}
+
+// ValidEnvName reports whether name can be exported by a POSIX shell.
+func ValidEnvName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// addAuthorizedKeyScript appends $1 to authorized_keys unless a line already
+// carries the same key blob ($2), creating ~/.ssh with sshd's expected modes.
+const addAuthorizedKeyScript = `umask 077
+mkdir -p ~/.ssh
+f=~/.ssh/authorized_keys
+touch "$f"
+if grep -qF "$2" "$f"; then
+	echo present
+	exit 0
+fi
+if [ -s "$f" ] && [ -n "$(tail -c 1 "$f")" ]; then
+	echo >> "$f"
+fi
+printf '%s\n' "$1" >> "$f"
+echo added`
+
+// AuthorizedKey is one parsed line of a remote authorized_keys file.
+type AuthorizedKey struct {
+	Key     ssh.PublicKey
+	Comment string
+	Options []string
+}
+
+// AddAuthorizedKey installs pub on the server behind client. It reports
+// false when the key was already there.
+func AddAuthorizedKey(client *ssh.Client, pub ssh.PublicKey, comment string) (bool, error) {
+	blob := authorizedKeyBlob(pub)
+	line := blob
+	if comment != "" {
+		line += " " + comment
+	}
+
+	out, err := runScript(client, addAuthorizedKeyScript, nil, line, blob)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(out) == "added", nil
+}
+
+// ListAuthorizedKeys returns the keys in the remote authorized_keys file.
+// Lines that are not keys are skipped.
+func ListAuthorizedKeys(client *ssh.Client) ([]AuthorizedKey, error) {
+	data, err := runScript(client, `cat ~/.ssh/authorized_keys 2>/dev/null || true`, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []AuthorizedKey
+	for _, line := range strings.Split(data, "\n") {
+		pub, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			continue
+		}
+		keys = append(keys, AuthorizedKey{Key: pub, Comment: comment, Options: options})
+	}
+
+	return keys, nil
+}
+
+// RemoveAuthorizedKeys deletes every line whose key matches, leaving comments
+// and unparsable lines alone. It returns how many lines were removed.
+func RemoveAuthorizedKeys(client *ssh.Client, match func(ssh.PublicKey) bool) (int, error) {
+	data, err := runScript(client, `cat ~/.ssh/authorized_keys 2>/dev/null || true`, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var kept []string
+	removed := 0
+	for _, line := range strings.Split(strings.TrimRight(data, "\n"), "\n") {
+		if pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err == nil && match(pub) {
+			removed++
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	content := strings.Join(kept, "\n")
+	if content != "" {
+		content += "\n"
+	}
+
+	// Write next to the file and rename, so a dropped connection can't truncate it
+	script := `umask 077
+f=~/.ssh/authorized_keys
+cat > "$f.leap-tmp" && mv "$f.leap-tmp" "$f"`
+	if _, err := runScript(client, script, strings.NewReader(content)); err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+// SameKey reports whether a and b are the same public key.
+func SameKey(a, b ssh.PublicKey) bool {
+	return bytes.Equal(a.Marshal(), b.Marshal())
+}
+
+func authorizedKeyBlob(pub ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+}
+
+// runScript runs a POSIX sh script with positional arguments on the server.
+func runScript(client *ssh.Client, script string, stdin *strings.Reader, args ...string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	if stdin != nil {
+		session.Stdin = stdin
+	}
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	command := "sh -c " + ShellQuote(script) + " leap"
+	for _, arg := range args {
+		command += " " + ShellQuote(arg)
+	}
+
+	if err := session.Run(command); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%v: %s", err, msg)
+		}
+		return "", err
+	}
+
+	return stdout.String(), nil
+}
+
+// ShellQuote wraps s in single quotes for a POSIX shell.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,251 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/paramientos/leap/internal/config"
+	"golang.org/x/crypto/ssh"
+)
+
+// CAClockSkew backdates certificates so hosts with a slightly slow clock
+// accept them immediately.
+const CAClockSkew = 5 * time.Minute
+
+// CAKeyPath returns the user CA private key, shared by all profiles.
+func CAKeyPath() string {
+	return filepath.Join(config.GetBaseDir(), "ca_ed25519")
+}
+
+// CAExists reports whether a CA key has been created.
+func CAExists() bool {
+	_, err := os.Stat(CAKeyPath())
+	return err == nil
+}
+
+// InitCA generates a new ed25519 CA key, encrypted with passphrase. An
+// existing key is only replaced when force is set, since that invalidates
+// every certificate it signed.
+func InitCA(force bool, passphrase string) (ssh.PublicKey, error) {
+	if CAExists() && !force {
+		return nil, fmt.Errorf("a CA key already exists at %s", CAKeyPath())
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("the CA key needs a passphrase")
+	}
+
+	return writeKeyPair(CAKeyPath(), "leap-user-ca", passphrase)
+}
+
+// CAEncrypted reports whether the CA key is protected by a passphrase. Keys
+// made before CA keys were encrypted are not.
+func CAEncrypted() (bool, error) {
+	data, err := readCAKey()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = ssh.ParseRawPrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return true, nil
+	}
+	return false, err
+}
+
+// LoadCA decrypts the CA key with passphrase and returns a signer for it.
+func LoadCA(passphrase string) (ssh.Signer, error) {
+	data, err := readCAKey()
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, fmt.Errorf("wrong CA passphrase")
+	}
+	return signer, err
+}
+
+// LoadCAPublicKey returns the CA public key without touching the private key.
+func LoadCAPublicKey() (ssh.PublicKey, error) {
+	data, err := os.ReadFile(CAKeyPath() + ".pub")
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no CA key found; create one with 'leap ca init'")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	return pub, err
+}
+
+// ProtectCA encrypts a CA key that was saved without a passphrase.
+func ProtectCA(passphrase string) error {
+	data, err := readCAKey()
+	if err != nil {
+		return err
+	}
+
+	key, err := ssh.ParseRawPrivateKey(data)
+	if err != nil {
+		return err
+	}
+
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(key, "leap-user-ca", []byte(passphrase))
+	if err != nil {
+		return err
+	}
+
+	// Swap the file in whole so a failed write can't lose the key
+	tmp := CAKeyPath() + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(block), 0600); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, CAKeyPath())
+}
+
+func readCAKey() ([]byte, error) {
+	data, err := os.ReadFile(CAKeyPath())
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no CA key found; create one with 'leap ca init'")
+	}
+	return data, err
+}
+
+// GenerateKey writes a new unencrypted ed25519 key pair to path and
+// path.pub, in the same format as ssh-keygen.
+func GenerateKey(path, comment string) (ssh.PublicKey, error) {
+	return writeKeyPair(path, comment, "")
+}
+
+// writeKeyPair writes a new ed25519 key pair, encrypted with passphrase
+// unless it is empty.
+func writeKeyPair(path, comment, passphrase string) (ssh.PublicKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(priv, comment)
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, comment, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+
+	line := fmt.Sprintf("%s %s\n", strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))), comment)
+	if err := os.WriteFile(path+".pub", []byte(line), 0644); err != nil {
+		return nil, err
+	}
+
+	return sshPub, nil
+}
+
+// CertOptions describes a user certificate to sign.
+type CertOptions struct {
+	KeyID      string
+	Principals []string
+	Validity   time.Duration
+}
+
+// SignUserCert certifies pub as a user key with the CA. The certificate
+// carries the usual OpenSSH extensions (pty, forwarding, user rc).
+func SignUserCert(ca ssh.Signer, pub ssh.PublicKey, opts CertOptions) (*ssh.Certificate, error) {
+	if len(opts.Principals) == 0 {
+		return nil, fmt.Errorf("at least one principal is required")
+	}
+	if opts.Validity <= 0 {
+		return nil, fmt.Errorf("validity must be positive")
+	}
+
+	var serial [8]byte
+	if _, err := rand.Read(serial[:]); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		CertType:        ssh.UserCert,
+		KeyId:           opts.KeyID,
+		ValidPrincipals: opts.Principals,
+		ValidAfter:      uint64(now.Add(-CAClockSkew).Unix()),
+		ValidBefore:     uint64(now.Add(opts.Validity).Unix()),
+		Permissions: ssh.Permissions{
+			Extensions: map[string]string{
+				"permit-pty":              "",
+				"permit-port-forwarding":  "",
+				"permit-agent-forwarding": "",
+				"permit-X11-forwarding":   "",
+				"permit-user-rc":          "",
+			},
+		},
+	}
+
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+// WriteCertificate saves cert in the authorized_keys format ssh-keygen uses
+// for -cert.pub files.
+func WriteCertificate(certFile string, cert *ssh.Certificate) error {
+	line := fmt.Sprintf("%s %s\n", strings.TrimSpace(string(ssh.MarshalAuthorizedKey(cert))), cert.KeyId)
+	return os.WriteFile(expandHome(certFile), []byte(line), 0644)
+}
+
+// ReadPublicKey returns the public half of a private key file, preferring
+// the .pub next to it so encrypted keys don't need their passphrase.
+func ReadPublicKey(identityFile string) (ssh.PublicKey, error) {
+	path := expandHome(identityFile)
+
+	if data, err := os.ReadFile(path + ".pub"); err == nil {
+		pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+		if err == nil {
+			return pub, nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v (add a .pub file next to encrypted keys)", identityFile, err)
+	}
+
+	return signer.PublicKey(), nil
+}
@@ -3,32 +3,81 @@ package ssh
 import (
 	"fmt"
 	"io"
-	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/paramientos/leap/internal/config"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/agent"
 	"golang.org/x/term"
 )
 
-func Connect(conn config.Connection, record bool) error {
+func Connect(conn config.Connection, record bool, cfg *config.Config) error {
+	hops, err := JumpChain(conn, cfg)
+	if err != nil {
+		return err
+	}
+
 	// If password exists, we MUST use native to auto-fill it
 	// If it's a key-only connection, system SSH via syscall.Exec (on Unix) is better
-	if conn.Password != "" || record {
-		return connectNative(conn, record)
+	if hasSavedSecret(conn) || record || hasSavedSecretOnHops(hops) || hasHopIdentity(hops) {
+		return connectNative(conn, record, cfg)
+	}
+
+	return connectWithSystemSSH(conn, jumpSpec(hops))
+}
+
+// hasSavedSecret reports whether conn needs a secret only leap knows.
+func hasSavedSecret(conn config.Connection) bool {
+	return hasPassword(conn) || conn.KeyPassphrase != "" || conn.TOTPSecret != ""
+}
+
+func hasSavedSecretOnHops(hops []config.Connection) bool {
+	for _, hop := range hops {
+		if hasSavedSecret(hop) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasHopIdentity reports whether a jump host logs in with its own key or
+// certificate. ssh -J has no way to pass those per hop, so such chains are
+// dialed natively.
+func hasHopIdentity(hops []config.Connection) bool {
+	for _, hop := range hops {
+		if hop.IdentityFile != "" || hop.CertificateFile != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jumpSpec renders resolved hops in the [user@]host:port form ssh -J expects.
+func jumpSpec(hops []config.Connection) string {
+	parts := make([]string, 0, len(hops))
+	for _, hop := range hops {
+		parts = append(parts, sshTarget(hop.User, Address(hop)))
 	}
 
-	return connectWithSystemSSH(conn)
+	return strings.Join(parts, ",")
 }
 
-func connectNative(conn config.Connection, record bool) error {
+// sshTarget prefixes host with user@ unless the user is left to ssh.
+func sshTarget(user, host string) string {
+	if user == "" {
+		return host
+	}
+	return user + "@" + host
+}
+
+func connectNative(conn config.Connection, record bool, cfg *config.Config) error {
 	var recordingFile *os.File
 	if record {
-		home, _ := os.UserHomeDir()
-		historyDir := filepath.Join(home, ".leap", "history")
+		historyDir := config.GetHistoryDir()
 		os.MkdirAll(historyDir, 0700)
 		fileName := fmt.Sprintf("%s_%s.cast", conn.Name, time.Now().Format("20060102_150405"))
 		path := filepath.Join(historyDir, fileName)
@@ -40,32 +89,7 @@ func connectNative(conn config.Connection, record bool) error {
 		}
 	}
 
-	sshConfig := &ssh.ClientConfig{
-		User:            conn.User,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         15 * time.Second,
-	}
-
-	var auth []ssh.AuthMethod
-	if conn.IdentityFile != "" {
-		if key, err := os.ReadFile(conn.IdentityFile); err == nil {
-			if signer, err := ssh.ParsePrivateKey(key); err == nil {
-				auth = append(auth, ssh.PublicKeys(signer))
-			}
-		}
-	}
-	if conn.Password != "" {
-		auth = append(auth, ssh.Password(conn.Password))
-	}
-	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
-		if netConn, err := net.Dial("unix", socket); err == nil {
-			agentClient := agent.NewClient(netConn)
-			auth = append(auth, ssh.PublicKeysCallback(agentClient.Signers))
-		}
-	}
-	sshConfig.Auth = auth
-
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", conn.Host, conn.Port), sshConfig)
+	client, err := Dial(conn, DialOptions{Config: cfg, Interactive: true})
 	if err != nil {
 		return fmt.Errorf("dial failed: %v", err)
 	}
@@ -122,27 +146,12 @@ func connectNative(conn config.Connection, record bool) error {
 	return session.Wait()
 }
 
-func RunCommand(conn config.Connection, command string) (string, error) {
-	sshConfig := &ssh.ClientConfig{
-		User:            conn.User,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         10 * time.Second,
-	}
-	var auth []ssh.AuthMethod
-	if conn.IdentityFile != "" {
-		if key, err := os.ReadFile(conn.IdentityFile); err == nil {
-			if signer, err := ssh.ParsePrivateKey(key); err == nil {
-				auth = append(auth, ssh.PublicKeys(signer))
-			}
-		}
-	}
-	if conn.Password != "" {
-		auth = append(auth, ssh.Password(conn.Password))
+func RunCommand(conn config.Connection, command string, opts DialOptions) (string, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
 	}
-	sshConfig.Auth = auth
 
-	addr := fmt.Sprintf("%s:%d", conn.Host, conn.Port)
-	client, err := ssh.Dial("tcp", addr, sshConfig)
+	client, err := Dial(conn, opts)
 	if err != nil {
 		return "", err
 	}
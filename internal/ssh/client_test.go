@@ -0,0 +1,36 @@
+package ssh
+
+import (
+	"testing"
+
+	"github.com/paramientos/leap/internal/config"
+)
+
+func TestJumpSpec(t *testing.T) {
+	tests := []struct {
+		hops []config.Connection
+		want string
+	}{
+		{[]config.Connection{{Host: "bastion", User: "admin", Port: 22}}, "admin@bastion:22"},
+		{[]config.Connection{{Host: "bastion", Port: 2222}}, "bastion:2222"},
+		{[]config.Connection{{Host: "a", User: "u", Port: 22}, {Host: "fd00::1", Port: 22}}, "u@a:22,[fd00::1]:22"},
+	}
+
+	for _, tt := range tests {
+		if got := jumpSpec(tt.hops); got != tt.want {
+			t.Errorf("jumpSpec = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestHasHopIdentity(t *testing.T) {
+	if hasHopIdentity([]config.Connection{{Host: "bastion"}}) {
+		t.Error("hasHopIdentity = true for a hop without a key")
+	}
+	if !hasHopIdentity([]config.Connection{{Host: "a"}, {Host: "b", IdentityFile: "~/.ssh/b"}}) {
+		t.Error("hasHopIdentity = false for a hop with its own key")
+	}
+	if !hasHopIdentity([]config.Connection{{Host: "a", CertificateFile: "~/.ssh/a-cert.pub"}}) {
+		t.Error("hasHopIdentity = false for a hop with a certificate")
+	}
+}
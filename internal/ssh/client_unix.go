@@ -14,7 +14,7 @@ import (
 	"golang.org/x/term"
 )
 
-func connectWithSystemSSH(conn config.Connection) error {
+func connectWithSystemSSH(conn config.Connection, jump string) error {
 	binary, err := exec.LookPath("ssh")
 	if err != nil {
 		binary = "/usr/bin/ssh"
@@ -24,12 +24,14 @@ func connectWithSystemSSH(conn config.Connection) error {
 	if conn.IdentityFile != "" {
 		args = append(args, "-i", conn.IdentityFile)
 	}
+	if conn.CertificateFile != "" {
+		args = append(args, "-o", "CertificateFile="+conn.CertificateFile)
+	}
 	args = append(args, "-p", fmt.Sprintf("%d", conn.Port))
-	if conn.JumpHost != "" {
-		args = append(args, "-J", conn.JumpHost)
+	if jump != "" {
+		args = append(args, "-J", jump)
 	}
-	target := fmt.Sprintf("%s@%s", conn.User, conn.Host)
-	args = append(args, target)
+	args = append(args, sshTarget(conn.User, conn.Host))
 
 	return syscall.Exec(binary, args, os.Environ())
 }
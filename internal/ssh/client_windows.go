@@ -11,17 +11,19 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-func connectWithSystemSSH(conn config.Connection) error {
+func connectWithSystemSSH(conn config.Connection, jump string) error {
 	args := []string{"-t"}
 	if conn.IdentityFile != "" {
 		args = append(args, "-i", conn.IdentityFile)
 	}
+	if conn.CertificateFile != "" {
+		args = append(args, "-o", "CertificateFile="+conn.CertificateFile)
+	}
 	args = append(args, "-p", fmt.Sprintf("%d", conn.Port))
-	if conn.JumpHost != "" {
-		args = append(args, "-J", conn.JumpHost)
+	if jump != "" {
+		args = append(args, "-J", jump)
 	}
-	target := fmt.Sprintf("%s@%s", conn.User, conn.Host)
-	args = append(args, target)
+	args = append(args, sshTarget(conn.User, conn.Host))
 
 	cmd := exec.Command("ssh", args...)
 	cmd.Stdin = os.Stdin
@@ -0,0 +1,129 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paramientos/leap/internal/config"
+	"golang.org/x/term"
+)
+
+// passwordCommandTimeout leaves room for helpers that unlock a password
+// manager interactively (gpg pinentry, 1Password, ...).
+const passwordCommandTimeout = 2 * time.Minute
+
+var (
+	// helperMu runs one helper at a time so concurrent dials of the same
+	// host only run its command once.
+	helperMu sync.Mutex
+
+	passwordCacheMu sync.Mutex
+	passwordCache   = make(map[string]string)
+)
+
+// hasPassword reports whether conn can authenticate with a password leap
+// supplies itself.
+func hasPassword(conn config.Connection) bool {
+	return conn.Password != "" || conn.PasswordCommand != ""
+}
+
+// resolvePassword returns the stored password of conn, or the first line
+// printed by its password command. Command output is cached in memory for
+// the lifetime of the process and never written anywhere.
+func resolvePassword(conn config.Connection, opts DialOptions) (string, error) {
+	if conn.Password != "" || conn.PasswordCommand == "" {
+		return conn.Password, nil
+	}
+
+	return resolveHelper(conn, conn.PasswordCommand, opts)
+}
+
+// resolveHelper returns the first line printed by command, running it at
+// most once per process for each connection. The cache is keyed on the
+// connection too: commands like "pass show ssh/$LEAP_CONNECTION" print a
+// different password for every host.
+func resolveHelper(conn config.Connection, command string, opts DialOptions) (string, error) {
+	key := strings.Join([]string{command, conn.Name, conn.Host, conn.User}, "\x00")
+
+	passwordCacheMu.Lock()
+	password, ok := passwordCache[key]
+	passwordCacheMu.Unlock()
+	if ok {
+		return password, nil
+	}
+
+	helperMu.Lock()
+	defer helperMu.Unlock()
+
+	passwordCacheMu.Lock()
+	password, ok = passwordCache[key]
+	passwordCacheMu.Unlock()
+	if ok {
+		return password, nil
+	}
+
+	password, err := runPasswordCommand(conn, command, opts)
+	if err != nil {
+		return "", err
+	}
+
+	passwordCacheMu.Lock()
+	passwordCache[key] = password
+	passwordCacheMu.Unlock()
+
+	return password, nil
+}
+
+func runPasswordCommand(conn config.Connection, command string, opts DialOptions) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), passwordCommandTimeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, command)
+	cmd.Env = append(os.Environ(),
+		"LEAP_CONNECTION="+conn.Name,
+		"LEAP_HOST="+conn.Host,
+		"LEAP_USER="+conn.User,
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// Let the helper ask for its own unlock secret when a user is present
+	interactive := opts.Interactive && term.IsTerminal(int(os.Stdin.Fd()))
+	if interactive {
+		promptMu.Lock()
+		defer promptMu.Unlock()
+
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
+	}
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("password command for %s timed out after %v", conn.Name, passwordCommandTimeout)
+		}
+
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return "", fmt.Errorf("password command for %s failed: %v: %s", conn.Name, err, msg)
+		}
+		return "", fmt.Errorf("password command for %s failed: %v", conn.Name, err)
+	}
+
+	// Like pass(1), only the first line is the secret
+	password, _ := bufio.NewReader(&stdout).ReadString('\n')
+	password = strings.TrimRight(password, "\r\n")
+
+	if password == "" {
+		return "", fmt.Errorf("password command for %s printed nothing", conn.Name)
+	}
+
+	return password, nil
+}
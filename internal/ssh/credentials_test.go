@@ -0,0 +1,52 @@
+//go:build !windows
+
+package ssh
+
+import (
+	"testing"
+
+	"github.com/paramientos/leap/internal/config"
+)
+
+func TestResolveHelperPerConnection(t *testing.T) {
+	command := `echo "pw-$LEAP_CONNECTION-$LEAP_USER@$LEAP_HOST"`
+
+	tests := []struct {
+		conn config.Connection
+		want string
+	}{
+		{config.Connection{Name: "web1", Host: "10.0.0.1", User: "deploy"}, "pw-web1-deploy@10.0.0.1"},
+		{config.Connection{Name: "web2", Host: "10.0.0.2", User: "deploy"}, "pw-web2-deploy@10.0.0.2"},
+		{config.Connection{Name: "web1", Host: "10.0.0.1", User: "root"}, "pw-web1-root@10.0.0.1"},
+		{config.Connection{Name: "web1", Host: "10.0.0.1", User: "deploy"}, "pw-web1-deploy@10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		got, err := resolveHelper(tt.conn, command, DialOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("password for %s@%s = %q, want %q", tt.conn.User, tt.conn.Name, got, tt.want)
+		}
+	}
+}
+
+func TestRunPasswordCommandFirstLine(t *testing.T) {
+	conn := config.Connection{Name: "web1"}
+
+	got, err := runPasswordCommand(conn, `printf 'secret\nuser: x\n'`, DialOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "secret" {
+		t.Errorf("password = %q, want secret", got)
+	}
+
+	if _, err := runPasswordCommand(conn, "true", DialOptions{}); err == nil {
+		t.Error("empty output was accepted")
+	}
+	if _, err := runPasswordCommand(conn, "exit 3", DialOptions{}); err == nil {
+		t.Error("failing command was accepted")
+	}
+}
@@ -0,0 +1,367 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paramientos/leap/internal/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// DialOptions controls how Dial reaches a host.
+type DialOptions struct {
+	// Config resolves jump hosts that refer to other saved connections.
+	Config *config.Config
+	// Timeout bounds the TCP connect and SSH handshake of every hop.
+	Timeout time.Duration
+	// Interactive allows prompting on the terminal, e.g. to trust a new host key.
+	Interactive bool
+	// IdentitiesOnly skips ssh-agent keys for the target (not its jump hosts),
+	// e.g. to prove that a specific key can log in.
+	IdentitiesOnly bool
+}
+
+const defaultDialTimeout = 15 * time.Second
+
+// Dial opens an authenticated client for conn, hopping through every entry of
+// conn.JumpHost in order. Closing the returned client also closes the hops.
+func Dial(conn config.Connection, opts DialOptions) (*ssh.Client, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultDialTimeout
+	}
+
+	hops, err := JumpChain(conn, opts.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	var opened []*ssh.Client
+	closeAll := func() {
+		for i := len(opened) - 1; i >= 0; i-- {
+			opened[i].Close()
+		}
+	}
+
+	var via *ssh.Client
+	for i, hop := range append(hops, conn) {
+		hopOpts := opts
+		if i < len(hops) {
+			hopOpts.IdentitiesOnly = false
+		}
+
+		client, err := dialHop(via, hop, hopOpts)
+		if err != nil {
+			closeAll()
+			if len(hops) > 0 {
+				return nil, fmt.Errorf("%s: %w", hopLabel(hop), err)
+			}
+			return nil, err
+		}
+
+		opened = append(opened, client)
+		via = client
+	}
+
+	if len(opened) > 1 {
+		go func() {
+			via.Wait()
+			closeAll()
+		}()
+	}
+
+	return via, nil
+}
+
+// JumpChain expands conn.JumpHost ("a,b,c") into the ordered list of hops.
+// Entries naming a saved connection reuse its settings, including its own
+// jump hosts; anything else is parsed as [user@]host[:port] and inherits the
+// target's user and key.
+func JumpChain(conn config.Connection, cfg *config.Config) ([]config.Connection, error) {
+	return jumpChain(conn, cfg, map[string]bool{conn.Name: true})
+}
+
+func jumpChain(conn config.Connection, cfg *config.Config, seen map[string]bool) ([]config.Connection, error) {
+	var chain []config.Connection
+
+	for _, spec := range strings.Split(conn.JumpHost, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		if cfg != nil {
+			if hop, ok := cfg.Connections[spec]; ok {
+				if seen[spec] {
+					return nil, fmt.Errorf("jump host loop detected at '%s'", spec)
+				}
+				seen[spec] = true
+
+				sub, err := jumpChain(hop, cfg, seen)
+				if err != nil {
+					return nil, err
+				}
+
+				chain = append(chain, sub...)
+				chain = append(chain, hop)
+				continue
+			}
+		}
+
+		hop, err := parseJumpSpec(spec, conn)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, hop)
+	}
+
+	return chain, nil
+}
+
+func parseJumpSpec(spec string, target config.Connection) (config.Connection, error) {
+	hop := config.Connection{
+		Name:            spec,
+		User:            target.User,
+		Port:            22,
+		IdentityFile:    target.IdentityFile,
+		CertificateFile: target.CertificateFile,
+		KeyPassphrase:   target.KeyPassphrase,
+	}
+
+	hostPart := spec
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		hop.User = spec[:i]
+		hostPart = spec[i+1:]
+	}
+
+	if strings.HasPrefix(hostPart, "[") || strings.Count(hostPart, ":") == 1 {
+		host, portStr, err := net.SplitHostPort(hostPart)
+		if err != nil {
+			return hop, fmt.Errorf("invalid jump host '%s': %v", spec, err)
+		}
+
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return hop, fmt.Errorf("invalid jump host port in '%s'", spec)
+		}
+
+		hostPart = host
+		hop.Port = port
+	}
+
+	if hostPart == "" {
+		return hop, fmt.Errorf("invalid jump host '%s'", spec)
+	}
+	hop.Host = hostPart
+
+	return hop, nil
+}
+
+// Address returns the host:port pair used to reach conn.
+func Address(conn config.Connection) string {
+	port := conn.Port
+	if port == 0 {
+		port = 22
+	}
+
+	return net.JoinHostPort(conn.Host, strconv.Itoa(port))
+}
+
+func hopLabel(conn config.Connection) string {
+	if conn.Name != "" {
+		return conn.Name
+	}
+
+	return Address(conn)
+}
+
+func dialHop(via *ssh.Client, conn config.Connection, opts DialOptions) (*ssh.Client, error) {
+	addr := Address(conn)
+
+	// The handshake gets its own deadline, paused while the user answers prompts
+	var deadline *time.Timer
+	pauseDeadline := func() (resume func()) {
+		if deadline == nil {
+			return func() {}
+		}
+		deadline.Stop()
+		return func() { deadline.Reset(opts.Timeout) }
+	}
+
+	// Resolve keys before connecting; later passphrase prompts pause the deadline
+	auth, closeAuth := authMethods(conn, opts, pauseDeadline)
+	// The agent is only asked during the handshake
+	defer closeAuth()
+
+	var netConn net.Conn
+	var err error
+
+	if via == nil {
+		netConn, err = net.DialTimeout("tcp", addr, opts.Timeout)
+	} else {
+		netConn, err = dialVia(via, addr, opts.Timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %v", addr, err)
+	}
+
+	deadline = time.AfterFunc(opts.Timeout, func() { netConn.Close() })
+	defer deadline.Stop()
+
+	hostKeyCallback := HostKeyCallback(opts.Interactive)
+
+	clientConfig := &ssh.ClientConfig{
+		User: conn.User,
+		Auth: auth,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			defer pauseDeadline()()
+			return hostKeyCallback(hostname, remote, key)
+		},
+		HostKeyAlgorithms: HostKeyAlgorithms(addr),
+		Timeout:           opts.Timeout,
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(netConn, addr, clientConfig)
+	if err != nil {
+		netConn.Close()
+		if isAuthFailure(err) {
+			return nil, &AuthError{Err: err}
+		}
+		return nil, err
+	}
+
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// AuthError means the server was reached but leap could not log in, as
+// opposed to a network or host key failure.
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string { return e.Err.Error() }
+func (e *AuthError) Unwrap() error { return e.Err }
+
+// isAuthFailure recognizes handshake errors caused by authentication. The
+// ssh package has no typed error for "no method worked", only its message.
+func isAuthFailure(err error) bool {
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		return true
+	}
+	return strings.Contains(err.Error(), "ssh: unable to authenticate")
+}
+
+func dialVia(via *ssh.Client, addr string, timeout time.Duration) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		c, err := via.Dial("tcp", addr)
+		ch <- result{c, err}
+	}()
+
+	select {
+	case res := <-ch:
+		return res.conn, res.err
+	case <-time.After(timeout):
+		go func() {
+			if res := <-ch; res.conn != nil {
+				res.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("timed out after %v", timeout)
+	}
+}
+
+// authMethods builds the full auth chain for conn: certificate and identity
+// file, ssh-agent, password, then keyboard-interactive. Password commands, TOTP codes and
+// prompts only happen if the server asks, with the handshake deadline paused.
+// An identity file that can't be used is skipped with a warning, and one
+// whose passphrase must be typed in is offered after the agent's keys.
+// The returned func closes the ssh-agent connection once auth is over.
+func authMethods(conn config.Connection, opts DialOptions, pauseDeadline func() func()) ([]ssh.AuthMethod, func()) {
+	var auth []ssh.AuthMethod
+	closeAuth := func() {}
+
+	if conn.IdentityFile == "" && conn.CertificateFile != "" {
+		conn.IdentityFile = IdentityForCertificate(conn.CertificateFile)
+	}
+
+	var keys, deferred []ssh.Signer
+	if conn.IdentityFile != "" {
+		signer, later, err := loadSigner(conn, opts, pauseDeadline)
+		if err != nil {
+			skipKey(conn.IdentityFile, err)
+		} else {
+			signers := []ssh.Signer{signer}
+			if conn.CertificateFile != "" {
+				if certSigner, err := loadCertSigner(conn.CertificateFile, signer); err != nil {
+					skipKey(conn.CertificateFile, err)
+				} else {
+					signers = []ssh.Signer{certSigner, signer}
+				}
+			}
+
+			if later {
+				deferred = signers
+			} else {
+				keys = signers
+			}
+		}
+	}
+
+	var agentSigners func() ([]ssh.Signer, error)
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" && !opts.IdentitiesOnly {
+		if netConn, err := net.Dial("unix", socket); err == nil {
+			agentSigners = agent.NewClient(netConn).Signers
+			closeAuth = func() { netConn.Close() }
+		}
+	}
+
+	// The ssh package never retries "publickey" once it has failed, so all
+	// keys go into one method
+	if len(keys) > 0 || len(deferred) > 0 || agentSigners != nil {
+		auth = append(auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			signers := append([]ssh.Signer{}, keys...)
+			if agentSigners != nil {
+				if fromAgent, err := agentSigners(); err == nil {
+					signers = append(signers, fromAgent...)
+				}
+			}
+			return append(signers, deferred...), nil
+		}))
+	}
+
+	if conn.Password != "" {
+		auth = append(auth, ssh.Password(conn.Password))
+	} else if conn.PasswordCommand != "" {
+		auth = append(auth, ssh.PasswordCallback(func() (string, error) {
+			defer pauseDeadline()()
+			return resolvePassword(conn, opts)
+		}))
+	}
+
+	if opts.Interactive || hasPassword(conn) || conn.TOTPSecret != "" {
+		auth = append(auth, keyboardInteractive(conn, opts, pauseDeadline))
+	}
+
+	return auth, closeAuth
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		return home + path[1:]
+	}
+
+	return path
+}
@@ -0,0 +1,131 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/paramientos/leap/internal/config"
+	"github.com/paramientos/leap/internal/utils"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+var (
+	// totpLastStep records the last time step used per seed and account, so
+	// no code is handed out twice; most servers reject a reused code.
+	totpMu       sync.Mutex
+	totpLastStep = make(map[string]uint64)
+)
+
+// keyboardInteractive answers keyboard-interactive challenges: OTP prompts
+// from the connection's TOTP seed, password prompts from its password or
+// password command, and anything else on the terminal.
+func keyboardInteractive(conn config.Connection, opts DialOptions, pauseDeadline func() func()) ssh.AuthMethod {
+	return ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+
+		for i, question := range questions {
+			var err error
+
+			switch {
+			case conn.TOTPSecret != "" && isOTPPrompt(question):
+				resume := pauseDeadline()
+				answers[i], err = totpCode(conn)
+				resume()
+
+			case hasPassword(conn) && isPasswordPrompt(question):
+				resume := pauseDeadline()
+				answers[i], err = resolvePassword(conn, opts)
+				resume()
+
+			default:
+				resume := pauseDeadline()
+				answers[i], err = promptChallenge(conn, opts, name, instruction, question, echos[i])
+				resume()
+
+				// Only show the banner once per round
+				name, instruction = "", ""
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return answers, nil
+	})
+}
+
+func isOTPPrompt(question string) bool {
+	q := strings.ToLower(question)
+	for _, hint := range []string{"verification code", "one-time", "one time", "otp", "token", "authenticator", "2fa", "two-factor", "mfa", "passcode"} {
+		if strings.Contains(q, hint) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isPasswordPrompt(question string) bool {
+	q := strings.ToLower(question)
+	return strings.Contains(q, "password") && !isOTPPrompt(q)
+}
+
+// totpCode returns the current code for conn's seed. If this process already
+// used that code for the same account it waits for the next time step; other
+// accounts, even with the same seed, are not held up.
+func totpCode(conn config.Connection) (string, error) {
+	key, err := utils.ParseTOTPKey(conn.TOTPSecret)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", conn.Name, err)
+	}
+
+	account := conn.TOTPSecret + "\x00" + conn.User + "@" + Address(conn)
+
+	// Reserve the step under the lock, then wait for it without the lock
+	totpMu.Lock()
+	step := key.Step(time.Now())
+	if last, ok := totpLastStep[account]; ok && step <= last {
+		step = last + 1
+	}
+	totpLastStep[account] = step
+	totpMu.Unlock()
+
+	time.Sleep(time.Until(key.StepStart(step)))
+
+	return key.Code(step), nil
+}
+
+func promptChallenge(conn config.Connection, opts DialOptions, name, instruction, question string, echo bool) (string, error) {
+	if !opts.Interactive || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", &AuthError{Err: fmt.Errorf("server asked %q and no terminal is available; save a TOTP seed with 'leap totp set %s'", strings.TrimSpace(question), conn.Name)}
+	}
+
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	if name != "" || instruction != "" {
+		fmt.Printf("\n🔐 \033[1;36m%s\033[0m", conn.Name)
+		if name != "" {
+			fmt.Printf(" \033[1m%s\033[0m", strings.TrimSpace(name))
+		}
+		fmt.Println()
+		if instruction != "" {
+			fmt.Printf("\033[90m%s\033[0m\n", strings.TrimSpace(instruction))
+		}
+	}
+
+	prompt := promptui.Prompt{
+		Label: strings.TrimSuffix(strings.TrimSpace(question), ":"),
+	}
+	if !echo {
+		prompt.Mask = '*'
+	}
+
+	return prompt.Run()
+}
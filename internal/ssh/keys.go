@@ -0,0 +1,277 @@
+package ssh
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/paramientos/leap/internal/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// SaveKeyPassphrase, when set, stores a key passphrase in the vault next to
+// the named connection. The CLI wires it up because it owns the master password.
+var SaveKeyPassphrase func(connName, passphrase string) error
+
+var (
+	// promptMu keeps concurrent dials from prompting over each other.
+	promptMu sync.Mutex
+
+	signerCacheMu sync.Mutex
+	signerCache   = make(map[string]ssh.Signer)
+
+	// skippedKeys remembers identity files already warned about, so redials
+	// don't repeat the warning.
+	skippedKeys sync.Map
+)
+
+// loadSigner parses conn's identity file, decrypting it with the stored
+// passphrase or one entered earlier in this process. A key that still needs
+// its passphrase typed in comes back as a deferredSigner with deferred set:
+// the prompt waits until the server accepts the key.
+func loadSigner(conn config.Connection, opts DialOptions, pauseDeadline func() func()) (signer ssh.Signer, deferred bool, err error) {
+	path := expandHome(conn.IdentityFile)
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	signerCacheMu.Lock()
+	signer, ok := signerCache[path]
+	signerCacheMu.Unlock()
+	if ok {
+		return signer, false, nil
+	}
+
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("identity file: %v", err)
+	}
+
+	signer, err = ssh.ParsePrivateKey(key)
+
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		signer, err = savedPassphraseSigner(conn, key)
+		if err == nil && signer == nil {
+			if !opts.Interactive || !term.IsTerminal(int(os.Stdin.Fd())) {
+				return nil, false, fmt.Errorf("identity file %s: key is passphrase protected; run 'leap connect %s' and save its passphrase to the vault", conn.IdentityFile, conn.Name)
+			}
+
+			load := func() (ssh.Signer, error) {
+				defer pauseDeadline()()
+				return promptSigner(conn, path, key, opts)
+			}
+
+			// Legacy PEM keys don't carry their public half; ask right away
+			pub := missing.PublicKey
+			if pub == nil {
+				pub = readPublicKey(path + ".pub")
+			}
+			if pub != nil {
+				return &deferredSigner{pub: pub, load: load}, true, nil
+			}
+			signer, err = load()
+		}
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("identity file %s: %v", conn.IdentityFile, err)
+	}
+
+	signerCacheMu.Lock()
+	signerCache[path] = signer
+	signerCacheMu.Unlock()
+
+	return signer, false, nil
+}
+
+// skipKey warns, once per identity file, that a key is left out of the
+// auth chain. The warning goes to stderr to keep JSON output clean.
+func skipKey(file string, err error) {
+	if _, seen := skippedKeys.LoadOrStore(file, true); seen {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\033[33m⚠\033[0m  %v; trying other auth methods\n", err)
+}
+
+// savedPassphraseSigner decrypts key with the passphrase stored in the
+// vault. It returns a nil signer when there is none or it no longer works.
+func savedPassphraseSigner(conn config.Connection, key []byte) (ssh.Signer, error) {
+	if conn.KeyPassphrase == "" {
+		return nil, nil
+	}
+
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(key, []byte(conn.KeyPassphrase))
+	if err == nil {
+		return signer, nil
+	}
+	if !errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "\n\033[33m⚠\033[0m  Saved passphrase for \033[1;36m%s\033[0m no longer works.\n", conn.IdentityFile)
+	return nil, nil
+}
+
+func readPublicKey(path string) ssh.PublicKey {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil
+	}
+	return pub
+}
+
+// deferredSigner stands in for a passphrase-protected key. Servers are
+// offered its public half first, so the passphrase is only asked for when
+// one accepts the key and a signature is actually needed.
+type deferredSigner struct {
+	pub  ssh.PublicKey
+	load func() (ssh.Signer, error)
+
+	once   sync.Once
+	signer ssh.Signer
+	err    error
+}
+
+func (s *deferredSigner) PublicKey() ssh.PublicKey { return s.pub }
+
+func (s *deferredSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(rand, data, "")
+}
+
+func (s *deferredSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	s.once.Do(func() { s.signer, s.err = s.load() })
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	if as, ok := s.signer.(ssh.AlgorithmSigner); ok {
+		return as.SignWithAlgorithm(rand, data, algorithm)
+	}
+	return s.signer.Sign(rand, data)
+}
+
+// promptSigner asks for the passphrase of key and offers to store it.
+func promptSigner(conn config.Connection, path string, key []byte, opts DialOptions) (ssh.Signer, error) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	// Another dial may have unlocked the same key while we waited
+	signerCacheMu.Lock()
+	signer, ok := signerCache[path]
+	signerCacheMu.Unlock()
+	if ok {
+		return signer, nil
+	}
+
+	fmt.Printf("\n🔑 Key \033[1;36m%s\033[0m is passphrase protected.\n", conn.IdentityFile)
+
+	var passphrase string
+	for attempt := 0; attempt < 3; attempt++ {
+		prompt := promptui.Prompt{
+			Label: "🔏 Key Passphrase",
+			Mask:  '*',
+		}
+
+		res, err := prompt.Run()
+		if err != nil {
+			return nil, err
+		}
+
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(res))
+		if err == nil {
+			passphrase = res
+			break
+		}
+
+		fmt.Printf("\033[31m✗\033[0m %v\n", err)
+	}
+
+	if signer == nil {
+		return nil, fmt.Errorf("too many incorrect passphrase attempts")
+	}
+
+	signerCacheMu.Lock()
+	signerCache[path] = signer
+	signerCacheMu.Unlock()
+
+	if isSavedConnection(conn, opts) && SaveKeyPassphrase != nil {
+		prompt := promptui.Prompt{
+			Label:     "Save passphrase in the encrypted vault",
+			IsConfirm: true,
+		}
+
+		if result, err := prompt.Run(); err == nil && strings.ToLower(result) == "y" {
+			if err := SaveKeyPassphrase(conn.Name, passphrase); err != nil {
+				fmt.Printf("\033[33m⚠\033[0m  Could not save passphrase: %v\n", err)
+			} else {
+				fmt.Printf("\033[32m✓\033[0m Passphrase saved for \033[1;36m%s\033[0m\n", conn.Name)
+			}
+		}
+	}
+
+	return signer, nil
+}
+
+// isSavedConnection reports whether conn is stored in the vault rather than
+// an ad-hoc jump host entry.
+func isSavedConnection(conn config.Connection, opts DialOptions) bool {
+	if opts.Config == nil {
+		return false
+	}
+
+	_, ok := opts.Config.Connections[conn.Name]
+	return ok
+}
+
+// IdentityForCertificate returns the private key that ssh-keygen pairs with
+// a certificate: "id_ed25519-cert.pub" belongs to "id_ed25519".
+func IdentityForCertificate(certFile string) string {
+	return strings.TrimSuffix(certFile, "-cert.pub")
+}
+
+// loadCertSigner wraps signer with the OpenSSH certificate in certFile. The
+// certificate must certify signer's key and be valid right now.
+func loadCertSigner(certFile string, signer ssh.Signer) (ssh.Signer, error) {
+	data, err := os.ReadFile(expandHome(certFile))
+	if err != nil {
+		return nil, fmt.Errorf("certificate file: %v", err)
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("certificate file %s: %v", certFile, err)
+	}
+
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("certificate file %s holds a plain public key, not a certificate", certFile)
+	}
+
+	now := time.Now()
+	if before := cert.ValidBefore; before != ssh.CertTimeInfinity && now.After(time.Unix(int64(before), 0)) {
+		return nil, fmt.Errorf("certificate %s expired at %s; renew it with 'leap ca sign'", certFile, time.Unix(int64(before), 0).Format("2006-01-02 15:04"))
+	}
+	if now.Before(time.Unix(int64(cert.ValidAfter), 0)) {
+		return nil, fmt.Errorf("certificate %s is not valid before %s", certFile, time.Unix(int64(cert.ValidAfter), 0).Format("2006-01-02 15:04"))
+	}
+
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("certificate file %s: %v", certFile, err)
+	}
+
+	return certSigner, nil
+}
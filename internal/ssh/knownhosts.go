@@ -0,0 +1,177 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/manifoldco/promptui"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
+)
+
+// hostKeyMu serializes known_hosts reads, prompts and writes so concurrent
+// dials (monitor, exec --all) never interleave prompts or corrupt the file.
+var hostKeyMu sync.Mutex
+
+// KnownHostsPath returns the known_hosts file shared with the system ssh client.
+func KnownHostsPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+// HostKeyChangedError is returned when a server presents a key that differs
+// from the one recorded in known_hosts.
+type HostKeyChangedError struct {
+	Host      string
+	Presented ssh.PublicKey
+	Known     []knownhosts.KnownKey
+}
+
+func (e *HostKeyChangedError) Error() string {
+	var b strings.Builder
+
+	b.WriteString("REMOTE HOST IDENTIFICATION HAS CHANGED! Someone could be eavesdropping on you right now.\n")
+	fmt.Fprintf(&b, "  Host:      %s\n", e.Host)
+	fmt.Fprintf(&b, "  Presented: %s %s\n", e.Presented.Type(), ssh.FingerprintSHA256(e.Presented))
+
+	for _, k := range e.Known {
+		fmt.Fprintf(&b, "  Expected:  %s %s (%s:%d)\n", k.Key.Type(), ssh.FingerprintSHA256(k.Key), k.Filename, k.Line)
+	}
+
+	b.WriteString("  Remove the stale entry from known_hosts if the change is expected.")
+
+	return b.String()
+}
+
+// HostKeyCallback verifies server keys against known_hosts. Unknown hosts are
+// trusted on first use once the user confirms the fingerprint; when
+// interactive is false (or stdin is not a terminal) they are rejected instead.
+// Changed keys are always rejected.
+func HostKeyCallback(interactive bool) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostKeyMu.Lock()
+		defer hostKeyMu.Unlock()
+
+		path := KnownHostsPath()
+
+		err := checkKnownHosts(path, hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+
+		if len(keyErr.Want) > 0 {
+			return &HostKeyChangedError{Host: hostname, Presented: key, Known: keyErr.Want}
+		}
+
+		if !interactive || !term.IsTerminal(int(os.Stdin.Fd())) {
+			return fmt.Errorf("host key for %s is unknown (%s %s); connect interactively once to trust it",
+				hostname, key.Type(), ssh.FingerprintSHA256(key))
+		}
+
+		fmt.Printf("\n\033[33m⚠\033[0m  The authenticity of host \033[1;36m%s\033[0m can't be established.\n", hostname)
+		fmt.Printf("   %s key fingerprint is \033[1m%s\033[0m\n", key.Type(), ssh.FingerprintSHA256(key))
+
+		prompt := promptui.Prompt{
+			Label:     "Trust this host and add it to known_hosts",
+			IsConfirm: true,
+		}
+
+		result, err := prompt.Run()
+		if err != nil || strings.ToLower(result) != "y" {
+			return fmt.Errorf("host key for %s was not trusted", hostname)
+		}
+
+		if err := appendKnownHost(path, hostname, key); err != nil {
+			return fmt.Errorf("failed to update %s: %v", path, err)
+		}
+
+		fmt.Printf("\033[32m✓\033[0m Added \033[1;36m%s\033[0m to %s\n\n", hostname, path)
+
+		return nil
+	}
+}
+
+// HostKeyAlgorithms returns the key algorithms already recorded for addr so
+// the server is asked for a key type we can actually verify. It returns nil
+// for unknown hosts, letting the client negotiate its defaults.
+func HostKeyAlgorithms(addr string) []string {
+	hostKeyMu.Lock()
+	defer hostKeyMu.Unlock()
+
+	err := checkKnownHosts(KnownHostsPath(), addr, &net.TCPAddr{IP: net.IPv4zero}, probeKey{})
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	var algos []string
+	seen := make(map[string]bool)
+
+	for _, k := range keyErr.Want {
+		for _, algo := range algorithmsForKeyType(k.Key.Type()) {
+			if !seen[algo] {
+				seen[algo] = true
+				algos = append(algos, algo)
+			}
+		}
+	}
+
+	return algos
+}
+
+func checkKnownHosts(path, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return &knownhosts.KeyError{}
+	}
+
+	check, err := knownhosts.New(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	return check(hostname, remote, key)
+}
+
+func appendKnownHost(path, hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+
+	return err
+}
+
+func algorithmsForKeyType(keyType string) []string {
+	if keyType == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+
+	return []string{keyType}
+}
+
+// probeKey never matches a known_hosts entry, so checking it yields every
+// key recorded for a host.
+type probeKey struct{}
+
+func (probeKey) Type() string                            { return "leap-probe" }
+func (probeKey) Marshal() []byte                         { return []byte("leap-probe") }
+func (probeKey) Verify(_ []byte, _ *ssh.Signature) error { return errors.New("probe key") }
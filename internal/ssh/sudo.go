@@ -0,0 +1,378 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/manifoldco/promptui"
+	"github.com/paramientos/leap/internal/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// errSudoNeedsTTY means sudoers has requiretty set and the command has to
+// be run again on a PTY.
+var errSudoNeedsTTY = errors.New("sudo requires a tty")
+
+var (
+	sudoPromptCacheMu sync.Mutex
+	sudoPromptCache   = make(map[string]string)
+)
+
+// SudoOptions controls a command run through sudo.
+type SudoOptions struct {
+	Conn config.Connection
+	Dial DialOptions
+	// Stdin is fed to the command once sudo has let it start.
+	Stdin  []byte
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// SudoPassword returns what to answer sudo with on conn: its sudo password,
+// the output of its sudo password command, its login password, or, with a
+// terminal, whatever the user types.
+func SudoPassword(conn config.Connection, opts DialOptions) (string, error) {
+	switch {
+	case conn.SudoPassword != "":
+		return conn.SudoPassword, nil
+	case conn.SudoPasswordCommand != "":
+		return resolveHelper(conn, conn.SudoPasswordCommand, opts)
+	case hasPassword(conn):
+		return resolvePassword(conn, opts)
+	}
+
+	if !opts.Interactive || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", &AuthError{Err: fmt.Errorf("sudo asked for a password and none is saved for %s; add a sudo password with 'leap edit %s'", conn.Name, conn.Name)}
+	}
+
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	sudoPromptCacheMu.Lock()
+	password, ok := sudoPromptCache[conn.Name]
+	sudoPromptCacheMu.Unlock()
+	if ok {
+		return password, nil
+	}
+
+	prompt := promptui.Prompt{
+		Label: fmt.Sprintf("[sudo] password for %s@%s", conn.User, conn.Name),
+		Mask:  '*',
+	}
+
+	password, err := prompt.Run()
+	if err != nil {
+		return "", err
+	}
+
+	sudoPromptCacheMu.Lock()
+	sudoPromptCache[conn.Name] = password
+	sudoPromptCacheMu.Unlock()
+
+	return password, nil
+}
+
+// RunSudo runs command as root through "sudo -S" on a session from open.
+// sudo's password prompt is answered with SudoPassword, and Stdin is held
+// back until the command itself starts, so the password only ever reaches
+// sudo: it is not on the command line, and neither it nor the prompt shows
+// up in the output. If sudoers requires a tty, the command is run again on a
+// PTY with echo off.
+func RunSudo(open func() (*ssh.Session, error), command string, opts SudoOptions) error {
+	err := runSudo(open, command, opts, false)
+	if !errors.Is(err, errSudoNeedsTTY) {
+		return err
+	}
+
+	// A shell reading a script from a tty turns interactive, so stdin is
+	// staged in a private file first instead of typed into the PTY
+	staged := ""
+	if len(opts.Stdin) > 0 {
+		path, err := stageStdin(open, opts.Stdin)
+		if err != nil {
+			return err
+		}
+
+		quoted := ShellQuote(path)
+		command = fmt.Sprintf("(%s) < %s; status=$?; rm -f %s; exit $status", command, quoted, quoted)
+		opts.Stdin = nil
+		staged = path
+	}
+
+	err = runSudo(open, command, opts, true)
+
+	// The command removes the file itself, but only if sudo let it run
+	if err != nil && staged != "" {
+		removeStaged(open, staged)
+	}
+
+	return err
+}
+
+// removeStaged deletes a file written by stageStdin, as the login user.
+func removeStaged(open func() (*ssh.Session, error), path string) {
+	session, err := open()
+	if err != nil {
+		return
+	}
+	defer session.Close()
+
+	session.Run("rm -f " + ShellQuote(path))
+}
+
+// stageStdin writes data to a new file only the login user can read and
+// returns its path.
+func stageStdin(open func() (*ssh.Session, error), data []byte) (string, error) {
+	session, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	session.Stdin = bytes.NewReader(data)
+	out, err := session.Output(`f=$(umask 077; mktemp) && cat > "$f" && echo "$f"`)
+	if err != nil {
+		return "", fmt.Errorf("staging stdin for sudo: %v", err)
+	}
+
+	return string(bytes.TrimSpace(out)), nil
+}
+
+func runSudo(open func() (*ssh.Session, error), command string, opts SudoOptions, pty bool) error {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+
+	// Unique markers can't be confused with anything the command prints
+	w := &sudoWatch{
+		prompt:   []byte("[leap-sudo " + hex.EncodeToString(token) + "]"),
+		ready:    []byte("leap-sudo-ready " + hex.EncodeToString(token)),
+		password: func() (string, error) { return SudoPassword(opts.Conn, opts.Dial) },
+		started:  make(chan struct{}),
+	}
+
+	wrapped := sudoCommand(w, command)
+
+	session, err := open()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	w.session = session
+
+	if pty {
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          0,
+			ssh.ONLCR:         0,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := session.RequestPty("xterm", 24, 200, modes); err != nil {
+			return fmt.Errorf("sudo requires a tty and none could be allocated: %v", err)
+		}
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	w.stdin = stdin
+
+	stdout, stderr := w.stream(opts.Stdout), w.stream(opts.Stderr)
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	if err := session.Start(wrapped); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+
+	select {
+	case <-w.started:
+		stdin.Write(opts.Stdin)
+		if pty {
+			// A tty has no EOF of its own; ^D ends a partial line, then input
+			if n := len(opts.Stdin); n > 0 && opts.Stdin[n-1] != '\n' {
+				io.WriteString(stdin, "\x04")
+			}
+			io.WriteString(stdin, "\x04")
+		} else {
+			stdin.Close()
+		}
+		err = <-done
+	case err = <-done:
+	}
+
+	return w.finish(err, pty)
+}
+
+// sudoCommand wraps command in sudo with w's prompt, announcing the start
+// with w's ready marker. sudo runs under LC_ALL=C so the requiretty message
+// can be recognized in any locale; the command gets the caller's LC_ALL back.
+func sudoCommand(w *sudoWatch, command string) string {
+	script := `if [ -n "$1" ]; then LC_ALL=$1; export LC_ALL; else unset LC_ALL; fi; ` +
+		"echo '" + string(w.ready) + "' >&2; " + command
+
+	return fmt.Sprintf(`LC_ALL=C sudo -S -p %s -- sh -c %s leap-sudo "${LC_ALL-}"`,
+		ShellQuote(string(w.prompt)), ShellQuote(script))
+}
+
+// sudoWatch sits between a sudo session and the real output. Until the
+// command starts it holds everything back, answering and removing sudo's
+// prompt; after that output passes straight through.
+type sudoWatch struct {
+	mu       sync.Mutex
+	prompt   []byte
+	ready    []byte
+	password func() (string, error)
+	session  io.Closer
+	stdin    io.WriteCloser
+	streams  []*sudoStream
+	prompts  int
+	running  bool
+	started  chan struct{}
+	err      error
+}
+
+type sudoStream struct {
+	w   *sudoWatch
+	out io.Writer
+	buf []byte
+	// brk is set while the line break after a removed marker, which can
+	// come in a later write, is still to be dropped.
+	brk bool
+}
+
+func (w *sudoWatch) stream(out io.Writer) *sudoStream {
+	if out == nil {
+		out = io.Discard
+	}
+	s := &sudoStream{w: w, out: out}
+	w.streams = append(w.streams, s)
+	return s
+}
+
+func (s *sudoStream) Write(p []byte) (int, error) {
+	w := s.w
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := len(p)
+	p = s.trimBreak(p)
+
+	if w.running {
+		if _, err := s.out.Write(p); err != nil {
+			return 0, err
+		}
+		return n, nil
+	}
+
+	s.buf = append(s.buf, p...)
+
+	for {
+		if i := bytes.Index(s.buf, w.prompt); i >= 0 {
+			s.cut(i, len(w.prompt))
+			w.answer()
+			continue
+		}
+
+		if i := bytes.Index(s.buf, w.ready); i >= 0 {
+			s.cut(i, len(w.ready))
+			w.start()
+		}
+
+		return n, nil
+	}
+}
+
+// cut removes the marker of length n at buf[i] along with its line break.
+func (s *sudoStream) cut(i, n int) {
+	s.brk = true
+	s.buf = append(s.buf[:i], s.trimBreak(s.buf[i+n:])...)
+}
+
+// trimBreak drops the pending line break from the start of p.
+func (s *sudoStream) trimBreak(p []byte) []byte {
+	if !s.brk {
+		return p
+	}
+	p = bytes.TrimPrefix(p, []byte("\r"))
+	if len(p) == 0 {
+		return p
+	}
+
+	s.brk = false
+	return bytes.TrimPrefix(p, []byte("\n"))
+}
+
+// answer sends the password on sudo's first prompt. A second prompt means
+// it was wrong; the session is closed instead of letting sudo ask again.
+func (w *sudoWatch) answer() {
+	w.prompts++
+	if w.prompts > 1 {
+		w.fail(&AuthError{Err: fmt.Errorf("sudo: incorrect password")})
+		return
+	}
+
+	password, err := w.password()
+	if err != nil {
+		w.fail(err)
+		return
+	}
+
+	io.WriteString(w.stdin, password+"\n")
+}
+
+func (w *sudoWatch) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+	w.session.Close()
+}
+
+// start lets output through, beginning with what was held back.
+func (w *sudoWatch) start() {
+	w.running = true
+	for _, s := range w.streams {
+		s.out.Write(s.buf)
+		s.buf = nil
+	}
+	close(w.started)
+}
+
+// finish reports how the session ended. Output held back from a command
+// that never started is mostly sudo explaining why, so it is shown.
+func (w *sudoWatch) finish(err error, pty bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.running {
+		if !pty && w.err == nil {
+			for _, s := range w.streams {
+				if bytes.Contains(s.buf, []byte("must have a tty")) {
+					return errSudoNeedsTTY
+				}
+			}
+		}
+
+		for _, s := range w.streams {
+			s.out.Write(s.buf)
+			s.buf = nil
+		}
+	}
+
+	if w.err != nil {
+		return w.err
+	}
+	return err
+}
@@ -0,0 +1,220 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fakeStdin struct{ bytes.Buffer }
+
+func (f *fakeStdin) Close() error { return nil }
+
+type fakeSession struct{ closed bool }
+
+func (f *fakeSession) Close() error {
+	f.closed = true
+	return nil
+}
+
+const (
+	testPrompt   = "[leap-sudo 0123456789abcdef]"
+	testReady    = "leap-sudo-ready 0123456789abcdef"
+	testPassword = "s3cret-pw"
+)
+
+// write is one chunk of session output; stderr picks the stream.
+type write struct {
+	stderr bool
+	data   string
+}
+
+// chunks splits s into pieces of n bytes on one stream.
+func chunks(stderr bool, s string, n int) []write {
+	var out []write
+	for len(s) > n {
+		out = append(out, write{stderr, s[:n]})
+		s = s[n:]
+	}
+	return append(out, write{stderr, s})
+}
+
+func join(parts ...[]write) []write {
+	var out []write
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func TestSudoWatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		writes     []write
+		stdout     string
+		stderr     string
+		answered   bool
+		authError  bool
+		notStarted bool
+	}{
+		{
+			name: "password",
+			writes: []write{
+				{true, testPrompt},
+				{true, "\n" + testReady + "\n"},
+				{false, "hello\n"},
+				{true, "warning\n"},
+			},
+			stdout:   "hello\n",
+			stderr:   "warning\n",
+			answered: true,
+		},
+		{
+			name: "markers split across writes",
+			writes: join(
+				chunks(true, testPrompt, 3),
+				chunks(true, "\n"+testReady+"\n", 5),
+				[]write{{false, "out\n"}},
+			),
+			stdout:   "out\n",
+			answered: true,
+		},
+		{
+			name: "marker split from its line break",
+			writes: []write{
+				{true, testPrompt},
+				{true, "\r\n" + testReady},
+				{true, "\n"},
+				{true, "err\n"},
+			},
+			stderr:   "err\n",
+			answered: true,
+		},
+		{
+			name: "output held until the command starts",
+			writes: []write{
+				{false, "early "},
+				{true, testReady + "\n"},
+				{false, "late\n"},
+			},
+			stdout: "early late\n",
+		},
+		{
+			name: "no password needed",
+			writes: []write{
+				{true, testReady + "\n"},
+				{false, "root\n"},
+			},
+			stdout: "root\n",
+		},
+		{
+			name: "wrong password",
+			writes: []write{
+				{true, testPrompt},
+				{true, "\nSorry, try again.\n" + testPrompt[:5]},
+				{true, testPrompt[5:]},
+			},
+			stderr:     "Sorry, try again.\n",
+			answered:   true,
+			authError:  true,
+			notStarted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			session := &fakeSession{}
+			stdin := &fakeStdin{}
+			w := &sudoWatch{
+				prompt: []byte(testPrompt),
+				ready:  []byte(testReady),
+				password: func() (string, error) {
+					calls++
+					return testPassword, nil
+				},
+				session: session,
+				stdin:   stdin,
+				started: make(chan struct{}),
+			}
+
+			var stdout, stderr bytes.Buffer
+			outStream, errStream := w.stream(&stdout), w.stream(&stderr)
+			for _, wr := range tt.writes {
+				s := outStream
+				if wr.stderr {
+					s = errStream
+				}
+				if n, err := s.Write([]byte(wr.data)); err != nil || n != len(wr.data) {
+					t.Fatalf("Write = %d, %v", n, err)
+				}
+			}
+
+			err := w.finish(nil, false)
+
+			for name, got := range map[string]string{"stdout": stdout.String(), "stderr": stderr.String()} {
+				for _, secret := range []string{testPrompt, testReady, testPassword, "leap-sudo"} {
+					if strings.Contains(got, secret) {
+						t.Errorf("%s leaks %q: %q", name, secret, got)
+					}
+				}
+			}
+			if stdout.String() != tt.stdout {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.stdout)
+			}
+			if stderr.String() != tt.stderr {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.stderr)
+			}
+
+			wantStdin := ""
+			if tt.answered {
+				wantStdin = testPassword + "\n"
+			}
+			if stdin.String() != wantStdin {
+				t.Errorf("stdin = %q, want %q", stdin.String(), wantStdin)
+			}
+			if tt.answered && calls != 1 {
+				t.Errorf("password asked for %d times, want once", calls)
+			}
+
+			var authErr *AuthError
+			if got := errors.As(err, &authErr); got != tt.authError {
+				t.Errorf("finish error = %v, want AuthError %v", err, tt.authError)
+			}
+			if session.closed != tt.authError {
+				t.Errorf("session closed = %v, want %v", session.closed, tt.authError)
+			}
+			if w.running == tt.notStarted {
+				t.Errorf("running = %v, want %v", w.running, !tt.notStarted)
+			}
+		})
+	}
+}
+
+func TestSudoWatchRequiresTTY(t *testing.T) {
+	w := &sudoWatch{
+		prompt:  []byte(testPrompt),
+		ready:   []byte(testReady),
+		session: &fakeSession{},
+		started: make(chan struct{}),
+	}
+
+	var stderr bytes.Buffer
+	w.stream(&stderr).Write([]byte("sudo: sorry, you must have a tty to run sudo\n"))
+
+	if err := w.finish(errors.New("exit status 1"), false); !errors.Is(err, errSudoNeedsTTY) {
+		t.Errorf("finish = %v, want errSudoNeedsTTY", err)
+	}
+}
+
+func TestSudoCommand(t *testing.T) {
+	w := &sudoWatch{prompt: []byte(testPrompt), ready: []byte(testReady)}
+	got := sudoCommand(w, "id -u")
+
+	for _, want := range []string{"LC_ALL=C sudo -S -p '" + testPrompt + "'", `leap-sudo "${LC_ALL-}"`, "id -u"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("sudoCommand = %q, missing %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// FS is one side of a transfer. Paths use the side's own separator.
+type FS interface {
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	Open(name string) (io.ReadSeekCloser, error)
+	// OpenWriter opens name for writing at offset, truncating it when offset is 0.
+	OpenWriter(name string, offset int64) (io.WriteCloser, error)
+	Mkdir(name string) error
+	MkdirAll(name string) error
+	RemoveAll(name string) error
+	// Home returns the directory relative paths start from.
+	Home() (string, error)
+	Chmod(name string, mode os.FileMode) error
+	Chtimes(name string, mtime time.Time) error
+	Rename(from, to string) error
+	Remove(name string) error
+	Checksum(name string) (string, error)
+	Join(elem ...string) string
+	Base(name string) string
+	Dir(name string) string
+	Glob(pattern string) ([]string, error)
+}
+
+// LocalFS returns the local file system.
+func LocalFS() FS {
+	return localFS{}
+}
+
+type localFS struct{}
+
+func (localFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+func (localFS) ReadDir(name string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+func (localFS) Open(name string) (io.ReadSeekCloser, error) { return os.Open(name) }
+
+func (localFS) OpenWriter(name string, offset int64) (io.WriteCloser, error) {
+	if offset == 0 {
+		return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (localFS) Mkdir(name string) error                    { return os.Mkdir(name, 0755) }
+func (localFS) MkdirAll(name string) error                 { return os.MkdirAll(name, 0755) }
+func (localFS) RemoveAll(name string) error                { return os.RemoveAll(name) }
+func (localFS) Home() (string, error)                      { return os.Getwd() }
+func (localFS) Chmod(name string, mode os.FileMode) error  { return os.Chmod(name, mode) }
+func (localFS) Chtimes(name string, mtime time.Time) error { return os.Chtimes(name, mtime, mtime) }
+func (localFS) Rename(from, to string) error               { return os.Rename(from, to) }
+func (localFS) Remove(name string) error                   { return os.Remove(name) }
+func (localFS) Join(elem ...string) string                 { return filepath.Join(elem...) }
+func (localFS) Base(name string) string                    { return filepath.Base(name) }
+func (localFS) Dir(name string) string                     { return filepath.Dir(name) }
+func (localFS) Glob(pattern string) ([]string, error)      { return filepath.Glob(pattern) }
+
+func (localFS) Checksum(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return hashReader(f)
+}
+
+type remoteFS struct {
+	ssh  *ssh.Client
+	sftp *sftp.Client
+}
+
+func (r remoteFS) Stat(name string) (os.FileInfo, error) { return r.sftp.Stat(name) }
+
+func (r remoteFS) ReadDir(name string) ([]os.FileInfo, error) { return r.sftp.ReadDir(name) }
+
+func (r remoteFS) Open(name string) (io.ReadSeekCloser, error) { return r.sftp.Open(name) }
+
+// OpenWriter never uses O_APPEND: concurrent SFTP writes carry explicit
+// offsets, which O_APPEND would make the server ignore.
+func (r remoteFS) OpenWriter(name string, offset int64) (io.WriteCloser, error) {
+	if offset == 0 {
+		return r.sftp.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	}
+
+	f, err := r.sftp.OpenFile(name, os.O_WRONLY)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (r remoteFS) Mkdir(name string) error                   { return r.sftp.Mkdir(name) }
+func (r remoteFS) MkdirAll(name string) error                { return r.sftp.MkdirAll(name) }
+func (r remoteFS) Home() (string, error)                     { return r.sftp.Getwd() }
+func (r remoteFS) Chmod(name string, mode os.FileMode) error { return r.sftp.Chmod(name, mode) }
+func (r remoteFS) Chtimes(name string, mtime time.Time) error {
+	return r.sftp.Chtimes(name, mtime, mtime)
+}
+func (r remoteFS) Remove(name string) error              { return r.sftp.Remove(name) }
+func (r remoteFS) Join(elem ...string) string            { return path.Join(elem...) }
+func (r remoteFS) Base(name string) string               { return path.Base(name) }
+func (r remoteFS) Dir(name string) string                { return path.Dir(name) }
+func (r remoteFS) Glob(pattern string) ([]string, error) { return r.sftp.Glob(pattern) }
+
+// RemoveAll deletes name and, for a real directory, its contents. Unlike
+// sftp.Client.RemoveAll it never follows a symlink: the link itself goes.
+func (r remoteFS) RemoveAll(name string) error {
+	info, err := r.sftp.Lstat(name)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return r.sftp.Remove(name)
+	}
+
+	entries, err := r.sftp.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := r.RemoveAll(path.Join(name, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return r.sftp.RemoveDirectory(name)
+}
+
+// Rename replaces an existing target; plain SFTP rename refuses to.
+func (r remoteFS) Rename(from, to string) error {
+	if err := r.sftp.PosixRename(from, to); err == nil {
+		return nil
+	}
+
+	r.sftp.Remove(to)
+	return r.sftp.Rename(from, to)
+}
+
+// Checksum asks the server to hash the file, which avoids reading it back
+// over the network. Servers without sha256sum or shasum fall back to SFTP.
+func (r remoteFS) Checksum(name string) (string, error) {
+	if session, err := r.ssh.NewSession(); err == nil {
+		quoted := "'" + strings.ReplaceAll(name, "'", `'\''`) + "'"
+		out, err := session.Output(fmt.Sprintf("sha256sum < %s 2>/dev/null || shasum -a 256 < %s", quoted, quoted))
+		session.Close()
+
+		if fields := strings.Fields(string(out)); err == nil && len(fields) > 0 && len(fields[0]) == 64 {
+			return fields[0], nil
+		}
+	}
+
+	f, err := r.sftp.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return hashReader(f)
+}
+
+func hashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// expandGlobs resolves patterns on fs. Patterns without matches that contain
+// no glob characters are kept, so the missing file is reported by Stat.
+func expandGlobs(fs FS, patterns []string) ([]string, error) {
+	var paths []string
+
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			paths = append(paths, pattern)
+			continue
+		}
+
+		matches, err := fs.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no matches", pattern)
+		}
+
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+
+	return paths, nil
+}
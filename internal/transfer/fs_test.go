@@ -0,0 +1,69 @@
+package transfer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// pipeRemote serves the local file system over SFTP through a pipe.
+func pipeRemote(t *testing.T) remoteFS {
+	t.Helper()
+
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverIn, serverOut})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientIn, clientOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// Ending both streams lets the client and server loops return
+		clientOut.Close()
+		serverOut.Close()
+		client.Close()
+	})
+
+	return remoteFS{sftp: client}
+}
+
+func TestRemoteRemoveAllKeepsSymlinkTargets(t *testing.T) {
+	root := t.TempDir()
+	release := filepath.Join(root, "releases", "123")
+	writeFile(t, filepath.Join(release, "app"))
+	writeFile(t, filepath.Join(root, "old", "nested", "file"))
+	if err := os.Symlink(release, filepath.Join(root, "old", "current")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	if err := os.Symlink(release, filepath.Join(root, "current")); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := pipeRemote(t)
+
+	// A link at the top and one inside a deleted directory
+	for _, name := range []string{"current", "old"} {
+		if err := fs.RemoveAll(filepath.Join(root, name)); err != nil {
+			t.Fatalf("RemoveAll(%s): %v", name, err)
+		}
+		if _, err := os.Lstat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Errorf("%s still exists: %v", name, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(release, "app")); err != nil {
+		t.Errorf("symlink target contents were deleted: %v", err)
+	}
+}
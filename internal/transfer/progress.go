@@ -0,0 +1,120 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paramientos/leap/internal/utils"
+	"golang.org/x/term"
+)
+
+const (
+	barWidth      = 24
+	nameWidth     = 28
+	redrawEvery   = 100 * time.Millisecond
+	progressClear = "\r\033[2K"
+)
+
+// progressBar renders one file's progress on a single terminal line. When
+// out is not a terminal only the final line is printed.
+type progressBar struct {
+	mu      sync.Mutex
+	out     io.Writer
+	tty     bool
+	name    string
+	total   int64
+	done    int64
+	resumed int64
+	start   time.Time
+	drawn   time.Time
+	notify  func(file string, done, total int64)
+}
+
+func newProgressBar(out io.Writer, name string, total, resumed int64, notify func(string, int64, int64)) *progressBar {
+	tty := false
+	if f, ok := out.(*os.File); ok {
+		tty = term.IsTerminal(int(f.Fd()))
+	}
+
+	return &progressBar{
+		out:     out,
+		tty:     tty,
+		name:    name,
+		total:   total,
+		done:    resumed,
+		resumed: resumed,
+		start:   time.Now(),
+		notify:  notify,
+	}
+}
+
+func (p *progressBar) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done += int64(len(b))
+	if time.Since(p.drawn) >= redrawEvery {
+		if p.tty {
+			p.draw()
+		}
+		if p.notify != nil {
+			p.notify(p.name, p.done, p.total)
+		}
+		p.drawn = time.Now()
+	}
+
+	return len(b), nil
+}
+
+func (p *progressBar) draw() {
+	pct := 100.0
+	if p.total > 0 {
+		pct = float64(p.done) * 100 / float64(p.total)
+	}
+
+	filled := int(pct / 100 * barWidth)
+	if filled > barWidth {
+		filled = barWidth
+	}
+
+	fmt.Fprintf(p.out, "%s  %-*s \033[36m%s\033[90m%s\033[0m %3.0f%%  %s/%s  %s",
+		progressClear, nameWidth, truncateName(p.name), strings.Repeat("█", filled), strings.Repeat("░", barWidth-filled),
+		pct, utils.FormatBytes(p.done), utils.FormatBytes(p.total), p.rate())
+}
+
+func (p *progressBar) rate() string {
+	elapsed := time.Since(p.start).Seconds()
+	if elapsed <= 0 {
+		return ""
+	}
+
+	return utils.FormatBytes(int64(float64(p.done-p.resumed)/elapsed)) + "/s"
+}
+
+// finish replaces the bar with a status line.
+func (p *progressBar) finish(symbol, note string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.tty {
+		fmt.Fprint(p.out, progressClear)
+	}
+	if p.notify != nil {
+		p.notify(p.name, p.done, p.total)
+	}
+
+	fmt.Fprintf(p.out, "  %s %-*s %10s  %s\n", symbol, nameWidth, truncateName(p.name), utils.FormatBytes(p.total), note)
+}
+
+func truncateName(name string) string {
+	runes := []rune(name)
+	if len(runes) <= nameWidth {
+		return name
+	}
+
+	return "…" + string(runes[len(runes)-nameWidth+1:])
+}
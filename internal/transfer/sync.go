@@ -0,0 +1,451 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/paramientos/leap/internal/utils"
+)
+
+// SyncOptions controls a directory sync.
+type SyncOptions struct {
+	// Delete removes destination entries that no longer exist in the source.
+	Delete bool
+	// Checksum compares files by SHA-256 instead of size and mtime.
+	Checksum bool
+	// Exclude holds glob patterns matched against each entry's name and its
+	// path relative to the root. A trailing "/" only matches directories.
+	Exclude []string
+	// DryRun prints the plan without changing anything.
+	DryRun bool
+	// Verify compares SHA-256 checksums of both sides after each copy.
+	Verify bool
+	// Out receives the plan and per-file results; nil discards them.
+	Out io.Writer
+}
+
+// ChangeKind is what a sync does to one path.
+type ChangeKind int
+
+const (
+	ChangeAdd ChangeKind = iota
+	ChangeUpdate
+	ChangeDelete
+)
+
+func (k ChangeKind) symbol() string {
+	switch k {
+	case ChangeAdd:
+		return "\033[32m+\033[0m"
+	case ChangeUpdate:
+		return "\033[33m~\033[0m"
+	default:
+		return "\033[31m-\033[0m"
+	}
+}
+
+// Change is one planned step, with Path relative to the sync roots.
+type Change struct {
+	Kind ChangeKind
+	Path string
+	Dir  bool
+	Size int64
+}
+
+// SyncStats summarizes a sync.
+type SyncStats struct {
+	Added     int
+	Updated   int
+	Deleted   int
+	Unchanged int
+	Failed    int
+	Bytes     int64
+}
+
+// Push makes the remote directory mirror the local one.
+func (s *Session) Push(local, remote string, opts SyncOptions) (SyncStats, error) {
+	return syncTrees(localFS{}, s.remote(), local, RemotePath(remote), opts)
+}
+
+// Pull makes the local directory mirror the remote one.
+func (s *Session) Pull(remote, local string, opts SyncOptions) (SyncStats, error) {
+	return syncTrees(s.remote(), localFS{}, RemotePath(remote), local, opts)
+}
+
+// syncTrees compares the contents of srcRoot and dstRoot and copies what is
+// missing or different, like rsync with a trailing slash on the source.
+func syncTrees(src, dst FS, srcRoot, dstRoot string, opts SyncOptions) (SyncStats, error) {
+	var stats SyncStats
+
+	out := opts.Out
+	if out == nil {
+		out = io.Discard
+	}
+
+	info, err := src.Stat(srcRoot)
+	if err != nil {
+		return stats, err
+	}
+	if !info.IsDir() {
+		return stats, fmt.Errorf("%s: not a directory", srcRoot)
+	}
+
+	srcTree := map[string]os.FileInfo{}
+	skipped := map[string]bool{}
+	unreadable, err := walkTree(src, srcRoot, "", opts.Exclude, srcTree, skipped, out)
+	if err != nil {
+		return stats, err
+	}
+
+	dstTree := map[string]os.FileInfo{}
+	if dinfo, err := dst.Stat(dstRoot); err == nil {
+		if !dinfo.IsDir() {
+			return stats, fmt.Errorf("%s: not a directory", dstRoot)
+		}
+		if _, err := walkTree(dst, dstRoot, "", opts.Exclude, dstTree, map[string]bool{}, io.Discard); err != nil {
+			return stats, err
+		}
+	} else if !os.IsNotExist(err) {
+		return stats, fmt.Errorf("%s: %v", dstRoot, err)
+	}
+
+	// Like rsync, an incomplete picture of the source means nothing can be
+	// known to be gone from it
+	if unreadable > 0 && opts.Delete {
+		fmt.Fprintf(out, "  \033[33m⚠\033[0m  %d source entries could not be read; skipping deletions\n", unreadable)
+		opts.Delete = false
+	}
+
+	plan, unchanged, err := planSync(src, dst, srcRoot, dstRoot, srcTree, dstTree, skipped, opts)
+	if err != nil {
+		return stats, err
+	}
+	stats.Unchanged = unchanged
+
+	if opts.DryRun {
+		for _, change := range plan {
+			name := change.Path
+			if change.Dir {
+				name += "/"
+			}
+
+			size := ""
+			if !change.Dir && change.Kind != ChangeDelete {
+				size = " \033[90m" + utils.FormatBytes(change.Size) + "\033[0m"
+			}
+			fmt.Fprintf(out, "  %s %s%s\n", change.Kind.symbol(), name, size)
+
+			switch change.Kind {
+			case ChangeAdd:
+				stats.Added++
+			case ChangeUpdate:
+				stats.Updated++
+			default:
+				stats.Deleted++
+			}
+			if !change.Dir && change.Kind != ChangeDelete {
+				stats.Bytes += change.Size
+			}
+		}
+
+		return stats, unreadableError(unreadable)
+	}
+
+	if err := dst.MkdirAll(dstRoot); err != nil {
+		return stats, fmt.Errorf("%s: %v", dstRoot, err)
+	}
+
+	c := &copier{src: src, dst: dst, opts: Options{Verify: opts.Verify}, out: out}
+
+	for _, change := range plan {
+		srcPath := src.Join(srcRoot, fromSlash(src, change.Path))
+		dstPath := dst.Join(dstRoot, fromSlash(dst, change.Path))
+
+		if change.Kind == ChangeDelete {
+			if err := dst.RemoveAll(dstPath); err != nil {
+				fmt.Fprintf(out, "  \033[31m✗\033[0m %s: %v\n", change.Path, err)
+				stats.Failed++
+				continue
+			}
+			fmt.Fprintf(out, "  %s %s\n", change.Kind.symbol(), change.Path)
+			stats.Deleted++
+			continue
+		}
+
+		// A directory replacing a file or the other way round
+		if change.Kind == ChangeUpdate {
+			if existing, ok := dstTree[change.Path]; ok && existing.IsDir() != change.Dir {
+				if err := dst.RemoveAll(dstPath); err != nil {
+					fmt.Fprintf(out, "  \033[31m✗\033[0m %s: %v\n", change.Path, err)
+					stats.Failed++
+					continue
+				}
+			}
+		}
+
+		if change.Dir {
+			if err := dst.MkdirAll(dstPath); err != nil {
+				fmt.Fprintf(out, "  \033[31m✗\033[0m %s/: %v\n", change.Path, err)
+				stats.Failed++
+				continue
+			}
+			fmt.Fprintf(out, "  %s %s/\n", change.Kind.symbol(), change.Path)
+		} else {
+			before := c.stats
+			c.copyFile(srcPath, dstPath, change.Path, srcTree[change.Path])
+			if c.stats.Files == before.Files {
+				stats.Failed++
+				continue
+			}
+			stats.Bytes += c.stats.Bytes - before.Bytes
+		}
+
+		if change.Kind == ChangeAdd {
+			stats.Added++
+		} else {
+			stats.Updated++
+		}
+	}
+
+	// Writing children bumps directory mtimes; restore them deepest first
+	dirs := make([]string, 0, len(srcTree))
+	for rel, info := range srcTree {
+		if info.IsDir() {
+			dirs = append(dirs, rel)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, rel := range dirs {
+		dstPath := dst.Join(dstRoot, fromSlash(dst, rel))
+		dst.Chmod(dstPath, srcTree[rel].Mode().Perm())
+		dst.Chtimes(dstPath, srcTree[rel].ModTime())
+	}
+
+	if stats.Failed > 0 {
+		return stats, fmt.Errorf("%d change(s) failed", stats.Failed)
+	}
+
+	return stats, unreadableError(unreadable)
+}
+
+func unreadableError(unreadable int) error {
+	if unreadable > 0 {
+		return fmt.Errorf("%d source entries could not be read", unreadable)
+	}
+	return nil
+}
+
+// planSync lists the changes that turn dstTree into srcTree: creations and
+// updates in lexical order, so parents come first, then deletions. Paths in
+// skipped, and everything under them, were left out of srcTree on purpose
+// and are never deleted.
+func planSync(src, dst FS, srcRoot, dstRoot string, srcTree, dstTree map[string]os.FileInfo, skipped map[string]bool, opts SyncOptions) ([]Change, int, error) {
+	var plan []Change
+	unchanged := 0
+
+	for _, rel := range sortedKeys(srcTree) {
+		s := srcTree[rel]
+		d, exists := dstTree[rel]
+		isDir := s.IsDir()
+
+		switch {
+		case !exists:
+			plan = append(plan, Change{Kind: ChangeAdd, Path: rel, Dir: isDir, Size: s.Size()})
+
+		case d.IsDir() != isDir:
+			plan = append(plan, Change{Kind: ChangeUpdate, Path: rel, Dir: isDir, Size: s.Size()})
+
+		case isDir:
+			// Existing directories only get their mode and mtime refreshed
+
+		default:
+			same, err := sameFile(src, dst, src.Join(srcRoot, fromSlash(src, rel)), dst.Join(dstRoot, fromSlash(dst, rel)), s, d, opts.Checksum)
+			if err != nil {
+				return nil, 0, fmt.Errorf("%s: %v", rel, err)
+			}
+			if same {
+				unchanged++
+				continue
+			}
+			plan = append(plan, Change{Kind: ChangeUpdate, Path: rel, Size: s.Size()})
+		}
+	}
+
+	if !opts.Delete {
+		return plan, unchanged, nil
+	}
+
+	// Deleting a directory takes its contents with it, and so does
+	// replacing it with a file
+	var removed []string
+	for _, rel := range sortedKeys(dstTree) {
+		d := dstTree[rel]
+
+		covered := false
+		for _, dir := range removed {
+			if strings.HasPrefix(rel, dir+"/") {
+				covered = true
+				break
+			}
+		}
+		if covered || isSkipped(rel, skipped) {
+			continue
+		}
+
+		if s, ok := srcTree[rel]; ok {
+			if d.IsDir() && !s.IsDir() {
+				removed = append(removed, rel)
+			}
+			continue
+		}
+
+		plan = append(plan, Change{Kind: ChangeDelete, Path: rel, Dir: d.IsDir()})
+		if d.IsDir() {
+			removed = append(removed, rel)
+		}
+	}
+
+	return plan, unchanged, nil
+}
+
+// isSkipped reports whether rel or one of its parents is in skipped.
+func isSkipped(rel string, skipped map[string]bool) bool {
+	for p := rel; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		if skipped[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// sameFile compares by size and whole-second mtime, since SFTP carries no
+// sub-second precision, or by content hash when checksum is set.
+func sameFile(src, dst FS, srcPath, dstPath string, s, d os.FileInfo, checksum bool) (bool, error) {
+	if s.Size() != d.Size() {
+		return false, nil
+	}
+
+	if !checksum {
+		return s.ModTime().Unix() == d.ModTime().Unix(), nil
+	}
+
+	a, err := src.Checksum(srcPath)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := dst.Checksum(dstPath)
+	if err != nil {
+		return false, err
+	}
+
+	return a == b, nil
+}
+
+// walkTree records every entry under root in tree, keyed by slash-separated
+// relative path. Excluded entries and leftover part files are skipped;
+// symlinked directories, broken links and special files are skipped too, but
+// noted in skipped. It returns how many entries below root could not be read.
+func walkTree(fs FS, root, rel string, exclude []string, tree map[string]os.FileInfo, skipped map[string]bool, out io.Writer) (int, error) {
+	entries, err := fs.ReadDir(fs.Join(root, fromSlash(fs, rel)))
+	if err != nil {
+		if rel == "" {
+			return 0, err
+		}
+		fmt.Fprintf(out, "  \033[31m✗\033[0m %s: %v\n", rel, err)
+		return 1, nil
+	}
+
+	unreadable := 0
+
+	for _, entry := range entries {
+		childRel := path.Join(rel, entry.Name())
+
+		if strings.HasSuffix(entry.Name(), PartSuffix) || strings.HasSuffix(entry.Name(), partInfoSuffix) {
+			continue
+		}
+
+		if entry.Mode()&os.ModeSymlink != 0 {
+			resolved, err := fs.Stat(fs.Join(root, fromSlash(fs, childRel)))
+			if err != nil {
+				fmt.Fprintf(out, "  \033[90m⊘ %s: broken symlink skipped\033[0m\n", childRel)
+				skipped[childRel] = true
+				continue
+			}
+			// Following directory links could loop forever
+			if resolved.IsDir() {
+				fmt.Fprintf(out, "  \033[90m⊘ %s: symlinked directory skipped\033[0m\n", childRel)
+				skipped[childRel] = true
+				continue
+			}
+			entry = resolved
+		}
+
+		if !entry.IsDir() && !entry.Mode().IsRegular() {
+			fmt.Fprintf(out, "  \033[90m⊘ %s: special file skipped\033[0m\n", childRel)
+			skipped[childRel] = true
+			continue
+		}
+
+		if Excluded(childRel, entry.IsDir(), exclude) {
+			continue
+		}
+
+		tree[childRel] = entry
+
+		if entry.IsDir() {
+			n, err := walkTree(fs, root, childRel, exclude, tree, skipped, out)
+			if err != nil {
+				return unreadable, err
+			}
+			unreadable += n
+		}
+	}
+
+	return unreadable, nil
+}
+
+// Excluded reports whether rel, a slash-separated path, matches one of the
+// patterns by its base name or its full relative path.
+func Excluded(rel string, dir bool, patterns []string) bool {
+	base := path.Base(rel)
+
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			if !dir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		pattern = strings.TrimPrefix(pattern, "/")
+
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fromSlash(fs FS, rel string) string {
+	if rel == "" {
+		return ""
+	}
+	return fs.Join(strings.Split(rel, "/")...)
+}
+
+func sortedKeys(tree map[string]os.FileInfo) []string {
+	keys := make([]string, 0, len(tree))
+	for k := range tree {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
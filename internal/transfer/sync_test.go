@@ -0,0 +1,207 @@
+package transfer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExcluded(t *testing.T) {
+	tests := []struct {
+		rel      string
+		dir      bool
+		patterns []string
+		want     bool
+	}{
+		{"app.log", false, []string{"*.log"}, true},
+		{"logs/app.log", false, []string{"*.log"}, true},
+		{"logs/app.log", false, []string{"logs/*.log"}, true},
+		{"logs/app.log", false, []string{"/logs/*.log"}, true},
+		{"src/logs/app.log", false, []string{"logs/*.log"}, false},
+		{"node_modules", true, []string{"node_modules/"}, true},
+		{"node_modules", false, []string{"node_modules/"}, false},
+		{"web/node_modules", true, []string{"node_modules/"}, true},
+		{"main.go", false, []string{"*.log", ".git/"}, false},
+		{"main.go", false, nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := Excluded(tt.rel, tt.dir, tt.patterns); got != tt.want {
+			t.Errorf("Excluded(%q, %v, %q) = %v, want %v", tt.rel, tt.dir, tt.patterns, got, tt.want)
+		}
+	}
+}
+
+// fakeInfo is enough of an os.FileInfo for planSync.
+type fakeInfo struct {
+	name  string
+	size  int64
+	mtime time.Time
+	dir   bool
+}
+
+func (f fakeInfo) Name() string       { return f.name }
+func (f fakeInfo) Size() int64        { return f.size }
+func (f fakeInfo) ModTime() time.Time { return f.mtime }
+func (f fakeInfo) IsDir() bool        { return f.dir }
+func (f fakeInfo) Sys() interface{}   { return nil }
+
+func (f fakeInfo) Mode() os.FileMode {
+	if f.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func TestPlanSync(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	file := func(size int64) os.FileInfo { return fakeInfo{size: size, mtime: now} }
+	dir := fakeInfo{dir: true, mtime: now}
+
+	tests := []struct {
+		name      string
+		src, dst  map[string]os.FileInfo
+		skipped   map[string]bool
+		delete    bool
+		want      []Change
+		unchanged int
+	}{
+		{
+			name: "add and update",
+			src:  map[string]os.FileInfo{"a": file(1), "b": file(2), "c": file(3), "d": dir, "d/e": file(4)},
+			dst:  map[string]os.FileInfo{"b": file(2), "c": file(30)},
+			want: []Change{
+				{Kind: ChangeAdd, Path: "a", Size: 1},
+				{Kind: ChangeUpdate, Path: "c", Size: 3},
+				{Kind: ChangeAdd, Path: "d", Dir: true},
+				{Kind: ChangeAdd, Path: "d/e", Size: 4},
+			},
+			unchanged: 1,
+		},
+		{
+			name: "no deletes without Delete",
+			src:  map[string]os.FileInfo{},
+			dst:  map[string]os.FileInfo{"old": file(1)},
+		},
+		{
+			name:   "deleting a directory covers its contents",
+			src:    map[string]os.FileInfo{},
+			dst:    map[string]os.FileInfo{"old": dir, "old/a": file(1), "old/b": file(1), "stale": file(1)},
+			delete: true,
+			want: []Change{
+				{Kind: ChangeDelete, Path: "old", Dir: true},
+				{Kind: ChangeDelete, Path: "stale"},
+			},
+		},
+		{
+			name:   "directory replaced by a file",
+			src:    map[string]os.FileInfo{"x": file(5)},
+			dst:    map[string]os.FileInfo{"x": dir, "x/inner": file(1)},
+			delete: true,
+			want: []Change{
+				{Kind: ChangeUpdate, Path: "x", Size: 5},
+			},
+		},
+		{
+			name:    "skipped entries and their contents are kept",
+			src:     map[string]os.FileInfo{},
+			dst:     map[string]os.FileInfo{"link": dir, "link/a": file(1), "dev": file(0), "gone": file(1)},
+			skipped: map[string]bool{"link": true, "dev": true},
+			delete:  true,
+			want: []Change{
+				{Kind: ChangeDelete, Path: "gone"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skipped := tt.skipped
+			if skipped == nil {
+				skipped = map[string]bool{}
+			}
+
+			plan, unchanged, err := planSync(localFS{}, localFS{}, "/src", "/dst", tt.src, tt.dst, skipped, SyncOptions{Delete: tt.delete})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(plan, tt.want) {
+				t.Errorf("plan = %+v, want %+v", plan, tt.want)
+			}
+			if unchanged != tt.unchanged {
+				t.Errorf("unchanged = %d, want %d", unchanged, tt.unchanged)
+			}
+		})
+	}
+}
+
+// unreadableFS fails to list one directory, like a permission error would.
+type unreadableFS struct {
+	localFS
+	dir string
+}
+
+func (f unreadableFS) ReadDir(name string) ([]os.FileInfo, error) {
+	if name == f.dir {
+		return nil, errors.New("permission denied")
+	}
+	return f.localFS.ReadDir(name)
+}
+
+func writeFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(path), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncTreesKeepsDestinationWhenSourceUnreadable(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(src, "private", "key"))
+	writeFile(t, filepath.Join(dst, "private", "key"))
+	writeFile(t, filepath.Join(dst, "stale"))
+
+	fs := unreadableFS{dir: filepath.Join(src, "private")}
+	_, err := syncTrees(fs, localFS{}, src, dst, SyncOptions{Delete: true})
+	if err == nil {
+		t.Fatal("sync of a partly unreadable source succeeded")
+	}
+
+	for _, name := range []string{"private/key", "stale"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Errorf("%s was deleted: %v", name, err)
+		}
+	}
+}
+
+func TestSyncTreesKeepsSkippedEntries(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	target := t.TempDir()
+	writeFile(t, filepath.Join(src, "kept"))
+	if err := os.Symlink(target, filepath.Join(src, "link")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	writeFile(t, filepath.Join(dst, "link", "data"))
+	writeFile(t, filepath.Join(dst, "stale"))
+
+	stats, err := syncTrees(localFS{}, localFS{}, src, dst, SyncOptions{Delete: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "link", "data")); err != nil {
+		t.Errorf("contents under a skipped symlink were deleted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "stale")); !os.IsNotExist(err) {
+		t.Errorf("stale file survived: %v", err)
+	}
+	if stats.Added != 1 || stats.Deleted != 1 {
+		t.Errorf("stats = %+v, want 1 added and 1 deleted", stats)
+	}
+}
@@ -0,0 +1,401 @@
+// Package transfer copies files over SFTP on top of the leap dialer, so
+// transfers get the same auth, jump hosts and host key checks as sessions.
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/paramientos/leap/internal/config"
+	leapssh "github.com/paramientos/leap/internal/ssh"
+	"github.com/paramientos/leap/internal/utils"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// PartSuffix marks a file that is still being written. A later transfer of
+// the same file resumes from it; it is renamed into place once complete.
+const PartSuffix = ".leap-part"
+
+// partInfoSuffix names the file next to a part that records the size and
+// mtime of the source it came from, so a part of another version of the file
+// is never resumed.
+const partInfoSuffix = ".leap-part-info"
+
+// Options controls a transfer.
+type Options struct {
+	// Recursive copies directories and their contents.
+	Recursive bool
+	// Verify compares SHA-256 checksums of both sides after each file.
+	Verify bool
+	// Out receives progress bars and per-file results; nil discards them.
+	Out io.Writer
+	// Progress, when set, is called as each file advances.
+	Progress func(file string, done, total int64)
+	// Failed, when set, is called for each file that could not be copied.
+	Failed func(file string, err error)
+}
+
+// Stats summarizes a transfer.
+type Stats struct {
+	Files   int
+	Bytes   int64
+	Resumed int
+	Failed  int
+	// Partial counts failed files whose partial copy was kept for resuming.
+	Partial int
+}
+
+// Session is an SFTP connection to one server.
+type Session struct {
+	client *ssh.Client
+	sftp   *sftp.Client
+	owned  bool
+}
+
+// Open dials conn and starts an SFTP session on it.
+func Open(conn config.Connection, opts leapssh.DialOptions) (*Session, error) {
+	client, err := leapssh.Dial(conn, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewSession(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	s.owned = true
+
+	return s, nil
+}
+
+// NewSession starts SFTP on an existing client. Closing the session leaves
+// the client open.
+func NewSession(client *ssh.Client) (*Session, error) {
+	sc, err := sftp.NewClient(client, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		return nil, fmt.Errorf("sftp: %v", err)
+	}
+
+	return &Session{client: client, sftp: sc}, nil
+}
+
+// SFTP exposes the underlying client for browsing.
+func (s *Session) SFTP() *sftp.Client {
+	return s.sftp
+}
+
+func (s *Session) Close() error {
+	err := s.sftp.Close()
+	if s.owned {
+		s.client.Close()
+	}
+	return err
+}
+
+// Upload copies local sources (globs allowed) to dest on the server.
+func (s *Session) Upload(sources []string, dest string, opts Options) (Stats, error) {
+	return s.run(localFS{}, s.remote(), sources, RemotePath(dest), opts)
+}
+
+// Download copies remote sources (globs allowed) to the local dest.
+func (s *Session) Download(sources []string, dest string, opts Options) (Stats, error) {
+	remote := make([]string, len(sources))
+	for i, src := range sources {
+		remote[i] = RemotePath(src)
+	}
+
+	return s.run(s.remote(), localFS{}, remote, dest, opts)
+}
+
+func (s *Session) remote() remoteFS {
+	return remoteFS{ssh: s.client, sftp: s.sftp}
+}
+
+// RemoteFS returns the server side of the session.
+func (s *Session) RemoteFS() FS {
+	return s.remote()
+}
+
+// RemotePath maps "~" and "~/x" to paths SFTP resolves against the home
+// directory, since servers don't expand the tilde.
+func RemotePath(p string) string {
+	switch {
+	case p == "~" || p == "":
+		return "."
+	case strings.HasPrefix(p, "~/"):
+		return strings.TrimPrefix(p, "~/")
+	}
+
+	return p
+}
+
+type copier struct {
+	src, dst FS
+	opts     Options
+	out      io.Writer
+	stats    Stats
+}
+
+// run copies sources into dest the way scp does: into dest when it is a
+// directory (or several sources are given), otherwise onto dest itself.
+func (s *Session) run(src, dst FS, sources []string, dest string, opts Options) (Stats, error) {
+	c := &copier{src: src, dst: dst, opts: opts, out: opts.Out}
+	if c.out == nil {
+		c.out = io.Discard
+	}
+
+	paths, err := expandGlobs(src, sources)
+	if err != nil {
+		return c.stats, err
+	}
+
+	destIsDir := false
+	if info, err := dst.Stat(dest); err == nil {
+		destIsDir = info.IsDir()
+	}
+
+	if !destIsDir && (len(paths) > 1 || strings.HasSuffix(dest, "/")) {
+		if err := dst.MkdirAll(dest); err != nil {
+			return c.stats, fmt.Errorf("%s: %v", dest, err)
+		}
+		destIsDir = true
+	}
+
+	for _, p := range paths {
+		info, err := src.Stat(p)
+		if err != nil {
+			c.fail(p, err)
+			continue
+		}
+
+		target := dest
+		if destIsDir {
+			target = dst.Join(dest, src.Base(p))
+		}
+
+		if info.IsDir() {
+			if !opts.Recursive {
+				c.fail(p, fmt.Errorf("is a directory (use --recursive)"))
+				continue
+			}
+			c.copyDir(p, target, src.Base(p), info)
+			continue
+		}
+
+		c.copyFile(p, target, src.Base(p), info)
+	}
+
+	if c.stats.Failed > 0 {
+		return c.stats, fmt.Errorf("%d of %d file(s) failed", c.stats.Failed, c.stats.Failed+c.stats.Files)
+	}
+
+	return c.stats, nil
+}
+
+func (c *copier) fail(name string, err error) {
+	c.stats.Failed++
+	fmt.Fprintf(c.out, "  \033[31m✗\033[0m %s: %v\n", name, err)
+	if c.opts.Failed != nil {
+		c.opts.Failed(name, err)
+	}
+}
+
+func (c *copier) copyDir(src, dst, display string, info os.FileInfo) {
+	if err := c.dst.MkdirAll(dst); err != nil {
+		c.fail(display, err)
+		return
+	}
+
+	entries, err := c.src.ReadDir(src)
+	if err != nil {
+		c.fail(display, err)
+		return
+	}
+
+	for _, entry := range entries {
+		childSrc := c.src.Join(src, entry.Name())
+		childDst := c.dst.Join(dst, entry.Name())
+		childDisplay := display + "/" + entry.Name()
+
+		if entry.Mode()&os.ModeSymlink != 0 {
+			resolved, err := c.src.Stat(childSrc)
+			if err != nil {
+				c.fail(childDisplay, err)
+				continue
+			}
+			// Following directory links could loop forever
+			if resolved.IsDir() {
+				fmt.Fprintf(c.out, "  \033[90m⊘ %s: symlinked directory skipped\033[0m\n", childDisplay)
+				continue
+			}
+			entry = resolved
+		}
+
+		switch {
+		case entry.IsDir():
+			c.copyDir(childSrc, childDst, childDisplay, entry)
+		case entry.Mode().IsRegular():
+			c.copyFile(childSrc, childDst, childDisplay, entry)
+		default:
+			fmt.Fprintf(c.out, "  \033[90m⊘ %s: special file skipped\033[0m\n", childDisplay)
+		}
+	}
+
+	// After the children, or writing them would bump the mtime again
+	c.dst.Chmod(dst, info.Mode().Perm())
+	c.dst.Chtimes(dst, info.ModTime())
+}
+
+// copyFile writes src to dst+PartSuffix, resuming a previous part of the
+// same source version, verifies it, applies mode and mtime and renames it
+// into place.
+func (c *copier) copyFile(src, dst, display string, info os.FileInfo) {
+	part := dst + PartSuffix
+	partInfo := dst + partInfoSuffix
+	stamp := fmt.Sprintf("%d %d", info.Size(), info.ModTime().Unix())
+
+	var offset int64
+	if pinfo, err := c.dst.Stat(part); err == nil && pinfo.Mode().IsRegular() && pinfo.Size() <= info.Size() && c.readStamp(partInfo) == stamp {
+		offset = pinfo.Size()
+	}
+	if offset == 0 {
+		c.writeStamp(partInfo, stamp)
+	}
+
+	bar := newProgressBar(c.out, display, info.Size(), offset, c.opts.Progress)
+	written, err := c.stream(src, part, offset, bar)
+	if err != nil {
+		bar.finish("\033[31m✗\033[0m", fmt.Sprintf("%v (partial file kept for resume)", err))
+		c.stats.Failed++
+		c.stats.Partial++
+		return
+	}
+
+	var notes []string
+	if offset > 0 {
+		notes = append(notes, "resumed at "+utils.FormatBytes(offset))
+	}
+
+	if c.opts.Verify {
+		ok, err := c.sameChecksum(src, part)
+
+		// A stale part from a different version of the file: start over once
+		if err == nil && !ok && offset > 0 {
+			bar = newProgressBar(c.out, display, info.Size(), 0, c.opts.Progress)
+			offset = 0
+			notes = []string{"restarted"}
+			if written, err = c.stream(src, part, 0, bar); err == nil {
+				ok, err = c.sameChecksum(src, part)
+			}
+		}
+
+		if err != nil || !ok {
+			if err == nil {
+				err = fmt.Errorf("checksum mismatch")
+				c.dst.Remove(part)
+				c.dst.Remove(partInfo)
+			}
+			bar.finish("\033[31m✗\033[0m", err.Error())
+			c.stats.Failed++
+			return
+		}
+		notes = append(notes, "sha256 ok")
+	}
+
+	c.dst.Chmod(part, info.Mode().Perm())
+	c.dst.Chtimes(part, info.ModTime())
+
+	if err := c.dst.Rename(part, dst); err != nil {
+		bar.finish("\033[31m✗\033[0m", err.Error())
+		c.stats.Failed++
+		return
+	}
+	c.dst.Remove(partInfo)
+
+	if offset > 0 {
+		c.stats.Resumed++
+	}
+	c.stats.Files++
+	c.stats.Bytes += written
+
+	bar.finish("\033[32m✓\033[0m", "\033[90m"+strings.Join(notes, ", ")+"\033[0m")
+}
+
+// readStamp returns the source stamp recorded for a part, or "" if none is.
+func (c *copier) readStamp(path string) string {
+	f, err := c.dst.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, 64))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// writeStamp records which source version a new part belongs to. Failing
+// only costs the ability to resume it.
+func (c *copier) writeStamp(path, stamp string) {
+	f, err := c.dst.OpenWriter(path, 0)
+	if err != nil {
+		return
+	}
+	f.Write([]byte(stamp + "\n"))
+	f.Close()
+}
+
+func (c *copier) stream(src, part string, offset int64, bar *progressBar) (int64, error) {
+	in, err := c.src.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	if offset > 0 {
+		if _, err := in.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+
+	out, err := c.dst.OpenWriter(part, offset)
+	if err != nil {
+		return 0, err
+	}
+
+	// Keep the concrete reader/writer visible to io.Copy so SFTP can
+	// pipeline requests: downloads go through the source's WriteTo, uploads
+	// through the destination's ReadFrom, which needs a sized reader.
+	var n int64
+	if _, remote := c.src.(remoteFS); remote {
+		n, err = io.Copy(io.MultiWriter(out, bar), in)
+	} else {
+		n, err = io.Copy(out, &io.LimitedReader{R: io.TeeReader(in, bar), N: bar.total - offset})
+	}
+
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	return n, err
+}
+
+func (c *copier) sameChecksum(src, part string) (bool, error) {
+	a, err := c.src.Checksum(src)
+	if err != nil {
+		return false, fmt.Errorf("checksum: %v", err)
+	}
+
+	b, err := c.dst.Checksum(part)
+	if err != nil {
+		return false, fmt.Errorf("checksum: %v", err)
+	}
+
+	return a == b, nil
+}
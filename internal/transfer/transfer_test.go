@@ -0,0 +1,76 @@
+package transfer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyFileResume(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	mtime := time.Unix(1700000000, 0)
+	stamp := fmt.Sprintf("%d %d", len(content), mtime.Unix())
+
+	tests := []struct {
+		name    string
+		part    []byte
+		stamp   string
+		resumed int
+	}{
+		{"fresh", nil, "", 0},
+		{"same source", content[:20000], stamp, 1},
+		{"no stamp", []byte("stale prefix from an older version"), "", 0},
+		{"other version", []byte("stale prefix from an older version"), fmt.Sprintf("%d %d", len(content), mtime.Unix()-60), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir, dstDir := t.TempDir(), t.TempDir()
+			src := filepath.Join(srcDir, "data.bin")
+			dst := filepath.Join(dstDir, "data.bin")
+
+			if err := os.WriteFile(src, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(src, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+			if tt.part != nil {
+				if err := os.WriteFile(dst+PartSuffix, tt.part, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.stamp != "" {
+				if err := os.WriteFile(dst+partInfoSuffix, []byte(tt.stamp+"\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Without verification nothing else would catch a stale prefix
+			stats, err := (&Session{}).run(localFS{}, localFS{}, []string{src}, dst, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("copy differs from the source (%d bytes, want %d)", len(got), len(content))
+			}
+			if stats.Resumed != tt.resumed {
+				t.Errorf("resumed %d file(s), want %d", stats.Resumed, tt.resumed)
+			}
+
+			for _, leftover := range []string{dst + PartSuffix, dst + partInfoSuffix} {
+				if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+					t.Errorf("%s left behind", filepath.Base(leftover))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,765 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/paramientos/leap/internal/config"
+	"github.com/paramientos/leap/internal/transfer"
+	"github.com/paramientos/leap/internal/utils"
+)
+
+var (
+	paneStyle = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(borderColor)
+
+	activePaneStyle = paneStyle.
+			BorderForeground(primaryGreen)
+
+	paneTitleStyle = lipgloss.NewStyle().
+			Foreground(accentCyan).
+			Bold(true)
+
+	dirStyle = lipgloss.NewStyle().
+			Foreground(highlightColor).
+			Bold(true)
+
+	cursorStyle = lipgloss.NewStyle().
+			Foreground(darkBg).
+			Background(primaryGreen)
+
+	selectedStyle = lipgloss.NewStyle().
+			Foreground(laravelOrange).
+			Bold(true)
+
+	mutedStyle = lipgloss.NewStyle().
+			Foreground(mutedText)
+
+	errorStyle = lipgloss.NewStyle().
+			Foreground(laravelRed).
+			Bold(true)
+)
+
+const (
+	paneLocal = iota
+	paneRemote
+)
+
+type fileEntry struct {
+	name   string
+	info   os.FileInfo
+	parent bool
+}
+
+func (e fileEntry) isDir() bool {
+	return e.parent || e.info.IsDir() || e.info.Mode()&os.ModeSymlink != 0
+}
+
+// filePane is one side of the file manager.
+type filePane struct {
+	fs       transfer.FS
+	title    string
+	dir      string
+	entries  []fileEntry
+	cursor   int
+	offset   int
+	selected map[string]bool
+}
+
+func (p *filePane) current() (fileEntry, bool) {
+	if p.cursor < 0 || p.cursor >= len(p.entries) {
+		return fileEntry{}, false
+	}
+	return p.entries[p.cursor], true
+}
+
+// targets returns the selected names, or the entry under the cursor.
+func (p *filePane) targets() []string {
+	var names []string
+	for _, e := range p.entries {
+		if p.selected[e.name] {
+			names = append(names, e.name)
+		}
+	}
+
+	if len(names) == 0 {
+		if e, ok := p.current(); ok && !e.parent {
+			names = append(names, e.name)
+		}
+	}
+
+	return names
+}
+
+func (p *filePane) move(delta, rows int) {
+	p.cursor += delta
+	if p.cursor >= len(p.entries) {
+		p.cursor = len(p.entries) - 1
+	}
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if rows > 0 && p.cursor >= p.offset+rows {
+		p.offset = p.cursor - rows + 1
+	}
+}
+
+type inputMode int
+
+const (
+	modeNormal inputMode = iota
+	modeRename
+	modeMkdir
+	modeChmod
+	modeDelete
+)
+
+type transferJob struct {
+	upload  bool
+	sources []string
+	dest    string
+}
+
+type dirLoadedMsg struct {
+	pane    int
+	dir     string
+	entries []fileEntry
+	keep    string
+	err     error
+}
+
+type transferProgressMsg struct {
+	file        string
+	done, total int64
+}
+
+type transferDoneMsg struct {
+	job      transferJob
+	stats    transfer.Stats
+	failures []string
+	err      error
+}
+
+// fsOpDoneMsg reports a delete, rename, mkdir or chmod run in the
+// background. keep names the entry to leave the cursor on afterwards.
+type fsOpDoneMsg struct {
+	pane   int
+	status string
+	keep   string
+	clear  bool
+	err    error
+}
+
+// maxFailures caps the per-file errors shown under the status line.
+const maxFailures = 5
+
+type fileManagerModel struct {
+	conn     config.Connection
+	session  *transfer.Session
+	panes    [2]*filePane
+	active   int
+	mode     inputMode
+	input    textinput.Model
+	bar      progress.Model
+	queue    []transferJob
+	running  *transferJob
+	current  transferProgressMsg
+	events   chan tea.Msg
+	status   string
+	failed   bool
+	failures []string
+	quitting bool
+	confirm  bool
+	width    int
+	height   int
+}
+
+func newFileManagerModel(conn config.Connection, session *transfer.Session) fileManagerModel {
+	input := textinput.New()
+	input.CharLimit = 255
+
+	return fileManagerModel{
+		conn:    conn,
+		session: session,
+		panes: [2]*filePane{
+			{fs: transfer.LocalFS(), title: "💻 Local", selected: map[string]bool{}},
+			{fs: session.RemoteFS(), title: "🌐 " + conn.Name, selected: map[string]bool{}},
+		},
+		input:  input,
+		bar:    progress.New(progress.WithDefaultGradient()),
+		events: make(chan tea.Msg, 64),
+		width:  100,
+		height: 30,
+	}
+}
+
+func (m fileManagerModel) Init() tea.Cmd {
+	return tea.Batch(m.openHome(paneLocal), m.openHome(paneRemote))
+}
+
+func (m fileManagerModel) openHome(pane int) tea.Cmd {
+	fs := m.panes[pane].fs
+	return func() tea.Msg {
+		home, err := fs.Home()
+		if err != nil {
+			return dirLoadedMsg{pane: pane, err: err}
+		}
+		return readDir(pane, fs, home, "")()
+	}
+}
+
+// readDir lists dir, keeping the cursor on keep when it is still there.
+func readDir(pane int, fs transfer.FS, dir, keep string) tea.Cmd {
+	return func() tea.Msg {
+		infos, err := fs.ReadDir(dir)
+		if err != nil {
+			return dirLoadedMsg{pane: pane, dir: dir, err: err}
+		}
+
+		sort.Slice(infos, func(i, j int) bool {
+			if infos[i].IsDir() != infos[j].IsDir() {
+				return infos[i].IsDir()
+			}
+			return strings.ToLower(infos[i].Name()) < strings.ToLower(infos[j].Name())
+		})
+
+		var entries []fileEntry
+		if fs.Dir(dir) != dir {
+			entries = append(entries, fileEntry{name: "..", parent: true})
+		}
+		for _, info := range infos {
+			entries = append(entries, fileEntry{name: info.Name(), info: info})
+		}
+
+		return dirLoadedMsg{pane: pane, dir: dir, entries: entries, keep: keep}
+	}
+}
+
+func waitForEvent(ch chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-ch
+	}
+}
+
+func (m fileManagerModel) rows() int {
+	rows := m.height - 10
+	if m.failed {
+		rows -= min(len(m.failures), maxFailures+1)
+	}
+	if rows < 3 {
+		rows = 3
+	}
+	return rows
+}
+
+func (m fileManagerModel) reload(pane int) tea.Cmd {
+	p := m.panes[pane]
+	keep := ""
+	if e, ok := p.current(); ok {
+		keep = e.name
+	}
+	return readDir(pane, p.fs, p.dir, keep)
+}
+
+func (m fileManagerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.bar.Width = msg.Width/2 - 10
+		return m, nil
+
+	case dirLoadedMsg:
+		p := m.panes[msg.pane]
+		if msg.err != nil {
+			m.setError(msg.err)
+			return m, nil
+		}
+
+		if msg.dir != p.dir {
+			p.selected = map[string]bool{}
+		}
+		p.dir = msg.dir
+		p.entries = msg.entries
+		p.cursor, p.offset = 0, 0
+		for i, e := range p.entries {
+			if e.name == msg.keep {
+				p.move(i, m.rows())
+				break
+			}
+		}
+		return m, nil
+
+	case transferProgressMsg:
+		m.current = msg
+		return m, waitForEvent(m.events)
+
+	case transferDoneMsg:
+		m.running = nil
+		m.current = transferProgressMsg{}
+		if msg.err != nil {
+			m.setError(msg.err)
+			m.failures = msg.failures
+		} else {
+			m.setStatus(fmt.Sprintf("✓ Copied %d file(s), %s", msg.stats.Files, utils.FormatBytes(msg.stats.Bytes)))
+		}
+		return m, tea.Batch(m.reload(paneLocal), m.reload(paneRemote), m.startNext())
+
+	case fsOpDoneMsg:
+		p := m.panes[msg.pane]
+		if msg.err != nil {
+			m.setError(msg.err)
+		} else {
+			m.setStatus(msg.status)
+			if msg.clear {
+				p.selected = map[string]bool{}
+			}
+		}
+		if msg.keep != "" {
+			return m, readDir(msg.pane, p.fs, p.dir, msg.keep)
+		}
+		return m, m.reload(msg.pane)
+
+	case tea.KeyMsg:
+		if m.mode != modeNormal {
+			return m.updateInput(msg)
+		}
+		return m.updateNormal(msg)
+	}
+
+	return m, nil
+}
+
+func (m *fileManagerModel) setStatus(s string) {
+	m.status, m.failed, m.failures = s, false, nil
+}
+
+func (m *fileManagerModel) setError(err error) {
+	m.status, m.failed, m.failures = "✗ "+err.Error(), true, nil
+}
+
+// fsOp runs op against pane's filesystem in the background so a slow
+// server doesn't freeze the UI; the result comes back as an fsOpDoneMsg.
+func fsOp(pane int, status, keep string, clear bool, op func() error) tea.Cmd {
+	return func() tea.Msg {
+		if err := op(); err != nil {
+			return fsOpDoneMsg{pane: pane, err: err}
+		}
+		return fsOpDoneMsg{pane: pane, status: status, keep: keep, clear: clear}
+	}
+}
+
+func (m fileManagerModel) updateNormal(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	p := m.panes[m.active]
+	rows := m.rows()
+
+	if msg.String() != "q" && msg.String() != "ctrl+c" {
+		m.confirm = false
+	}
+
+	switch msg.String() {
+	case "ctrl+c", "q", "esc":
+		if m.running != nil && !m.confirm {
+			m.confirm = true
+			m.setStatus("A transfer is running. Press q again to quit; partial files resume next time.")
+			return m, nil
+		}
+		m.quitting = true
+		return m, tea.Quit
+
+	case "tab":
+		m.active = 1 - m.active
+
+	case "up", "k":
+		p.move(-1, rows)
+	case "down", "j":
+		p.move(1, rows)
+	case "pgup":
+		p.move(-rows, rows)
+	case "pgdown":
+		p.move(rows, rows)
+	case "home", "g":
+		p.move(-len(p.entries), rows)
+	case "end", "G":
+		p.move(len(p.entries), rows)
+
+	case "enter", "right", "l":
+		e, ok := p.current()
+		if !ok || !e.isDir() {
+			return m, nil
+		}
+		if e.parent {
+			return m, readDir(m.active, p.fs, p.fs.Dir(p.dir), p.fs.Base(p.dir))
+		}
+		return m, readDir(m.active, p.fs, p.fs.Join(p.dir, e.name), "")
+
+	case "backspace", "left", "h":
+		if p.fs.Dir(p.dir) == p.dir {
+			return m, nil
+		}
+		return m, readDir(m.active, p.fs, p.fs.Dir(p.dir), p.fs.Base(p.dir))
+
+	case " ":
+		if e, ok := p.current(); ok && !e.parent {
+			p.selected[e.name] = !p.selected[e.name]
+			if !p.selected[e.name] {
+				delete(p.selected, e.name)
+			}
+		}
+		p.move(1, rows)
+
+	case "a":
+		if len(p.selected) > 0 {
+			p.selected = map[string]bool{}
+		} else {
+			for _, e := range p.entries {
+				if !e.parent {
+					p.selected[e.name] = true
+				}
+			}
+		}
+
+	case "R", "ctrl+r":
+		return m, tea.Batch(m.reload(paneLocal), m.reload(paneRemote))
+
+	case "c", "f5":
+		names := p.targets()
+		if len(names) == 0 {
+			return m, nil
+		}
+
+		job := transferJob{upload: m.active == paneLocal, dest: m.panes[1-m.active].dir}
+		for _, name := range names {
+			job.sources = append(job.sources, p.fs.Join(p.dir, name))
+		}
+		p.selected = map[string]bool{}
+
+		m.queue = append(m.queue, job)
+		m.setStatus(fmt.Sprintf("Queued %d item(s) → %s", len(names), job.dest))
+		return m, m.startNext()
+
+	case "r", "f2":
+		if e, ok := p.current(); ok && !e.parent {
+			return m, m.prompt(modeRename, "Rename to: ", e.name)
+		}
+
+	case "m", "f7":
+		return m, m.prompt(modeMkdir, "New directory: ", "")
+
+	case "p":
+		if e, ok := p.current(); ok && !e.parent {
+			return m, m.prompt(modeChmod, "Mode (octal): ", fmt.Sprintf("%o", e.info.Mode().Perm()))
+		}
+
+	case "d", "delete", "f8":
+		if names := p.targets(); len(names) > 0 {
+			m.mode = modeDelete
+			m.setStatus(fmt.Sprintf("Delete %d item(s) from %s? (y/n)", len(names), p.title))
+		}
+	}
+
+	return m, nil
+}
+
+func (m *fileManagerModel) prompt(mode inputMode, label, value string) tea.Cmd {
+	m.mode = mode
+	m.input.Prompt = label
+	m.input.SetValue(value)
+	m.input.CursorEnd()
+	return m.input.Focus()
+}
+
+func (m fileManagerModel) updateInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	p := m.panes[m.active]
+
+	if m.mode == modeDelete {
+		m.mode = modeNormal
+		if msg.String() != "y" && msg.String() != "Y" {
+			m.setStatus("Delete cancelled")
+			return m, nil
+		}
+
+		fs, dir, names := p.fs, p.dir, p.targets()
+		m.setStatus(fmt.Sprintf("Deleting %d item(s)…", len(names)))
+		return m, fsOp(m.active, fmt.Sprintf("✓ Deleted %d item(s)", len(names)), "", true, func() error {
+			for _, name := range names {
+				if err := fs.RemoveAll(fs.Join(dir, name)); err != nil {
+					return fmt.Errorf("%s: %v", name, err)
+				}
+			}
+			return nil
+		})
+	}
+
+	switch msg.String() {
+	case "esc", "ctrl+c":
+		m.mode = modeNormal
+		m.input.Blur()
+		return m, nil
+
+	case "enter":
+		mode := m.mode
+		value := strings.TrimSpace(m.input.Value())
+		m.mode = modeNormal
+		m.input.Blur()
+		if value == "" {
+			return m, nil
+		}
+
+		e, _ := p.current()
+		fs, dir := p.fs, p.dir
+
+		switch mode {
+		case modeRename:
+			if strings.ContainsAny(value, `/\`) {
+				m.setError(fmt.Errorf("name must not contain a path separator"))
+				return m, nil
+			}
+			return m, fsOp(m.active, fmt.Sprintf("✓ Renamed %s → %s", e.name, value), value, false, func() error {
+				return fs.Rename(fs.Join(dir, e.name), fs.Join(dir, value))
+			})
+
+		case modeMkdir:
+			return m, fsOp(m.active, "✓ Created "+value, value, false, func() error {
+				return fs.Mkdir(fs.Join(dir, value))
+			})
+
+		case modeChmod:
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil || mode > 0777 {
+				m.setError(fmt.Errorf("mode must be octal, e.g. 644 or 755"))
+				return m, nil
+			}
+			names := p.targets()
+			return m, fsOp(m.active, fmt.Sprintf("✓ Mode set to %o", mode), "", false, func() error {
+				for _, name := range names {
+					if err := fs.Chmod(fs.Join(dir, name), os.FileMode(mode)); err != nil {
+						return fmt.Errorf("%s: %v", name, err)
+					}
+				}
+				return nil
+			})
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// startNext runs the next queued job in the background. Progress and the
+// result come back as messages through m.events.
+func (m *fileManagerModel) startNext() tea.Cmd {
+	if m.running != nil || len(m.queue) == 0 {
+		return nil
+	}
+
+	job := m.queue[0]
+	m.queue = m.queue[1:]
+	m.running = &job
+
+	session, events := m.session, m.events
+	go func() {
+		var failures []string
+		opts := transfer.Options{
+			Recursive: true,
+			Verify:    true,
+			Progress: func(file string, done, total int64) {
+				events <- transferProgressMsg{file: file, done: done, total: total}
+			},
+			Failed: func(file string, err error) {
+				failures = append(failures, fmt.Sprintf("%s: %v", file, err))
+			},
+		}
+
+		var stats transfer.Stats
+		var err error
+		if job.upload {
+			stats, err = session.Upload(job.sources, job.dest, opts)
+		} else {
+			stats, err = session.Download(job.sources, job.dest, opts)
+		}
+
+		events <- transferDoneMsg{job: job, stats: stats, failures: failures, err: err}
+	}()
+
+	return waitForEvent(events)
+}
+
+func (m fileManagerModel) View() string {
+	if m.quitting {
+		return ""
+	}
+
+	paneWidth := (m.width - 6) / 2
+	if paneWidth < 30 {
+		paneWidth = 30
+	}
+
+	left := m.renderPane(paneLocal, paneWidth)
+	right := m.renderPane(paneRemote, paneWidth)
+
+	var footer []string
+
+	if m.running != nil {
+		direction := "⬆ upload"
+		if !m.running.upload {
+			direction = "⬇ download"
+		}
+
+		percent := 0.0
+		if m.current.total > 0 {
+			percent = float64(m.current.done) / float64(m.current.total)
+		}
+
+		line := fmt.Sprintf("%s %s  %s  %s/%s", direction, m.current.file, m.bar.ViewAs(percent),
+			utils.FormatBytes(m.current.done), utils.FormatBytes(m.current.total))
+		if len(m.queue) > 0 {
+			line += mutedStyle.Render(fmt.Sprintf("  (+%d queued)", len(m.queue)))
+		}
+		footer = append(footer, line)
+	}
+
+	switch {
+	case m.mode != modeNormal && m.mode != modeDelete:
+		footer = append(footer, m.input.View())
+	case m.failed:
+		footer = append(footer, errorStyle.Render(m.status))
+		for i, f := range m.failures {
+			if i == maxFailures {
+				footer = append(footer, mutedStyle.Render(fmt.Sprintf("  … %d more", len(m.failures)-maxFailures)))
+				break
+			}
+			footer = append(footer, errorStyle.Render("  "+f))
+		}
+	case m.status != "":
+		footer = append(footer, valueStyle.Render(m.status))
+	}
+
+	footer = append(footer, helpStyle.Render("tab switch • enter open • ⌫ up • space select • a all • c copy • r rename • m mkdir • p chmod • d delete • R refresh • q quit"))
+
+	header := headerStyle.Render("📂 LEAP FILE MANAGER")
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		header,
+		lipgloss.JoinHorizontal(lipgloss.Top, left, " ", right),
+		strings.Join(footer, "\n"),
+	)
+}
+
+func (m fileManagerModel) renderPane(index, width int) string {
+	p := m.panes[index]
+	rows := m.rows()
+	inner := width - 2
+
+	title := paneTitleStyle.Render(p.title) + " " + mutedStyle.Render(truncateLeft(p.dir, inner-lipgloss.Width(p.title)-2))
+	lines := []string{title, mutedStyle.Render(strings.Repeat("─", inner))}
+
+	nameWidth := inner - 36
+	if nameWidth < 10 {
+		nameWidth = 10
+	}
+
+	for i := p.offset; i < len(p.entries) && i < p.offset+rows; i++ {
+		e := p.entries[i]
+
+		marker := "  "
+		if p.selected[e.name] {
+			marker = "● "
+		}
+
+		name := e.name
+		size, mode, modified := "", "", ""
+		if !e.parent {
+			if e.isDir() {
+				name += "/"
+			} else {
+				size = utils.FormatBytes(e.info.Size())
+			}
+			if e.info.Mode()&os.ModeSymlink != 0 {
+				name = e.name + "@"
+			}
+			mode = fileModeString(e.info.Mode())
+			modified = e.info.ModTime().Format("Jan 02 15:04")
+		}
+
+		row := fmt.Sprintf("%s%-*s %9s %s %s", marker, nameWidth, truncateRight(name, nameWidth), size, mode, modified)
+
+		switch {
+		case i == p.cursor && index == m.active:
+			row = cursorStyle.Render(padRight(row, inner))
+		case p.selected[e.name]:
+			row = selectedStyle.Render(row)
+		case e.isDir():
+			row = dirStyle.Render(row)
+		}
+
+		lines = append(lines, row)
+	}
+
+	for len(lines) < rows+2 {
+		lines = append(lines, "")
+	}
+
+	style := paneStyle
+	if index == m.active {
+		style = activePaneStyle
+	}
+
+	return style.Width(inner).Render(strings.Join(lines, "\n"))
+}
+
+// fileModeString renders mode like ls -l does.
+func fileModeString(mode os.FileMode) string {
+	kind := "-"
+	switch {
+	case mode&os.ModeSymlink != 0:
+		kind = "l"
+	case mode.IsDir():
+		kind = "d"
+	}
+	return kind + mode.Perm().String()[1:]
+}
+
+func truncateRight(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+func truncateLeft(s string, width int) string {
+	runes := []rune(s)
+	if width < 2 || len(runes) <= width {
+		return s
+	}
+	return "…" + string(runes[len(runes)-width+1:])
+}
+
+func padRight(s string, width int) string {
+	if w := lipgloss.Width(s); w < width {
+		return s + strings.Repeat(" ", width-w)
+	}
+	return s
+}
+
+// RunFileManager opens the dual-pane file manager on an SFTP session.
+func RunFileManager(conn config.Connection, session *transfer.Session) error {
+	p := tea.NewProgram(newFileManagerModel(conn, session), tea.WithAltScreen())
+	_, err := p.Run()
+	return err
+}
@@ -90,9 +90,18 @@ func (i item) FilterValue() string {
 	return i.title + " " + i.desc + " " + strings.Join(i.conn.Tags, " ")
 }
 
+// Action is what the user picked for the chosen connection.
+type Action int
+
+const (
+	ActionConnect Action = iota
+	ActionFiles
+)
+
 type Model struct {
 	list     list.Model
 	choice   *config.Connection
+	action   Action
 	quitting bool
 	width    int
 	height   int
@@ -118,6 +127,17 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 
 			return m, tea.Quit
+
+		case "s":
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+
+			if i, ok := m.list.SelectedItem().(item); ok {
+				m.choice = &i.conn
+				m.action = ActionFiles
+				return m, tea.Quit
+			}
 		}
 
 	case tea.WindowSizeMsg:
@@ -135,10 +155,14 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m Model) View() string {
 	if m.choice != nil {
+		format := "🚀 Connecting to %s..."
+		if m.action == ActionFiles {
+			format = "📂 Opening files on %s..."
+		}
 		connectMsg := lipgloss.NewStyle().
 			Foreground(lightText).
 			Bold(true).
-			Render(fmt.Sprintf("🚀 Connecting to %s...", connectionStyle.Render(m.choice.Name)))
+			Render(fmt.Sprintf(format, connectionStyle.Render(m.choice.Name)))
 		return appStyle.Render(connectMsg)
 	}
 
@@ -197,7 +221,7 @@ func (m Model) View() string {
 
 		info = append(info, "")
 		info = append(info, "")
-		info = append(info, helpStyle.Render("Press Enter to connect • / to filter • q to quit"))
+		info = append(info, helpStyle.Render("Press Enter to connect • s for files • / to filter • q to quit"))
 
 		dWidth := m.width - m.width/3 - 10
 
@@ -239,6 +263,9 @@ func getAuthType(conn config.Connection) string {
 	if conn.Password != "" {
 		return "Password (Saved)"
 	}
+	if conn.PasswordCommand != "" {
+		return "Password Command"
+	}
 	return "System Agent / Prompt"
 }
 
@@ -282,20 +309,20 @@ func InitialModel(cfg *config.Config) Model {
 	return Model{list: l}
 }
 
-func Run(cfg *config.Config) (*config.Connection, error) {
+func Run(cfg *config.Config) (*config.Connection, Action, error) {
 	m := InitialModel(cfg)
 	p := tea.NewProgram(m, tea.WithAltScreen())
 	finalModel, err := p.Run()
 
 	if err != nil {
-		return nil, err
+		return nil, ActionConnect, err
 	}
 
 	res, ok := finalModel.(Model)
 
 	if !ok {
-		return nil, fmt.Errorf("unexpected model type")
+		return nil, ActionConnect, fmt.Errorf("unexpected model type")
 	}
 
-	return res.choice, nil
+	return res.choice, res.action, nil
 }
@@ -2,8 +2,6 @@ package tui
 
 import (
 	"fmt"
-	"net"
-	"os"
 	"strings"
 	"time"
 
@@ -11,8 +9,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/paramientos/leap/internal/config"
-	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/agent"
+	leapssh "github.com/paramientos/leap/internal/ssh"
 )
 
 type stats struct {
@@ -31,6 +28,7 @@ type serverStats struct {
 type tickMsg time.Time
 
 type monitorModel struct {
+	config      *config.Config
 	connections []config.Connection
 	stats       map[int]stats
 	table       table.Model
@@ -64,37 +62,11 @@ func (m monitorModel) fetchStats(index int, conn config.Connection) tea.Cmd {
 	return func() tea.Msg {
 		s := stats{}
 
-		sshConfig := &ssh.ClientConfig{
-			User:            conn.User,
-			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-			Timeout:         5 * time.Second,
-		}
-
-		// Try ID File
-		if conn.IdentityFile != "" {
-			key, err := os.ReadFile(conn.IdentityFile)
-			if err == nil {
-				signer, err := ssh.ParsePrivateKey(key)
-				if err == nil {
-					sshConfig.Auth = append(sshConfig.Auth, ssh.PublicKeys(signer))
-				}
-			}
-		}
-
-		if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
-			netConn, err := net.Dial("unix", socket)
-			if err == nil {
-				sshConfig.Auth = append(sshConfig.Auth, ssh.PublicKeysCallback(agent.NewClient(netConn).Signers))
-			}
-		}
-
-		if conn.Password != "" {
-			sshConfig.Auth = append(sshConfig.Auth, ssh.Password(conn.Password))
-		}
-
-		addr := fmt.Sprintf("%s:%d", conn.Host, conn.Port)
-
-		client, err := ssh.Dial("tcp", addr, sshConfig)
+		// The TUI owns the terminal, so unknown hosts cannot be confirmed here
+		client, err := leapssh.Dial(conn, leapssh.DialOptions{
+			Config:  m.config,
+			Timeout: 5 * time.Second,
+		})
 		if err != nil {
 			s.Error = err
 			return serverStats{index, s}
@@ -225,7 +197,7 @@ func (m monitorModel) View() string {
 	)
 }
 
-func RunMonitor(conns []config.Connection) error {
+func RunMonitor(cfg *config.Config, conns []config.Connection) error {
 	columns := []table.Column{
 		{Title: "SERVER", Width: 18},
 		{Title: "LOAD", Width: 10},
@@ -255,6 +227,7 @@ func RunMonitor(conns []config.Connection) error {
 	t.SetStyles(s)
 
 	m := monitorModel{
+		config:      cfg,
 		connections: conns,
 		stats:       make(map[int]stats),
 		table:       t,
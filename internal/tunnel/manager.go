@@ -0,0 +1,343 @@
+package tunnel
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/paramientos/leap/internal/agent"
+	"github.com/paramientos/leap/internal/config"
+	leapssh "github.com/paramientos/leap/internal/ssh"
+)
+
+// upTimeout leaves room for a slow dial through several jump hosts.
+const upTimeout = time.Minute
+
+type request struct {
+	Op      string   `json:"op"`
+	Profile string   `json:"profile,omitempty"`
+	Names   []string `json:"names,omitempty"`
+	// Conn and Hops are what the manager needs to dial, since it cannot
+	// open the vault itself.
+	Conn    *config.Connection           `json:"conn,omitempty"`
+	Hops    map[string]config.Connection `json:"hops,omitempty"`
+	Tunnels []config.Tunnel              `json:"tunnels,omitempty"`
+}
+
+type response struct {
+	OK       bool     `json:"ok"`
+	Error    string   `json:"error,omitempty"`
+	Sessions []Status `json:"sessions,omitempty"`
+	Closed   int      `json:"closed,omitempty"`
+	PID      int      `json:"pid,omitempty"`
+}
+
+// SocketPath returns the control socket of the tunnel manager.
+func SocketPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".leap", "tunnels.sock")
+}
+
+// LockPath returns the lock file a running manager holds, so only one
+// manager ever owns the socket.
+func LockPath() string {
+	return filepath.Join(filepath.Dir(SocketPath()), "tunnels.lock")
+}
+
+type manager struct {
+	mu       sync.Mutex
+	sessions map[string]*entry
+	// pending counts ups still dialing, so the manager doesn't exit under them
+	pending  int
+	listener net.Listener
+	// handlers tracks requests in flight, so their replies go out before exit
+	handlers sync.WaitGroup
+}
+
+type entry struct {
+	profile string
+	session *Session
+}
+
+func sessionKey(profile, name string) string {
+	return profile + "/" + name
+}
+
+// Serve runs the tunnel manager in the foreground. It exits once the last
+// session has been taken down, or when stopped.
+func Serve() error {
+	path := SocketPath()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	// Held until exit, and released after the socket is removed
+	lock, err := os.OpenFile(LockPath(), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	locked, err := tryLockFile(lock)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %v", LockPath(), err)
+	}
+	if !locked {
+		return fmt.Errorf("a tunnel manager is already running on %s", path)
+	}
+	defer unlockFile(lock)
+
+	os.Remove(path) // stale socket from a crashed manager
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return err
+	}
+
+	m := &manager{
+		sessions: make(map[string]*entry),
+		listener: listener,
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			m.handlers.Wait()
+			m.closeAll()
+			return nil
+		}
+
+		m.handlers.Add(1)
+		go m.handle(conn)
+	}
+}
+
+func (m *manager) handle(conn net.Conn) {
+	defer m.handlers.Done()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(upTimeout + 5*time.Second))
+
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return
+	}
+
+	if err := agent.CheckPeer(unixConn); err != nil {
+		json.NewEncoder(conn).Encode(response{Error: err.Error()})
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		return
+	}
+
+	json.NewEncoder(conn).Encode(m.dispatch(req))
+}
+
+func (m *manager) dispatch(req request) response {
+	switch req.Op {
+	case "up":
+		if req.Conn == nil {
+			return response{Error: "connection is required"}
+		}
+		if err := m.up(req); err != nil {
+			return response{Error: err.Error()}
+		}
+		return response{OK: true}
+
+	case "down":
+		return response{OK: true, Closed: m.down(req.Profile, req.Names)}
+
+	case "status":
+		return response{OK: true, Sessions: m.status(), PID: os.Getpid()}
+
+	case "stop":
+		m.listener.Close()
+		return response{OK: true}
+	}
+
+	return response{Error: fmt.Sprintf("unknown operation %q", req.Op)}
+}
+
+// up (re)opens the tunnels of a connection, replacing a session that is
+// already there.
+func (m *manager) up(req request) error {
+	key := sessionKey(req.Profile, req.Conn.Name)
+
+	m.mu.Lock()
+	old := m.sessions[key]
+	delete(m.sessions, key)
+	m.pending++
+	m.mu.Unlock()
+
+	// Free the old ports before binding them again
+	if old != nil {
+		old.session.Close()
+	}
+
+	opts := leapssh.DialOptions{
+		Config: &config.Config{Connections: req.Hops},
+	}
+
+	session, err := Open(*req.Conn, req.Tunnels, opts)
+
+	m.mu.Lock()
+	m.pending--
+	if err == nil {
+		m.sessions[key] = &entry{profile: req.Profile, session: session}
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		m.exitIfIdle()
+	}
+
+	return err
+}
+
+// down closes the sessions of names in profile, or every session of the
+// profile when names is empty, and returns how many were closed.
+func (m *manager) down(profile string, names []string) int {
+	m.mu.Lock()
+	var closing []*Session
+	for key, e := range m.sessions {
+		if e.profile == profile && (len(names) == 0 || slices.Contains(names, e.session.Conn.Name)) {
+			closing = append(closing, e.session)
+			delete(m.sessions, key)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, s := range closing {
+		s.Close()
+	}
+
+	m.exitIfIdle()
+
+	return len(closing)
+}
+
+func (m *manager) status() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var statuses []Status
+	for _, e := range m.sessions {
+		status := e.session.Status()
+		status.Profile = e.profile
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Profile != statuses[j].Profile {
+			return statuses[i].Profile < statuses[j].Profile
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses
+}
+
+// exitIfIdle stops the manager when it has nothing left to look after.
+// Sessions that went down on their own stay listed until taken down. Serve
+// waits for the handler calling this to send its reply before exiting.
+func (m *manager) exitIfIdle() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.sessions) == 0 && m.pending == 0 {
+		m.listener.Close()
+	}
+}
+
+func (m *manager) closeAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, e := range m.sessions {
+		e.session.Close()
+		delete(m.sessions, key)
+	}
+}
+
+func call(req request, timeout time.Duration) (response, error) {
+	conn, err := net.DialTimeout("unix", SocketPath(), time.Second)
+	if err != nil {
+		return response{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return response{}, err
+	}
+
+	var res response
+	if err := json.NewDecoder(conn).Decode(&res); err != nil {
+		return response{}, err
+	}
+
+	if !res.OK {
+		return res, fmt.Errorf("%s", res.Error)
+	}
+
+	return res, nil
+}
+
+// Running reports whether a tunnel manager answers on the socket.
+func Running() bool {
+	_, err := call(request{Op: "status"}, 5*time.Second)
+	return err == nil
+}
+
+// Up asks the manager to open the tunnels of conn, replacing any it already
+// has open for it. hops holds the saved jump hosts conn goes through.
+func Up(profile string, conn config.Connection, hops []config.Connection, tunnels []config.Tunnel) error {
+	req := request{
+		Op:      "up",
+		Profile: profile,
+		Conn:    &conn,
+		Hops:    make(map[string]config.Connection),
+		Tunnels: tunnels,
+	}
+	for _, hop := range hops {
+		req.Hops[hop.Name] = hop
+	}
+
+	_, err := call(req, upTimeout+5*time.Second)
+	return err
+}
+
+// Down closes the tunnels of names in profile, or all of the profile's when
+// names is empty, and returns how many connections were closed.
+func Down(profile string, names []string) (int, error) {
+	res, err := call(request{Op: "down", Profile: profile, Names: names}, 10*time.Second)
+	return res.Closed, err
+}
+
+// List returns every session of the running manager and its PID.
+func List() ([]Status, int, error) {
+	res, err := call(request{Op: "status"}, 5*time.Second)
+	return res.Sessions, res.PID, err
+}
+
+// Stop closes every tunnel and shuts the manager down.
+func Stop() error {
+	_, err := call(request{Op: "stop"}, 5*time.Second)
+	return err
+}
@@ -0,0 +1,115 @@
+package tunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// SOCKS5 constants from RFC 1928.
+const (
+	socksVersion = 5
+
+	socksNoAuth       = 0x00
+	socksNoAcceptable = 0xff
+
+	socksConnect = 0x01
+
+	socksIPv4   = 0x01
+	socksDomain = 0x03
+	socksIPv6   = 0x04
+
+	socksSucceeded           = 0x00
+	socksHostUnreachable     = 0x04
+	socksCommandNotSupported = 0x07
+	socksAddressNotSupported = 0x08
+)
+
+// socksHandshake reads a SOCKS5 greeting and CONNECT request from conn and
+// returns the address asked for. Only CONNECT without authentication is
+// supported; the listener is bound to loopback by default, like ssh -D.
+func socksHandshake(conn net.Conn) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socksVersion {
+		return "", fmt.Errorf("not a SOCKS5 client (version %d)", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+
+	noAuth := false
+	for _, m := range methods {
+		if m == socksNoAuth {
+			noAuth = true
+		}
+	}
+	if !noAuth {
+		conn.Write([]byte{socksVersion, socksNoAcceptable})
+		return "", errors.New("SOCKS5 client requires authentication")
+	}
+	if _, err := conn.Write([]byte{socksVersion, socksNoAuth}); err != nil {
+		return "", err
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", err
+	}
+	if request[0] != socksVersion {
+		return "", fmt.Errorf("bad SOCKS5 request version %d", request[0])
+	}
+
+	var host string
+	switch request[3] {
+	case socksIPv4, socksIPv6:
+		size := net.IPv4len
+		if request[3] == socksIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socksDomain:
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return "", err
+		}
+		domain := make([]byte, size[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		socksReply(conn, socksAddressNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS5 address type %d", request[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+
+	if request[1] != socksConnect {
+		socksReply(conn, socksCommandNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS5 command %d", request[1])
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// socksReply answers a CONNECT request. The bound address is left zero: it
+// is on the far side of the SSH connection and clients don't use it.
+func socksReply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{socksVersion, code, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
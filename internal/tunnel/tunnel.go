@@ -0,0 +1,469 @@
+// Package tunnel forwards ports over SSH natively and runs the background
+// manager that keeps saved tunnels up after the terminal is gone.
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/paramientos/leap/internal/config"
+	leapssh "github.com/paramientos/leap/internal/ssh"
+	"golang.org/x/crypto/ssh"
+)
+
+// States of a session.
+const (
+	StateUp           = "up"
+	StateReconnecting = "reconnecting"
+	StateDown         = "down"
+)
+
+// Supervision timings. A keepalive that goes unanswered means the transport
+// is dead even if TCP hasn't noticed, e.g. after the laptop slept.
+const (
+	keepAliveInterval = 15 * time.Second
+	keepAliveTimeout  = 10 * time.Second
+	minBackoff        = time.Second
+	maxBackoff        = time.Minute
+
+	socksHandshakeTimeout = 10 * time.Second
+)
+
+// Status describes a session and its forwards.
+type Status struct {
+	Profile string    `json:"profile"`
+	Name    string    `json:"name"`
+	Target  string    `json:"target"`
+	State   string    `json:"state"`
+	Since   time.Time `json:"since"`
+	Error   string    `json:"error,omitempty"`
+	// Reconnects counts successful redials over the session's life.
+	Reconnects int `json:"reconnects,omitempty"`
+	// Attempts and NextTry describe the redial in progress while reconnecting.
+	Attempts int             `json:"attempts,omitempty"`
+	NextTry  time.Time       `json:"next_try,omitempty"`
+	Forwards []ForwardStatus `json:"forwards"`
+}
+
+// ForwardStatus counts the connections carried by one forward.
+type ForwardStatus struct {
+	Spec   string `json:"spec"`
+	Active int64  `json:"active"`
+	Total  int64  `json:"total"`
+}
+
+// Session is one SSH connection carrying a set of tunnels. It watches the
+// connection with keepalives and redials it with backoff when it is lost.
+type Session struct {
+	Conn config.Connection
+	// Logf, when set, is told about state changes and connections that could
+	// not be forwarded.
+	Logf func(format string, args ...any)
+
+	opts leapssh.DialOptions
+
+	mu         sync.Mutex
+	client     *ssh.Client
+	forwards   []*forward
+	state      string
+	since      time.Time
+	err        error
+	closed     bool
+	reconnects int
+	attempts   int
+	nextTry    time.Time
+	done       chan struct{}
+}
+
+type forward struct {
+	tunnel   config.Tunnel
+	listener net.Listener
+	active   atomic.Int64
+	total    atomic.Int64
+}
+
+// Open binds the local port of every local and dynamic tunnel, then dials
+// conn and asks the server to listen for the remote ones. Binding first
+// means a port in use here fails before anything is dialed; nothing is left
+// open when Open fails. Once open, the session reconnects on its own until
+// closed or until a redial fails for good, e.g. on a changed host key.
+func Open(conn config.Connection, tunnels []config.Tunnel, opts leapssh.DialOptions) (*Session, error) {
+	if len(tunnels) == 0 {
+		return nil, fmt.Errorf("no tunnels to open for %s", conn.Name)
+	}
+
+	s := &Session{Conn: conn, opts: opts, done: make(chan struct{})}
+
+	for _, t := range tunnels {
+		f := &forward{tunnel: t}
+		s.forwards = append(s.forwards, f)
+
+		if t.Kind() == config.TunnelRemote {
+			continue
+		}
+
+		listener, err := net.Listen("tcp", t.ListenAddr())
+		if err != nil {
+			s.closeListeners()
+			return nil, fmt.Errorf("%s: %v", t, err)
+		}
+		f.listener = listener
+	}
+
+	client, err := leapssh.Dial(conn, opts)
+	if err != nil {
+		s.closeListeners()
+		return nil, err
+	}
+
+	if err := s.attach(client); err != nil {
+		s.closeListeners()
+		return nil, err
+	}
+
+	// Local ports stay bound across reconnects, so nothing else takes them
+	for _, f := range s.forwards {
+		if f.tunnel.Kind() != config.TunnelRemote {
+			go s.serve(f, f.listener)
+		}
+	}
+
+	go s.supervise()
+
+	return s, nil
+}
+
+// attach makes client the session's connection, listening on the server
+// again for the remote tunnels.
+func (s *Session) attach(client *ssh.Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || s.state == StateDown {
+		client.Close()
+		return fmt.Errorf("session closed")
+	}
+
+	var remote []*forward
+	for _, f := range s.forwards {
+		if f.tunnel.Kind() != config.TunnelRemote {
+			continue
+		}
+
+		listener, err := client.Listen("tcp", f.tunnel.ListenAddr())
+		if err != nil {
+			client.Close()
+			return fmt.Errorf("%s: server refused to listen: %v", f.tunnel, err)
+		}
+		f.listener = listener
+		remote = append(remote, f)
+	}
+
+	s.client = client
+	s.state = StateUp
+	s.since = time.Now()
+	s.attempts = 0
+	s.nextTry = time.Time{}
+
+	for _, f := range remote {
+		go s.serve(f, f.listener)
+	}
+
+	return nil
+}
+
+// supervise watches the connection and redials it whenever it is lost,
+// until the session goes down.
+func (s *Session) supervise() {
+	for {
+		s.mu.Lock()
+		client := s.client
+		s.mu.Unlock()
+
+		reason := watch(client)
+		client.Close()
+
+		if !s.reconnect(reason) {
+			return
+		}
+	}
+}
+
+// watch blocks until client's transport ends or stops answering keepalives,
+// and returns why.
+func watch(client *ssh.Client) error {
+	lost := make(chan error, 1)
+	go func() { lost <- client.Wait() }()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-lost:
+			if err == nil {
+				err = io.EOF
+			}
+			return fmt.Errorf("connection lost: %v", err)
+
+		case <-ticker.C:
+			replied := make(chan error, 1)
+			go func() {
+				_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+				replied <- err
+			}()
+
+			select {
+			case err := <-replied:
+				if err != nil {
+					return fmt.Errorf("connection lost: %v", err)
+				}
+			case err := <-lost:
+				return fmt.Errorf("connection lost: %v", err)
+			case <-time.After(keepAliveTimeout):
+				return fmt.Errorf("connection lost: no keepalive reply in %s", keepAliveTimeout)
+			}
+		}
+	}
+}
+
+// reconnect redials with exponential backoff and reports whether the
+// session is up again. It gives up when the session is closed or when the
+// failure is one a retry can't fix: the login was refused or the host key
+// changed.
+func (s *Session) reconnect(reason error) bool {
+	s.mu.Lock()
+	if s.closed || s.state == StateDown {
+		s.mu.Unlock()
+		return false
+	}
+	s.client = nil
+	s.state = StateReconnecting
+	s.since = time.Now()
+	s.err = reason
+	s.mu.Unlock()
+
+	s.logf("%v; reconnecting", reason)
+
+	// A redial runs unattended; answers from the first dial are cached
+	opts := s.opts
+	opts.Interactive = false
+
+	backoff := minBackoff
+	for {
+		s.mu.Lock()
+		s.nextTry = time.Now().Add(backoff)
+		s.mu.Unlock()
+
+		select {
+		case <-s.done:
+			return false
+		case <-time.After(backoff):
+		}
+
+		client, err := leapssh.Dial(s.Conn, opts)
+		if err == nil {
+			err = s.attach(client)
+		}
+		if err == nil {
+			s.mu.Lock()
+			s.reconnects++
+			s.mu.Unlock()
+
+			s.logf("reconnected")
+			return true
+		}
+
+		var authErr *leapssh.AuthError
+		var keyErr *leapssh.HostKeyChangedError
+		if errors.As(err, &authErr) || errors.As(err, &keyErr) {
+			s.down(err)
+			return false
+		}
+
+		s.mu.Lock()
+		s.attempts++
+		s.err = err
+		s.mu.Unlock()
+
+		s.logf("reconnect failed: %v", err)
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// Wait blocks until the session goes down and returns why; nil after Close.
+func (s *Session) Wait() error {
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close shuts the listeners and the SSH connection.
+func (s *Session) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	s.down(nil)
+}
+
+// down tears the session down for good, keeping the reason given.
+func (s *Session) down(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == StateDown {
+		return
+	}
+
+	s.err = err
+	if s.closed {
+		s.err = nil
+	}
+	s.state = StateDown
+	s.since = time.Now()
+	s.nextTry = time.Time{}
+
+	s.closeListeners()
+	if s.client != nil {
+		s.client.Close()
+	}
+	close(s.done)
+}
+
+func (s *Session) closeListeners() {
+	for _, f := range s.forwards {
+		if f.listener != nil {
+			f.listener.Close()
+		}
+	}
+}
+
+// Status reports the session's state and traffic.
+func (s *Session) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := Status{
+		Name:       s.Conn.Name,
+		Target:     fmt.Sprintf("%s@%s", s.Conn.User, leapssh.Address(s.Conn)),
+		State:      s.state,
+		Since:      s.since,
+		Reconnects: s.reconnects,
+		Attempts:   s.attempts,
+		NextTry:    s.nextTry,
+	}
+	if s.err != nil && s.state != StateUp {
+		status.Error = s.err.Error()
+	}
+
+	for _, f := range s.forwards {
+		status.Forwards = append(status.Forwards, ForwardStatus{
+			Spec:   f.tunnel.String(),
+			Active: f.active.Load(),
+			Total:  f.total.Load(),
+		})
+	}
+
+	return status
+}
+
+func (s *Session) serve(f *forward, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			f.active.Add(1)
+			f.total.Add(1)
+			defer f.active.Add(-1)
+
+			target, err := s.dial(f.tunnel, conn)
+			if err != nil {
+				conn.Close()
+				s.logf("%s: %v", f.tunnel, err)
+				return
+			}
+
+			pipe(conn, target)
+		}()
+	}
+}
+
+// dial opens the other end of a connection accepted by a forward: from the
+// server for local and dynamic tunnels, from here for remote ones.
+func (s *Session) dial(t config.Tunnel, conn net.Conn) (net.Conn, error) {
+	s.mu.Lock()
+	client := s.client
+	s.mu.Unlock()
+
+	if client == nil && t.Kind() != config.TunnelRemote {
+		return nil, fmt.Errorf("not connected, reconnecting")
+	}
+
+	switch t.Kind() {
+	case config.TunnelRemote:
+		return net.DialTimeout("tcp", t.TargetAddr(), 10*time.Second)
+
+	case config.TunnelDynamic:
+		// A client that connects and says nothing mustn't hold on forever
+		conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+		addr, err := socksHandshake(conn)
+		if err != nil {
+			return nil, err
+		}
+
+		target, err := client.Dial("tcp", addr)
+		if err != nil {
+			socksReply(conn, socksHostUnreachable)
+			return nil, fmt.Errorf("%s: %v", addr, err)
+		}
+
+		if err := socksReply(conn, socksSucceeded); err != nil {
+			target.Close()
+			return nil, err
+		}
+		conn.SetDeadline(time.Time{})
+		return target, nil
+	}
+
+	return client.Dial("tcp", t.TargetAddr())
+}
+
+func (s *Session) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// pipe copies both ways until each side is done, passing half-closes on.
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	wg.Wait()
+
+	a.Close()
+	b.Close()
+}
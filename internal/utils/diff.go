@@ -0,0 +1,66 @@
+package utils
+
+// DiffOp marks a line in a diff as unchanged, removed or added.
+type DiffOp byte
+
+const (
+	DiffEqual  DiffOp = ' '
+	DiffDelete DiffOp = '-'
+	DiffInsert DiffOp = '+'
+)
+
+// DiffLine is one line of a line-based diff.
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// DiffLines returns a minimal line diff turning a into b, computed from their
+// longest common subsequence.
+func DiffLines(a, b []string) []DiffLine {
+	n, m := len(a), len(b)
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []DiffLine
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, DiffLine{DiffEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{DiffDelete, a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{DiffInsert, b[j]})
+			j++
+		}
+	}
+
+	for ; i < n; i++ {
+		diff = append(diff, DiffLine{DiffDelete, a[i]})
+	}
+	for ; j < m; j++ {
+		diff = append(diff, DiffLine{DiffInsert, b[j]})
+	}
+
+	return diff
+}
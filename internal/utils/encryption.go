@@ -2,14 +2,12 @@ package utils
 
 import (
 	"bytes"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"crypto/sha256"
 	"fmt"
 	"io"
+	"strings"
 
 	"filippo.io/age"
+	"filippo.io/age/agessh"
 )
 
 func Encrypt(data []byte, passphrase string) ([]byte, error) {
@@ -18,8 +16,22 @@ func Encrypt(data []byte, passphrase string) ([]byte, error) {
 		return nil, err
 	}
 
+	return EncryptToRecipients(data, recipient)
+}
+
+func Decrypt(data []byte, passphrase string) ([]byte, error) {
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecryptWithIdentities(data, identity)
+}
+
+// EncryptToRecipients encrypts data so that any one of the recipients can decrypt it
+func EncryptToRecipients(data []byte, recipients ...age.Recipient) ([]byte, error) {
 	buf := &bytes.Buffer{}
-	w, err := age.Encrypt(buf, recipient)
+	w, err := age.Encrypt(buf, recipients...)
 	if err != nil {
 		return nil, err
 	}
@@ -35,13 +47,9 @@ func Encrypt(data []byte, passphrase string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func Decrypt(data []byte, passphrase string) ([]byte, error) {
-	identity, err := age.NewScryptIdentity(passphrase)
-	if err != nil {
-		return nil, err
-	}
-
-	r, err := age.Decrypt(bytes.NewReader(data), identity)
+// DecryptWithIdentities decrypts data with the first matching identity
+func DecryptWithIdentities(data []byte, identities ...age.Identity) ([]byte, error) {
+	r, err := age.Decrypt(bytes.NewReader(data), identities...)
 	if err != nil {
 		return nil, err
 	}
@@ -54,49 +62,41 @@ func Decrypt(data []byte, passphrase string) ([]byte, error) {
 	return out.Bytes(), nil
 }
 
-// Obfuscate encrypts data using a key derived from system strings
-func Obfuscate(data []byte, salt string) ([]byte, error) {
-	key := sha256.Sum256([]byte(salt))
-	block, err := aes.NewCipher(key[:])
-	if err != nil {
-		return nil, err
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, err
+// IsPassphraseEncrypted reports whether an age file was encrypted with a passphrase
+func IsPassphraseEncrypted(data []byte) bool {
+	header := data
+	if i := bytes.Index(data, []byte("\n---")); i >= 0 {
+		header = data[:i]
 	}
 
-	return gcm.Seal(nonce, nonce, data, nil), nil
+	return bytes.Contains(header, []byte("\n-> scrypt "))
 }
 
-// Deobfuscate decrypts data using a key derived from system strings
-func Deobfuscate(data []byte, salt string) ([]byte, error) {
-	if len(data) < 12 {
-		return nil, fmt.Errorf("invalid data")
-	}
+// ParseRecipient parses an age X25519 public key or an ssh-ed25519/ssh-rsa public key
+func ParseRecipient(s string) (age.Recipient, error) {
+	s = strings.TrimSpace(s)
 
-	key := sha256.Sum256([]byte(salt))
-	block, err := aes.NewCipher(key[:])
-	if err != nil {
-		return nil, err
+	if strings.HasPrefix(s, "age1") {
+		return age.ParseX25519Recipient(s)
 	}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
+	if strings.HasPrefix(s, "ssh-") {
+		return agessh.ParseRecipient(s)
 	}
 
-	nonceSize := gcm.NonceSize()
-	if len(data) < nonceSize {
-		return nil, fmt.Errorf("ciphertext too short")
+	return nil, fmt.Errorf("unsupported recipient %q (expected age1... or an ssh public key)", s)
+}
+
+// ParseIdentities parses an age identity file or an unencrypted ssh private key
+func ParseIdentities(data []byte) ([]age.Identity, error) {
+	if bytes.Contains(data, []byte("PRIVATE KEY-----")) {
+		identity, err := agessh.ParseIdentity(data)
+		if err != nil {
+			return nil, err
+		}
+
+		return []age.Identity{identity}, nil
 	}
 
-	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-	return gcm.Open(nil, nonce, ciphertext, nil)
+	return age.ParseIdentities(bytes.NewReader(data))
 }
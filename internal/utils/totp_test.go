@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 appendix B.
+func TestTOTPCodeRFC6238(t *testing.T) {
+	seeds := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+
+	tests := []struct {
+		algorithm string
+		unix      int64
+		want      string
+	}{
+		{"SHA1", 59, "94287082"},
+		{"SHA1", 1111111109, "07081804"},
+		{"SHA1", 1234567890, "89005924"},
+		{"SHA1", 2000000000, "69279037"},
+		{"SHA256", 59, "46119246"},
+		{"SHA256", 1111111109, "68084774"},
+		{"SHA512", 59, "90693936"},
+		{"SHA512", 1111111109, "25091201"},
+	}
+
+	for _, tt := range tests {
+		secret := base32.StdEncoding.EncodeToString([]byte(seeds[tt.algorithm]))
+		uri := fmt.Sprintf("otpauth://totp/test?secret=%s&digits=8&algorithm=%s", secret, tt.algorithm)
+
+		key, err := ParseTOTPKey(uri)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.algorithm, err)
+		}
+
+		if got := key.Code(key.Step(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("%s at %d = %s, want %s", tt.algorithm, tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestParseTOTPKey(t *testing.T) {
+	key, err := ParseTOTPKey(" gezd gnbv gy3t qojq gezd gnbv gy3t qojq ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Digits != 6 || key.Period != 30*time.Second {
+		t.Errorf("defaults = %d digits every %v, want 6 every 30s", key.Digits, key.Period)
+	}
+	if got := key.Code(key.Step(time.Unix(59, 0))); got != "287082" {
+		t.Errorf("code = %s, want 287082", got)
+	}
+
+	invalid := map[string]string{
+		"not base32!": "not valid base32",
+		"":            "not valid base32",
+		"otpauth://totp/x?secret=GEZDGNBV&digits=5":      "invalid digits",
+		"otpauth://totp/x?secret=GEZDGNBV&digits=10":     "invalid digits",
+		"otpauth://totp/x?secret=GEZDGNBV&period=0":      "invalid period",
+		"otpauth://totp/x?secret=GEZDGNBV&algorithm=MD5": "unsupported algorithm",
+	}
+
+	for in, want := range invalid {
+		_, err := ParseTOTPKey(in)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseTOTPKey(%q) error = %v, want %q", in, err, want)
+		}
+	}
+}